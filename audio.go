@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// speechConfig builds the voice settings of -voice: a prebuilt voice name or
+// two speaker:voice pairs separated by commas for a dialogue.
+func speechConfig(voice string) (*genai.SpeechConfig, error) {
+	if !strings.Contains(voice, ":") {
+		return &genai.SpeechConfig{VoiceConfig: prebuiltVoice(voice)}, nil
+	}
+	multi := &genai.MultiSpeakerVoiceConfig{}
+	for _, pair := range strings.Split(voice, ",") {
+		speaker, name, ok := strings.Cut(pair, ":")
+		speaker, name = strings.TrimSpace(speaker), strings.TrimSpace(name)
+		if !ok || speaker == "" || name == "" {
+			return nil, fmt.Errorf("invalid speaker voice '%s'", pair)
+		}
+		multi.SpeakerVoiceConfigs = append(multi.SpeakerVoiceConfigs, &genai.SpeakerVoiceConfig{
+			Speaker:     speaker,
+			VoiceConfig: prebuiltVoice(name),
+		})
+	}
+	if len(multi.SpeakerVoiceConfigs) != 2 {
+		return nil, fmt.Errorf("multi-speaker speech needs two speakers, got %d", len(multi.SpeakerVoiceConfigs))
+	}
+	return &genai.SpeechConfig{MultiSpeakerVoiceConfig: multi}, nil
+}
+
+func prebuiltVoice(name string) *genai.VoiceConfig {
+	return &genai.VoiceConfig{PrebuiltVoiceConfig: &genai.PrebuiltVoiceConfig{VoiceName: strings.TrimSpace(name)}}
+}
+
+// generateSpeech requests the prompt as audio and writes it as WAV to
+// stdout when redirected, otherwise to a file in -out or the temp folder.
+func (g *Generator) generateSpeech(config *genai.GenerateContentConfig) error {
+	contents := []*genai.Content{{Role: "user", Parts: g.parts}}
+	resp, err := g.client.GenerateContent(g.ctx, g.params.GenModel, contents, config)
+	if err != nil {
+		return err
+	}
+	g.usage = addUsage(g.usage, resp.UsageMetadata)
+	if g.params.CountTokens && resp.UsageMetadata != nil {
+		TokenCount.Store(resp.UsageMetadata.TotalTokenCount)
+	}
+
+	audio := &genai.Blob{}
+	if len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil {
+		g.finishReason = resp.Candidates[0].FinishReason
+		for _, p := range resp.Candidates[0].Content.Parts {
+			if p.InlineData != nil && strings.HasPrefix(p.InlineData.MIMEType, "audio") {
+				if audio.MIMEType == "" {
+					audio.MIMEType = p.InlineData.MIMEType
+				}
+				audio.Data = append(audio.Data, p.InlineData.Data...)
+			} else if p.Text != "" && g.params.Verbose {
+				fmt.Fprintf(os.Stderr, infos("%s\n"), p.Text)
+			}
+		}
+	}
+	if len(audio.Data) == 0 {
+		return fmt.Errorf("no audio in response (%s)", g.finishReason)
+	}
+
+	if g.params.OutRedirected && g.events == nil {
+		return writeAudio(g.out, audio)
+	}
+	path, err := saveAudio(g.params.OutPath, audio)
+	if err != nil {
+		return err
+	}
+	if g.events != nil {
+		return g.events.emitSaved("audio/wav", path)
+	}
+	fmt.Fprintf(g.out, infos("%s")+"\n", path)
+	return nil
+}
+
+// saveAudio writes audio as WAV file in dir, the temp folder if empty, and
+// returns its path.
+func saveAudio(dir string, audio *genai.Blob) (string, error) {
+	f, err := os.CreateTemp(dir, "gen-*.wav")
+	if err != nil {
+		return "", fmt.Errorf("saving audio: %v", err)
+	}
+	defer f.Close()
+	if err := writeAudio(f, audio); err != nil {
+		return "", fmt.Errorf("saving audio: %v", err)
+	}
+	return f.Name(), nil
+}
+
+// writeAudio writes WAV data as is and wraps raw PCM in a WAV header.
+func writeAudio(w io.Writer, audio *genai.Blob) error {
+	mediaType, params, err := mime.ParseMediaType(audio.MIMEType)
+	if err != nil {
+		return fmt.Errorf("audio of type %s: %v", audio.MIMEType, err)
+	}
+	switch mediaType {
+	case "audio/wav", "audio/x-wav", "audio/wave":
+		_, err = w.Write(audio.Data)
+		return err
+	case "audio/l16", "audio/pcm":
+		rate, channels := 24000, 1
+		if n, err := strconv.Atoi(params["rate"]); err == nil && n > 0 {
+			rate = n
+		}
+		if n, err := strconv.Atoi(params["channels"]); err == nil && n > 0 {
+			channels = n
+		}
+		return writeWAV(w, audio.Data, rate, channels)
+	}
+	return fmt.Errorf("audio of type %s: not supported", audio.MIMEType)
+}
+
+// writeWAV writes 16-bit little endian PCM samples with a WAV header.
+func writeWAV(w io.Writer, pcm []byte, rate int, channels int) error {
+	const bitsPerSample = 16
+	blockAlign := channels * bitsPerSample / 8
+	header := []any{
+		[4]byte{'R', 'I', 'F', 'F'},
+		uint32(36 + len(pcm)),
+		[4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16), // size of the fmt chunk
+		uint16(1),  // PCM
+		uint16(channels),
+		uint32(rate),
+		uint32(rate * blockAlign), // bytes per second
+		uint16(blockAlign),
+		uint16(bitsPerSample),
+		[4]byte{'d', 'a', 't', 'a'},
+		uint32(len(pcm)),
+	}
+	for _, v := range header {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(pcm)
+	return err
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+func TestSpeechConfig(t *testing.T) {
+	testCases := []struct {
+		voice    string
+		speakers []string
+		wantErr  bool
+	}{
+		{"Kore", nil, false},
+		{"Joe:Kore, Jane:Puck", []string{"Joe", "Jane"}, false},
+		{"Joe:Kore", nil, true},
+		{"Joe:Kore,Jane:Puck,Ann:Zephyr", nil, true},
+		{"Joe:,Jane:Puck", nil, true},
+	}
+	for _, tc := range testCases {
+		config, err := speechConfig(tc.voice)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: unexpected error %v", tc.voice, err)
+			continue
+		}
+		if tc.wantErr {
+			continue
+		}
+		if tc.speakers == nil {
+			if config.VoiceConfig.PrebuiltVoiceConfig.VoiceName != tc.voice {
+				t.Errorf("%s: unexpected voice %+v", tc.voice, config.VoiceConfig.PrebuiltVoiceConfig)
+			}
+			continue
+		}
+		for i, s := range config.MultiSpeakerVoiceConfig.SpeakerVoiceConfigs {
+			if s.Speaker != tc.speakers[i] || s.VoiceConfig.PrebuiltVoiceConfig.VoiceName == "" {
+				t.Errorf("%s: unexpected speaker %+v", tc.voice, s)
+			}
+		}
+	}
+}
+
+func TestWriteAudio(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeAudio(&buf, &genai.Blob{MIMEType: "audio/L16;codec=pcm;rate=16000", Data: []byte{1, 2, 3, 4}}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if len(data) != 48 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" || string(data[36:40]) != "data" {
+		t.Fatalf("unexpected WAV header % x", data)
+	}
+	if rate := binary.LittleEndian.Uint32(data[24:28]); rate != 16000 {
+		t.Errorf("expected rate 16000, got %d", rate)
+	}
+	if size := binary.LittleEndian.Uint32(data[40:44]); size != 4 {
+		t.Errorf("expected 4 bytes of samples, got %d", size)
+	}
+	if err := writeAudio(&buf, &genai.Blob{MIMEType: "audio/mpeg"}); err == nil {
+		t.Errorf("expected unsupported type error")
+	}
+}
+
+func TestGenContent_Audio(t *testing.T) {
+	audioReply := func() fakeReply {
+		return fakeReply{chunks: []*genai.GenerateContentResponse{{Candidates: []*genai.Candidate{{
+			Content: &genai.Content{Role: "model", Parts: []*genai.Part{
+				{InlineData: &genai.Blob{MIMEType: "audio/L16;codec=pcm;rate=24000", Data: []byte{1, 2}}},
+				{InlineData: &genai.Blob{MIMEType: "audio/L16;codec=pcm;rate=24000", Data: []byte{3, 4}}},
+			}},
+			FinishReason: genai.FinishReasonStop,
+		}}}}}
+	}
+
+	fake := &fakeBackend{replies: []fakeReply{audioReply()}}
+	ctx := prepareTestContext(t, true, "-audio", "-voice", "Joe:Kore,Jane:Puck", "Joe: hi Jane! Jane: hi Joe!")
+	params := ctx.Value(core.ParamsKey).(*core.Parameters)
+	params.Client = fake
+	params.OutRedirected = true
+	var output bytes.Buffer
+	if err := genContent(ctx, strings.NewReader(""), &output); err != nil {
+		t.Fatal(err)
+	}
+	if data := output.Bytes(); len(data) != 48 || !bytes.HasSuffix(data, []byte{1, 2, 3, 4}) {
+		t.Errorf("expected WAV of both chunks on stdout, got % x", data)
+	}
+	config := fake.configs[0]
+	if config.ResponseModalities[0] != "AUDIO" || len(config.SpeechConfig.MultiSpeakerVoiceConfig.SpeakerVoiceConfigs) != 2 {
+		t.Errorf("expected audio modality and two speakers, got %+v", config)
+	}
+
+	dir := t.TempDir()
+	fake = &fakeBackend{replies: []fakeReply{audioReply()}}
+	ctx = prepareTestContext(t, true, "-audio", "-out", dir, "hello")
+	params = ctx.Value(core.ParamsKey).(*core.Parameters)
+	params.Client = fake
+	params.OutRedirected = false
+	var terminal strings.Builder
+	if err := genContent(ctx, strings.NewReader(""), &terminal); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || !strings.Contains(terminal.String(), entries[0].Name()) {
+		t.Errorf("expected WAV file in -out folder, got %v, %q", entries, terminal.String())
+	}
+
+	fake = &fakeBackend{replies: []fakeReply{textReply("no voice")}}
+	ctx = prepareTestContext(t, true, "-audio", "hello")
+	ctx.Value(core.ParamsKey).(*core.Parameters).Client = fake
+	if err := genContent(ctx, strings.NewReader(""), &terminal); err == nil || !strings.Contains(err.Error(), "no audio") {
+		t.Errorf("expected missing audio error, got %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"os"
+	"strings"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+// newBackend returns the model backend selected in preferences,
+// wrapped in a cassette when recording or replaced by one when replaying.
+func newBackend(ctx context.Context, params *core.Parameters) (core.Backend, error) {
+	if params.ReplayPath != "" {
+		return newReplayBackend(params.ReplayPath, params.Lenient)
+	}
+	var b core.Backend
+	switch strings.ToLower(params.Backend) {
+	case "", "gemini":
+		client, err := genai.NewClient(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		b = &geminiBackend{client: client}
+	case "openai":
+		b = newOpenAIBackend(params.BaseURL, os.Getenv("OPENAI_API_KEY"))
+	default:
+		return nil, fmt.Errorf("unknown backend '%s'", params.Backend)
+	}
+	b = &retryBackend{Wrapper: core.Wrapper{Backend: b}, policy: newRetryPolicy(params)}
+	b = &ledgerBackend{Wrapper: core.Wrapper{Backend: b}}
+	if params.RecordPath != "" {
+		return newRecordBackend(b, params.RecordPath)
+	}
+	return b, nil
+}
+
+// backendFromContext returns the backend stashed in params or creates one.
+func backendFromContext(ctx context.Context) (core.Backend, error) {
+	params, ok := ctx.Value(core.ParamsKey).(*core.Parameters)
+	if !ok {
+		return nil, fmt.Errorf("backendFromContext: params not found in context")
+	}
+	if params.Client == nil {
+		client, err := newBackend(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		params.Client = client
+	}
+	return params.Client, nil
+}
+
+// geminiBackend serves requests through the Gemini API or Vertex AI.
+type geminiBackend struct {
+	client *genai.Client
+}
+
+func (b *geminiBackend) Name() string {
+	if b.client.ClientConfig().Backend == genai.BackendVertexAI {
+		return "VertexAI"
+	}
+	return "GeminiAPI"
+}
+
+func (b *geminiBackend) GetModel(ctx context.Context, model string) (*genai.Model, error) {
+	return b.client.Models.Get(ctx, model, nil)
+}
+
+func (b *geminiBackend) ListModels(ctx context.Context) iter.Seq2[*genai.Model, error] {
+	return b.client.Models.All(ctx)
+}
+
+func (b *geminiBackend) GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	return b.client.Models.GenerateContent(ctx, model, contents, config)
+}
+
+func (b *geminiBackend) GenerateContentStream(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) iter.Seq2[*genai.GenerateContentResponse, error] {
+	return b.client.Models.GenerateContentStream(ctx, model, contents, config)
+}
+
+func (b *geminiBackend) EmbedContent(ctx context.Context, model string, contents []*genai.Content) (*genai.EmbedContentResponse, error) {
+	return b.client.Models.EmbedContent(ctx, model, contents, nil)
+}
+
+func (b *geminiBackend) CountTokens(ctx context.Context, model string, contents []*genai.Content) (*genai.CountTokensResponse, error) {
+	return b.client.Models.CountTokens(ctx, model, contents, nil)
+}
+
+func (b *geminiBackend) UploadFile(ctx context.Context, path string) (*genai.File, error) {
+	return b.client.Files.UploadFromPath(ctx, path, nil)
+}
+
+func (b *geminiBackend) GetFile(ctx context.Context, name string) (*genai.File, error) {
+	return b.client.Files.Get(ctx, name, nil)
+}
+
+func (b *geminiBackend) DeleteFile(ctx context.Context, name string) error {
+	_, err := b.client.Files.Delete(ctx, name, nil)
+	return err
+}
+
+func (b *geminiBackend) CreateBatchJob(ctx context.Context, model string, requests []*genai.InlinedRequest, displayName string) (*genai.BatchJob, error) {
+	return b.client.Batches.Create(ctx, model, &genai.BatchJobSource{InlinedRequests: requests}, &genai.CreateBatchJobConfig{DisplayName: displayName})
+}
+
+func (b *geminiBackend) GetBatchJob(ctx context.Context, name string) (*genai.BatchJob, error) {
+	return b.client.Batches.Get(ctx, name, nil)
+}
+
+func (b *geminiBackend) CreateCachedContent(ctx context.Context, model string, config *genai.CreateCachedContentConfig) (*genai.CachedContent, error) {
+	return b.client.Caches.Create(ctx, model, config)
+}
+
+func (b *geminiBackend) GetCachedContent(ctx context.Context, name string) (*genai.CachedContent, error) {
+	return b.client.Caches.Get(ctx, name, nil)
+}
+
+func (b *geminiBackend) GenerateImages(ctx context.Context, model string, prompt string, config *genai.GenerateImagesConfig) (*genai.GenerateImagesResponse, error) {
+	return b.client.Models.GenerateImages(ctx, model, prompt, config)
+}
+
+func (b *geminiBackend) EditImage(ctx context.Context, model string, prompt string, refs []genai.ReferenceImage, config *genai.EditImageConfig) (*genai.EditImageResponse, error) {
+	return b.client.Models.EditImage(ctx, model, prompt, refs, config)
+}
+
+func (b *geminiBackend) UpscaleImage(ctx context.Context, model string, image *genai.Image, factor string, config *genai.UpscaleImageConfig) (*genai.UpscaleImageResponse, error) {
+	return b.client.Models.UpscaleImage(ctx, model, image, factor, config)
+}
+
+func (b *geminiBackend) GenerateVideos(ctx context.Context, model string, prompt string, image *genai.Image, config *genai.GenerateVideosConfig) (*genai.GenerateVideosOperation, error) {
+	return b.client.Models.GenerateVideos(ctx, model, prompt, image, config)
+}
+
+func (b *geminiBackend) GetVideosOperation(ctx context.Context, op *genai.GenerateVideosOperation) (*genai.GenerateVideosOperation, error) {
+	return b.client.Operations.GetVideosOperation(ctx, op, nil)
+}
+
+func (b *geminiBackend) DownloadVideo(ctx context.Context, video *genai.Video) ([]byte, error) {
+	return b.client.Files.Download(ctx, genai.NewDownloadURIFromVideo(video), nil)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+// fakeBackend replies with scripted responses and records the requests it receives.
+type fakeBackend struct {
+	mu       sync.Mutex
+	replies  []fakeReply
+	contents [][]*genai.Content
+	configs  []*genai.GenerateContentConfig
+	models   []string
+	model    *genai.Model
+	uploads  int
+	caches   map[string]*genai.CachedContent
+	created  int                     // cached contents
+	images   []*genai.GeneratedImage // returned by image generation models
+	calls    []string                // image and video requests as kind:prompt
+	refs     []genai.ReferenceImage  // of the last edit
+	videos   []*genai.GeneratedVideo // returned by video generation models
+	pending  int                     // polls before a video operation is done
+	frame    *genai.Image            // of the last video request
+}
+
+// fakeReply is either a list of streamed chunks or an error.
+type fakeReply struct {
+	chunks []*genai.GenerateContentResponse
+	err    error
+}
+
+// textReply builds a single chunk reply ending with FinishReasonStop.
+func textReply(texts ...string) fakeReply {
+	var chunks []*genai.GenerateContentResponse
+	for i, text := range texts {
+		cand := &genai.Candidate{Content: &genai.Content{Role: "model", Parts: []*genai.Part{{Text: text}}}}
+		if i == len(texts)-1 {
+			cand.FinishReason = genai.FinishReasonStop
+		}
+		chunks = append(chunks, &genai.GenerateContentResponse{
+			Candidates:    []*genai.Candidate{cand},
+			UsageMetadata: &genai.GenerateContentResponseUsageMetadata{PromptTokenCount: 2, CandidatesTokenCount: 3, TotalTokenCount: 5},
+		})
+	}
+	return fakeReply{chunks: chunks}
+}
+
+func (b *fakeBackend) next(model string, contents []*genai.Content, config *genai.GenerateContentConfig) (fakeReply, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.contents = append(b.contents, contents)
+	b.configs = append(b.configs, config)
+	b.models = append(b.models, model)
+	if config != nil && config.CachedContent != "" {
+		if c, ok := b.caches[config.CachedContent]; ok && time.Now().After(c.ExpireTime) {
+			return fakeReply{}, genai.APIError{Code: 403, Message: "cached content expired"}
+		}
+	}
+	if len(b.replies) == 0 {
+		return fakeReply{}, fmt.Errorf("fakeBackend: no reply scripted")
+	}
+	r := b.replies[0]
+	b.replies = b.replies[1:]
+	return r, nil
+}
+
+func (b *fakeBackend) Name() string { return "Fake" }
+
+func (b *fakeBackend) GetModel(ctx context.Context, model string) (*genai.Model, error) {
+	if b.model != nil {
+		return b.model, nil
+	}
+	return &genai.Model{Name: model, InputTokenLimit: 1000, OutputTokenLimit: 100}, nil
+}
+
+func (b *fakeBackend) ListModels(ctx context.Context) iter.Seq2[*genai.Model, error] {
+	return func(yield func(*genai.Model, error) bool) {
+		yield(&genai.Model{Name: "fake"}, nil)
+	}
+}
+
+func (b *fakeBackend) GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	r, err := b.next(model, contents, config)
+	if err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.chunks[len(r.chunks)-1], nil
+}
+
+func (b *fakeBackend) GenerateContentStream(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) iter.Seq2[*genai.GenerateContentResponse, error] {
+	return func(yield func(*genai.GenerateContentResponse, error) bool) {
+		r, err := b.next(model, contents, config)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for _, c := range r.chunks {
+			if !yield(c, nil) {
+				return
+			}
+		}
+		if r.err != nil {
+			yield(nil, r.err)
+		}
+	}
+}
+
+func (b *fakeBackend) EmbedContent(ctx context.Context, model string, contents []*genai.Content) (*genai.EmbedContentResponse, error) {
+	return &genai.EmbedContentResponse{Embeddings: []*genai.ContentEmbedding{{Values: []float32{0.1, 0.2, 0.3}}}}, nil
+}
+
+func (b *fakeBackend) CountTokens(ctx context.Context, model string, contents []*genai.Content) (*genai.CountTokensResponse, error) {
+	var n int32
+	for _, c := range contents {
+		for _, p := range c.Parts {
+			n += int32(len(p.Text))
+		}
+	}
+	return &genai.CountTokensResponse{TotalTokens: n}, nil
+}
+
+func (b *fakeBackend) UploadFile(ctx context.Context, path string) (*genai.File, error) {
+	b.mu.Lock()
+	b.uploads++
+	b.mu.Unlock()
+	return &genai.File{Name: "files/" + path, URI: "https://fake/" + path, MIMEType: "image/png", State: genai.FileStateActive}, nil
+}
+
+func (b *fakeBackend) GetFile(ctx context.Context, name string) (*genai.File, error) {
+	return &genai.File{Name: name, State: genai.FileStateActive}, nil
+}
+
+func (b *fakeBackend) DeleteFile(ctx context.Context, name string) error {
+	return nil
+}
+
+func (b *fakeBackend) CreateCachedContent(ctx context.Context, model string, config *genai.CreateCachedContentConfig) (*genai.CachedContent, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.created++
+	if b.caches == nil {
+		b.caches = map[string]*genai.CachedContent{}
+	}
+	c := &genai.CachedContent{Name: fmt.Sprintf("cachedContents/%d", b.created), Model: model, ExpireTime: time.Now().Add(config.TTL)}
+	b.caches[c.Name] = c
+	return c, nil
+}
+
+func (b *fakeBackend) GetCachedContent(ctx context.Context, name string) (*genai.CachedContent, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.caches[name]
+	if !ok {
+		return nil, genai.APIError{Code: 404, Message: "not found"}
+	}
+	return c, nil
+}
+
+func (b *fakeBackend) GenerateImages(ctx context.Context, model string, prompt string, config *genai.GenerateImagesConfig) (*genai.GenerateImagesResponse, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, "generate:"+prompt)
+	n := min(max(int(config.NumberOfImages), 1), len(b.images))
+	return &genai.GenerateImagesResponse{GeneratedImages: b.images[:n]}, nil
+}
+
+func (b *fakeBackend) EditImage(ctx context.Context, model string, prompt string, refs []genai.ReferenceImage, config *genai.EditImageConfig) (*genai.EditImageResponse, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, "edit:"+prompt)
+	b.refs = refs
+	return &genai.EditImageResponse{GeneratedImages: b.images}, nil
+}
+
+func (b *fakeBackend) UpscaleImage(ctx context.Context, model string, image *genai.Image, factor string, config *genai.UpscaleImageConfig) (*genai.UpscaleImageResponse, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, "upscale:"+factor)
+	return &genai.UpscaleImageResponse{GeneratedImages: b.images[:1]}, nil
+}
+
+func (b *fakeBackend) GenerateVideos(ctx context.Context, model string, prompt string, image *genai.Image, config *genai.GenerateVideosConfig) (*genai.GenerateVideosOperation, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, "video:"+prompt)
+	b.frame = image
+	return &genai.GenerateVideosOperation{Name: "operations/video"}, nil
+}
+
+func (b *fakeBackend) GetVideosOperation(ctx context.Context, op *genai.GenerateVideosOperation) (*genai.GenerateVideosOperation, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls = append(b.calls, "poll:"+op.Name)
+	if b.pending > 0 {
+		b.pending--
+		return op, nil
+	}
+	return &genai.GenerateVideosOperation{Name: op.Name, Done: true,
+		Response: &genai.GenerateVideosResponse{GeneratedVideos: b.videos}}, nil
+}
+
+func (b *fakeBackend) DownloadVideo(ctx context.Context, video *genai.Video) ([]byte, error) {
+	return []byte("video from " + video.URI), nil
+}
+
+func TestNewBackend(t *testing.T) {
+	params := &core.Parameters{Backend: "openai", BaseURL: "http://localhost:1/v1"}
+	b, err := newBackend(context.Background(), params)
+	if err != nil {
+		t.Fatalf("newBackend failed: %v", err)
+	}
+	if b.Name() != "OpenAI" {
+		t.Errorf("expected OpenAI backend, got %s", b.Name())
+	}
+	if _, ok := core.As[core.FileStore](b); ok {
+		t.Errorf("expected no file service through the wrappers of the OpenAI backend")
+	}
+	if _, err := b.(core.FileStore).UploadFile(context.Background(), "a.png"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Errorf("expected unsupported upload forwarded, got %v", err)
+	}
+	wrapped := &ledgerBackend{Wrapper: core.Wrapper{Backend: &retryBackend{Wrapper: core.Wrapper{Backend: &fakeBackend{}}}}}
+	if v, ok := core.As[core.VideoGenerator](wrapped); !ok || v != core.VideoGenerator(wrapped) {
+		t.Errorf("expected video generation through the wrappers, got %v", v)
+	}
+	if _, ok := core.As[core.BatchRunner](wrapped); ok {
+		t.Errorf("expected no batch jobs without the wrapped backend running them")
+	}
+
+	params.Backend = "unknown"
+	if _, err := newBackend(context.Background(), params); err == nil {
+		t.Errorf("expected error for unknown backend")
+	}
+}
+
+func TestBackendFromContext(t *testing.T) {
+	fake := &fakeBackend{}
+	params := &core.Parameters{Client: fake}
+	ctx := context.WithValue(context.Background(), core.ParamsKey, params)
+	b, err := backendFromContext(ctx)
+	if err != nil || b != fake {
+		t.Errorf("expected stashed backend, got %v, %v", b, err)
+	}
+}
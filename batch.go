@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+// batchRequest is a single line of a batch file.
+type batchRequest struct {
+	ID     string            `json:"id,omitempty"`
+	Prompt string            `json:"prompt"`
+	Params map[string]string `json:"params,omitempty"` // same as -p
+	Files  []string          `json:"files,omitempty"`  // same as -f
+	Model  string            `json:"model,omitempty"`
+}
+
+// batchResult is written as a single line of output for each request.
+type batchResult struct {
+	ID            string                                      `json:"id"`
+	Model         string                                      `json:"model"`
+	Text          string                                      `json:"text,omitempty"`
+	FinishReason  genai.FinishReason                          `json:"finishReason,omitempty"`
+	UsageMetadata *genai.GenerateContentResponseUsageMetadata `json:"usageMetadata,omitempty"`
+	Error         string                                      `json:"error,omitempty"`
+}
+
+// readBatch parses a JSONL file of requests, - being stdin.
+func readBatch(path string, in io.Reader) ([]batchRequest, error) {
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+	var reqs []batchRequest
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+		var req batchRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			return nil, fmt.Errorf("batch line %d: %v", n, err)
+		}
+		if req.Prompt == "" {
+			return nil, fmt.Errorf("batch line %d: missing prompt", n)
+		}
+		if req.ID == "" {
+			req.ID = strconv.Itoa(n)
+		}
+		reqs = append(reqs, req)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return reqs, nil
+}
+
+// runBatch sends each request through a Generator using concurrent workers
+// and writes one JSON result per line as requests complete.
+func runBatch(ctx context.Context, in io.Reader, out io.Writer) error {
+	params, ok := ctx.Value(core.ParamsKey).(*core.Parameters)
+	if !ok {
+		return fmt.Errorf("missing params")
+	}
+	keyVals, ok := ctx.Value(core.KeyValsKey).(core.ParamMap)
+	if !ok {
+		return fmt.Errorf("missing keyVals")
+	}
+	reqs, err := readBatch(params.BatchPath, in)
+	if err != nil {
+		return err
+	}
+	client, err := backendFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	uploads := &uploadOnce{Wrapper: core.Wrapper{Backend: client}, files: map[string]*uploadCall{}}
+
+	// rate limit shared by all workers
+	var tick <-chan time.Time
+	if params.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / params.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failed := 0
+	jobs := make(chan batchRequest)
+	for range max(params.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range jobs {
+				res := runBatchRequest(ctx, params, keyVals, uploads, req)
+				line, err := json.Marshal(res)
+				mu.Lock()
+				if err == nil {
+					_, err = fmt.Fprintf(out, "%s\n", line)
+				}
+				if err != nil || res.Error != "" {
+					failed++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, req := range reqs {
+		if tick != nil {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- req
+	}
+	close(jobs)
+	wg.Wait()
+
+	params.FileURIs = append(params.FileURIs, uploads.uris()...) // for cleanup
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d batch requests failed", failed, len(reqs))
+	}
+	return nil
+}
+
+// runBatchRequest runs a single request through a Generator.
+func runBatchRequest(ctx context.Context, params *core.Parameters, keyVals core.ParamMap, client core.Backend, req batchRequest) batchResult {
+	ctx, p := batchContext(ctx, params, keyVals, client, req)
+	res := batchResult{ID: req.ID, Model: p.GenModel}
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	var buf strings.Builder
+	g, err := newGenerator(ctx, strings.NewReader(""), &buf)
+	if err == nil {
+		err = g.run()
+		res.FinishReason = g.finishReason
+		res.UsageMetadata = g.usage
+	}
+	res.Text = strings.TrimSpace(buf.String())
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// batchContext stores a copy of params and keyVals specific to req in ctx.
+func batchContext(ctx context.Context, params *core.Parameters, keyVals core.ParamMap, client core.Backend, req batchRequest) (context.Context, *core.Parameters) {
+	p := *params
+	p.Args = []string{req.Prompt}
+	p.BatchPath = ""
+	p.Client = client
+	p.FilePaths = append(slices.Clone(params.FilePaths), req.Files...)
+	p.FileURIs = nil
+	p.Interactive = true // nothing to read from stdin
+	p.OutRedirected = true
+	p.ToolRegistry = core.ToolMap{}
+	if req.Model != "" {
+		p.GenModel = req.Model
+	}
+	kv := core.ParamMap{}
+	for k, v := range keyVals {
+		kv[k] = v
+	}
+	for k, v := range req.Params {
+		kv[k] = v
+	}
+
+	ctx = context.WithValue(ctx, core.ParamsKey, &p)
+	ctx = context.WithValue(ctx, core.KeyValsKey, kv)
+	return ctx, &p
+}
+
+// uploadOnce shares uploads of the same file between batch requests.
+type uploadOnce struct {
+	core.Wrapper
+	mu    sync.Mutex
+	files map[string]*uploadCall
+}
+
+type uploadCall struct {
+	once sync.Once
+	file *genai.File
+	err  error
+}
+
+func (b *uploadOnce) UploadFile(ctx context.Context, path string) (*genai.File, error) {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		key = path
+	}
+	b.mu.Lock()
+	call, ok := b.files[key]
+	if !ok {
+		call = &uploadCall{}
+		b.files[key] = call
+	}
+	b.mu.Unlock()
+	call.once.Do(func() {
+		call.file, call.err = b.Wrapper.UploadFile(ctx, path)
+	})
+	return call.file, call.err
+}
+
+// uris lists the URIs of successful uploads.
+func (b *uploadOnce) uris() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var res []string
+	for _, call := range b.files {
+		if call.err == nil && call.file != nil {
+			res = append(res, call.file.URI)
+		}
+	}
+	return res
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jdevoo/gen/core"
+)
+
+func TestReadBatch(t *testing.T) {
+	testCases := []struct {
+		input   string
+		ids     []string
+		wantErr bool
+	}{
+		{`{"prompt":"a"}` + "\n\n" + `{"id":"x","prompt":"b","model":"m"}`, []string{"1", "x"}, false},
+		{`{"id":"x"}`, nil, true},
+		{`not json`, nil, true},
+	}
+	for _, tc := range testCases {
+		reqs, err := readBatch("-", strings.NewReader(tc.input))
+		if (err != nil) != tc.wantErr {
+			t.Errorf("readBatch(%q) error = %v, wantErr %v", tc.input, err, tc.wantErr)
+			continue
+		}
+		for i, req := range reqs {
+			if req.ID != tc.ids[i] {
+				t.Errorf("readBatch(%q) id %d = %s, want %s", tc.input, i, req.ID, tc.ids[i])
+			}
+		}
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	dir := t.TempDir()
+	img := filepath.Join(dir, "pic.png")
+	if err := os.WriteFile(img, []byte("\x89PNG\r\n\x1a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	for i := range 4 {
+		lines = append(lines, fmt.Sprintf(`{"id":"r%d","prompt":"describe {thing}","params":{"thing":"t%d"},"files":[%q]}`, i, i, img))
+	}
+	batch := filepath.Join(dir, "batch.jsonl")
+	if err := os.WriteFile(batch, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeBackend{}
+	for range 4 {
+		fake.replies = append(fake.replies, textReply("ok"))
+	}
+	ctx := prepareTestContext(t, true, "-batch", batch, "-workers", "3", "-rate", "1000")
+	params := ctx.Value(core.ParamsKey).(*core.Parameters)
+	params.Client = fake
+
+	var output strings.Builder
+	if err := runBatch(ctx, strings.NewReader(""), &output); err != nil {
+		t.Fatalf("runBatch failed: %v", err)
+	}
+
+	seen := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var res batchResult
+		if err := json.Unmarshal([]byte(line), &res); err != nil {
+			t.Fatalf("invalid result line %q: %v", line, err)
+		}
+		if res.Text != "ok" || res.FinishReason != "STOP" || res.UsageMetadata.TotalTokenCount != 5 {
+			t.Errorf("unexpected result: %+v", res)
+		}
+		seen[res.ID] = true
+	}
+	if len(seen) != 4 {
+		t.Errorf("expected 4 distinct results, got %v", seen)
+	}
+	if fake.uploads != 1 || len(params.FileURIs) != 1 {
+		t.Errorf("expected a single shared upload, got %d uploads and %v", fake.uploads, params.FileURIs)
+	}
+	prompts := map[string]bool{}
+	for _, c := range fake.contents {
+		prompts[c[0].Parts[0].Text] = true
+	}
+	if !prompts["describe t0"] || !prompts["describe t3"] {
+		t.Errorf("expected per-request params substitution, got %v", prompts)
+	}
+}
+
+func TestRunBatch_Errors(t *testing.T) {
+	fake := &fakeBackend{replies: []fakeReply{textReply("ok"), {err: fmt.Errorf("boom")}}}
+	ctx := prepareTestContext(t, true, "-batch", "-", "-workers", "1")
+	params := ctx.Value(core.ParamsKey).(*core.Parameters)
+	params.Client = fake
+
+	var output strings.Builder
+	err := runBatch(ctx, strings.NewReader(`{"prompt":"a"}`+"\n"+`{"prompt":"b","model":"other"}`), &output)
+	if err == nil || !strings.Contains(err.Error(), "1 of 2") {
+		t.Errorf("expected failure count, got %v", err)
+	}
+	AssertOutput(t, output.String(), OutputExpectations{
+		Contains: []string{`"error":"boom"`, `"model":"other"`},
+	})
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// TrimStrategies lists the ways an over budget chat history can be trimmed.
+var TrimStrategies = []string{"oldest", "thoughts", "summarize", "off"}
+
+// summaryPrompt asks the model to condense the oldest turns of a chat.
+const summaryPrompt = "Summarize the conversation above in a few paragraphs. Keep facts, decisions, names and open questions needed to carry on. Keep facts the user asked to remember, code snippets and file names or paths verbatim. Reply with the summary only."
+
+// SummaryKey is the part metadata key marking the turn which replaced
+// archived turns with their summary.
+const SummaryKey = "summary"
+
+// inputTokenLimit returns the input token limit of the model or 0 if unknown.
+func (g *Generator) inputTokenLimit() int32 {
+	if g.model == nil {
+		m, err := g.client.GetModel(g.ctx, g.params.GenModel)
+		if err != nil {
+			m = &genai.Model{}
+		}
+		g.model = m
+	}
+	return g.model.InputTokenLimit
+}
+
+// countTokens counts tokens of the system instruction and contents.
+func (g *Generator) countTokens(config *genai.GenerateContentConfig, contents []*genai.Content) (int32, error) {
+	if config.SystemInstruction != nil {
+		contents = append([]*genai.Content{{Role: "user", Parts: config.SystemInstruction.Parts}}, contents...)
+	}
+	resp, err := g.client.CountTokens(g.ctx, g.params.GenModel, withoutMetadata(contents))
+	if err != nil {
+		return 0, err
+	}
+	return resp.TotalTokens, nil
+}
+
+// fitBudget trims history until history and turn fit the input token limit
+// of the model according to the trim strategy. Strategies other than oldest
+// fall back to dropping the oldest turns when they do not free enough tokens.
+func (g *Generator) fitBudget(history []*genai.Content, turn *genai.Content, config *genai.GenerateContentConfig) ([]*genai.Content, error) {
+	if g.params.Trim == "off" && g.params.Compact == 0 || len(history) == 0 {
+		return history, nil
+	}
+	limit := g.inputTokenLimit()
+	if limit == 0 {
+		return history, nil
+	}
+	if g.params.Compact > 0 {
+		history = g.compact(history, turn, config, limit)
+	}
+	if g.params.Trim == "off" {
+		return history, nil
+	}
+	over := func() (bool, error) {
+		n, err := g.countTokens(config, append(slices.Clone(history), turn))
+		if err != nil {
+			return false, err
+		}
+		return n > limit, nil
+	}
+	ok, err := over()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "counting tokens: %v, history not trimmed\n", err)
+		return history, nil // no guard without token count
+	}
+	if !ok {
+		return history, nil
+	}
+
+	var notes []string
+	switch g.params.Trim {
+	case "thoughts":
+		var n int
+		history, n = dropThoughts(history)
+		if n > 0 {
+			notes = append(notes, fmt.Sprintf("dropped %d thought parts", n))
+		}
+	case "summarize":
+		var n int
+		history, n, err = g.summarizeOldest(history)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v, dropping turns instead\n", err)
+		}
+		if n > 0 {
+			notes = append(notes, fmt.Sprintf("summarized %d oldest turns", n))
+		}
+	}
+
+	dropped := 0
+	for {
+		if ok, err = over(); err != nil || !ok || len(history) == 0 {
+			break
+		}
+		var n int
+		history, n = g.dropOldest(history)
+		dropped += n
+	}
+	if err != nil {
+		return nil, err
+	}
+	if dropped > 0 {
+		notes = append(notes, fmt.Sprintf("dropped %d oldest turns", dropped))
+	}
+	if len(notes) > 0 {
+		fmt.Fprintf(os.Stderr, infos("history over %d token limit: %s\n"), limit, strings.Join(notes, ", "))
+	}
+	if ok {
+		return nil, fmt.Errorf("prompt exceeds %d token limit", limit)
+	}
+	return history, nil
+}
+
+// dropOldest moves the oldest turn following the summary, if any, to
+// g.archive along with function responses which would be left without their
+// call, and returns how many turns went. The summary goes last, its turns
+// being archived already.
+func (g *Generator) dropOldest(history []*genai.Content) ([]*genai.Content, int) {
+	start := 0
+	if len(history) > 2 && isSummary(history[0]) {
+		start = 2
+	}
+	n := 0
+	for len(history) > start {
+		end := min(start+2, len(history))
+		if !isSummary(history[start]) {
+			g.archive = append(g.archive, history[start:end]...)
+		}
+		history = append(history[:start:start], history[end:]...)
+		n++
+		if len(history) == start || !slices.ContainsFunc(history[start].Parts, func(p *genai.Part) bool {
+			return p.FunctionResponse != nil
+		}) {
+			break
+		}
+	}
+	return history, n
+}
+
+// dropThoughts removes thought parts from model turns.
+func dropThoughts(history []*genai.Content) ([]*genai.Content, int) {
+	n := 0
+	trimmed := make([]*genai.Content, len(history))
+	for i, c := range history {
+		parts := slices.DeleteFunc(slices.Clone(c.Parts), func(p *genai.Part) bool { return p.Thought })
+		n += len(c.Parts) - len(parts)
+		if len(parts) == 0 {
+			parts = []*genai.Part{{Text: " "}}
+		}
+		trimmed[i] = &genai.Content{Role: c.Role, Parts: parts}
+	}
+	return trimmed, n
+}
+
+// compact summarizes the oldest turns once history and turn pass the
+// -compact fraction of the input token limit. Failures are reported and
+// leave history as is.
+func (g *Generator) compact(history []*genai.Content, turn *genai.Content, config *genai.GenerateContentConfig, limit int32) []*genai.Content {
+	n, err := g.countTokens(config, append(slices.Clone(history), turn))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "counting tokens: %v, history not compacted\n", err)
+		return history
+	}
+	if float64(n) <= g.params.Compact*float64(limit) {
+		return history
+	}
+	compacted, k, err := g.summarizeOldest(history)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v, history not compacted\n", err)
+		return history
+	}
+	if k > 0 {
+		fmt.Fprintf(os.Stderr, infos("history over %g%% of %d token limit: compacted %d oldest turns\n"),
+			g.params.Compact*100, limit, k)
+	}
+	return compacted
+}
+
+// isSummary reports whether c is the summary of archived turns.
+func isSummary(c *genai.Content) bool {
+	return c.Role == "user" && len(c.Parts) > 0 && c.Parts[0].PartMetadata[SummaryKey] != nil
+}
+
+// summarizeOldest replaces the oldest half of the turns with a summary
+// keeping their file references, moves them to g.archive and returns how
+// many turns were summarized. A previous summary is summarized again.
+func (g *Generator) summarizeOldest(history []*genai.Content) ([]*genai.Content, int, error) {
+	start := 0
+	if len(history) > 0 && isSummary(history[0]) {
+		start = 2
+	}
+	ts := turns(history[start:])
+	k := len(ts) / 2
+	if k == 0 {
+		return history, 0, nil
+	}
+	half := start + ts[k]
+	contents, _ := dropThoughts(withoutMetadata(history[:half]))
+	contents = append(contents, &genai.Content{Role: "user", Parts: []*genai.Part{{Text: summaryPrompt}}})
+	resp, err := g.client.GenerateContent(g.ctx, g.params.GenModel, contents, nil)
+	if err != nil {
+		return history, 0, fmt.Errorf("summarizing history: %v", err)
+	}
+	summary := strings.TrimSpace(resp.Text())
+	if summary == "" {
+		return history, 0, fmt.Errorf("summarizing history: empty summary")
+	}
+	g.usage = addUsage(g.usage, resp.UsageMetadata)
+	parts := []*genai.Part{{
+		Text:         "Summary of our conversation so far:\n\n" + summary,
+		PartMetadata: map[string]any{SummaryKey: true},
+	}}
+	uris := map[string]bool{}
+	for _, c := range history[:half] {
+		for _, p := range c.Parts {
+			if p.FileData != nil && !uris[p.FileData.FileURI] {
+				uris[p.FileData.FileURI] = true
+				parts = append(parts, &genai.Part{FileData: p.FileData})
+			}
+		}
+	}
+	g.archive = append(g.archive, history[start:half]...)
+	return append([]*genai.Content{
+		{Role: "user", Parts: parts},
+		{Role: "model", Parts: []*genai.Part{{Text: "Understood."}}},
+	}, history[half:]...), k, nil
+}
+
+// restoreArchive puts the archived turns back in place of their summary,
+// if any.
+func (g *Generator) restoreArchive(history []*genai.Content) ([]*genai.Content, int) {
+	if len(g.archive) == 0 {
+		return history, 0
+	}
+	n := len(turns(g.archive))
+	history = slices.Concat(g.archive, withoutSummary(history))
+	g.archive = nil
+	return history, n
+}
+
+// withoutSummary returns history without its leading summary turn.
+func withoutSummary(history []*genai.Content) []*genai.Content {
+	if len(history) >= 2 && isSummary(history[0]) {
+		return history[2:]
+	}
+	return history
+}
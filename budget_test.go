@@ -0,0 +1,187 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+func TestFitBudget(t *testing.T) {
+	history := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{Text: strings.Repeat("first question ", 4)}}},
+		{Role: "model", Parts: []*genai.Part{{Text: strings.Repeat("x", 30), Thought: true}, {Text: "answer one"}}},
+		{Role: "user", Parts: []*genai.Part{{Text: "second q"}}},
+		{Role: "model", Parts: []*genai.Part{{Text: strings.Repeat("y", 30), Thought: true}, {Text: "answer two"}}},
+	}
+	turn := &genai.Content{Role: "user", Parts: []*genai.Part{{Text: "third"}}}
+
+	testCases := []struct {
+		trim    string
+		limit   int32
+		turns   int
+		first   string
+		wantErr bool
+	}{
+		{"oldest", 120, 1, "second q", false},
+		{"thoughts", 120, 2, "first question", false},
+		{"summarize", 120, 2, "Summary of our conversation", false},
+		{"off", 120, 2, "first question", false},
+		{"oldest", 200, 2, "first question", false},
+		{"oldest", 4, 0, "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.trim, func(t *testing.T) {
+			fake := &fakeBackend{
+				model:   &genai.Model{InputTokenLimit: tc.limit},
+				replies: []fakeReply{textReply("sum")},
+			}
+			ctx := prepareTestContext(t, true, "-c", "-trim", tc.trim)
+			ctx.Value(core.ParamsKey).(*core.Parameters).Client = fake
+			g, err := newGenerator(ctx, strings.NewReader(""), &strings.Builder{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := g.fitBudget(history, turn, &genai.GenerateContentConfig{})
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if tc.wantErr {
+				return
+			}
+			if len(got) != 2*tc.turns || !strings.HasPrefix(got[0].Parts[0].Text, tc.first) {
+				t.Fatalf("expected %d turns starting with %q, got %d", tc.turns, tc.first, len(got)/2)
+			}
+			thoughts := 0
+			for _, c := range got {
+				for _, p := range c.Parts {
+					if p.Thought {
+						thoughts++
+					}
+				}
+			}
+			if tc.trim == "thoughts" && thoughts > 0 {
+				t.Errorf("expected thoughts to be dropped, got %d", thoughts)
+			}
+		})
+	}
+}
+
+func TestDropOldest(t *testing.T) {
+	history := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{Text: "weather?"}}},
+		{Role: "model", Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{Name: "Weather"}}}},
+		{Role: "user", Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{Name: "Weather"}}}},
+		{Role: "model", Parts: []*genai.Part{{Text: "sunny"}}},
+		{Role: "user", Parts: []*genai.Part{{Text: "thanks"}}},
+		{Role: "model", Parts: []*genai.Part{{Text: "welcome"}}},
+	}
+	g := &Generator{}
+	got, n := g.dropOldest(history)
+	if n != 2 || len(got) != 2 || got[0].Parts[0].Text != "thanks" || len(g.archive) != 4 {
+		t.Errorf("expected function response to go with its call, got %d turns left after dropping %d", len(got)/2, n)
+	}
+
+	// the summary stays while other turns remain
+	summary := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{Text: "summary", PartMetadata: map[string]any{SummaryKey: true}}}},
+		{Role: "model", Parts: []*genai.Part{{Text: "Understood."}}},
+	}
+	got, _ = g.dropOldest(slices.Concat(summary, got))
+	if len(got) != 2 || !isSummary(got[0]) || len(g.archive) != 6 {
+		t.Errorf("expected summary kept and turn archived, got %d contents and %d archived", len(got), len(g.archive))
+	}
+	got, _ = g.dropOldest(got)
+	if len(got) != 0 || len(g.archive) != 6 {
+		t.Errorf("expected summary dropped without archiving, got %d contents and %d archived", len(got), len(g.archive))
+	}
+	if got, n = g.restoreArchive(got); n != 2 || got[0] != history[0] || got[5] != history[5] {
+		t.Errorf("expected dropped turns restored, got %d", n)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	var history []*genai.Content
+	for _, q := range []string{"one", "two", "three", "four"} {
+		history = append(history,
+			&genai.Content{Role: "user", Parts: []*genai.Part{{Text: "question " + q}}},
+			&genai.Content{Role: "model", Parts: []*genai.Part{{Text: "answer " + q}}})
+	}
+	history[0].Parts = append(history[0].Parts, &genai.Part{FileData: &genai.FileData{FileURI: "https://fake/a.pdf"}})
+	original := slices.Clone(history)
+	turn := &genai.Content{Role: "user", Parts: []*genai.Part{{Text: "five"}}}
+
+	fake := &fakeBackend{
+		model:   &genai.Model{InputTokenLimit: 150},
+		replies: []fakeReply{textReply("sum"), textReply("sum again")},
+	}
+	ctx := prepareTestContext(t, true, "-c", "-compact", "0.5", "-trim", "off")
+	ctx.Value(core.ParamsKey).(*core.Parameters).Client = fake
+	g, err := newGenerator(ctx, strings.NewReader(""), &strings.Builder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := g.fitBudget(history[:2], turn, &genai.GenerateContentConfig{}); len(got) != 2 || len(fake.contents) > 0 {
+		t.Errorf("expected no compaction under the fraction, got %d contents", len(got))
+	}
+	got, err := g.fitBudget(history, turn, &genai.GenerateContentConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 6 || !isSummary(got[0]) || len(got[0].Parts) != 2 || got[0].Parts[1].FileData == nil ||
+		got[2].Parts[0].Text != "question three" || len(g.archive) != 4 {
+		t.Fatalf("expected two turns compacted keeping the file, got %d contents and %d archived", len(got), len(g.archive))
+	}
+	if sent := fake.contents[0]; sent[len(sent)-1].Parts[0].Text != summaryPrompt {
+		t.Errorf("expected summary prompt, got %+v", sent[len(sent)-1])
+	}
+
+	// a second compaction summarizes the summary and archives the next turn
+	got, err = g.fitBudget(got, turn, &genai.GenerateContentConfig{})
+	if err != nil || len(got) != 4 || len(g.archive) != 6 || !strings.Contains(got[0].Parts[0].Text, "sum again") {
+		t.Fatalf("unexpected second compaction to %d contents, %v", len(got), err)
+	}
+	got, n := g.restoreArchive(got)
+	if n != 3 || len(g.archive) != 0 || len(got) != len(original) {
+		t.Fatalf("expected 3 turns restored, got %d", n)
+	}
+	for i, c := range got {
+		if c != original[i] {
+			t.Errorf("content %d not restored, got %+v", i, c)
+		}
+	}
+}
+
+func TestSummarizeOldest(t *testing.T) {
+	history := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{Text: "hi"}}},
+		{Role: "model", Parts: []*genai.Part{{Text: "hello"}}},
+		{Role: "user", Parts: []*genai.Part{{Text: "weather?"}}},
+		{Role: "model", Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{Name: "Weather"}}}},
+		{Role: "user", Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{Name: "Weather"}}}},
+		{Role: "model", Parts: []*genai.Part{{Text: "sunny"}}},
+		{Role: "user", Parts: []*genai.Part{{Text: "thanks"}}},
+		{Role: "model", Parts: []*genai.Part{{Text: "welcome"}}},
+	}
+	fake := &fakeBackend{
+		model:   &genai.Model{InputTokenLimit: 100},
+		replies: []fakeReply{{err: genai.APIError{Code: 500}}, textReply("sum")},
+	}
+	ctx := prepareTestContext(t, true, "-c", "-compact", "0.1", "-trim", "off")
+	ctx.Value(core.ParamsKey).(*core.Parameters).Client = fake
+	g, err := newGenerator(ctx, strings.NewReader(""), &strings.Builder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	turn := &genai.Content{Role: "user", Parts: []*genai.Part{{Text: "bye"}}}
+	got, err := g.fitBudget(history, turn, &genai.GenerateContentConfig{})
+	if err != nil || len(got) != len(history) || len(g.archive) != 0 {
+		t.Fatalf("expected history kept when summarizing fails, got %d contents, %v", len(got), err)
+	}
+	got, n, err := g.summarizeOldest(history)
+	if err != nil || n != 1 || len(got) != 8 || got[2] != history[2] || len(g.archive) != 2 {
+		t.Errorf("expected first of three turns summarized, got %d of %d contents, %v", n, len(got), err)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+const (
+	CachesFile  = "caches.json" // name of cached contents file in DotGenDir
+	cachePrefix = "gen-cache:"  // URI prefix of files not uploaded yet
+)
+
+// cachesMu serializes access to the caches file e.g. from batch workers.
+var cachesMu sync.Mutex
+
+// cacheRecord remembers a cached content created for a given content hash.
+type cacheRecord struct {
+	Name       string    `json:"name"`
+	Model      string    `json:"model"`
+	ExpireTime time.Time `json:"expireTime"`
+}
+
+func loadCaches() (map[string]cacheRecord, error) {
+	dir, err := genDir()
+	if err != nil {
+		return nil, err
+	}
+	caches := map[string]cacheRecord{}
+	data, err := os.ReadFile(filepath.Join(dir, CachesFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return caches, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &caches); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", CachesFile, err)
+	}
+	return caches, nil
+}
+
+// saveCache stores rec under key and prunes expired records.
+func saveCache(key string, rec cacheRecord) error {
+	cachesMu.Lock()
+	defer cachesMu.Unlock()
+	caches, err := loadCaches()
+	if err != nil {
+		return err
+	}
+	for k, r := range caches {
+		if r.ExpireTime.Before(time.Now()) {
+			delete(caches, k)
+		}
+	}
+	caches[key] = rec
+	dir, err := genDir()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(caches, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, CachesFile), data, 0600)
+}
+
+// cacheKey hashes model and content of a cache.
+func cacheKey(model string, parts, sysParts []*genai.Part) (string, error) {
+	data, err := json.Marshal(struct {
+		Model    string        `json:"model"`
+		Parts    []*genai.Part `json:"parts"`
+		SysParts []*genai.Part `json:"sysParts"`
+	}{model, parts, sysParts})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// deferredUploads hands out placeholders named after the file content
+// instead of uploading so that cache keys are stable across runs.
+type deferredUploads struct {
+	core.Wrapper
+	paths map[string]string // placeholder URI to file path
+}
+
+func (b *deferredUploads) UploadFile(ctx context.Context, path string) (*genai.File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	uri := cachePrefix + hex.EncodeToString(sum[:])
+	b.paths[uri] = path
+	return &genai.File{Name: uri, URI: uri, MIMEType: inlineMIMEType(path, data), State: genai.FileStateActive}, nil
+}
+
+// resolveUploads replaces placeholders with uploaded files or inline data.
+func (g *Generator) resolveUploads(parts []*genai.Part) error {
+	for _, p := range parts {
+		if p.FileData == nil || !strings.HasPrefix(p.FileData.FileURI, cachePrefix) {
+			continue
+		}
+		path := g.uploads.paths[p.FileData.FileURI]
+		file, err := uploadFile(g.ctx, g.client, path)
+		if errors.Is(err, errors.ErrUnsupported) {
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			data, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("reading file %s: %v", path, err)
+			}
+			p.InlineData = &genai.Blob{Data: data, MIMEType: inlineMIMEType(path, data)}
+			p.FileData = nil
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		p.FileData = &genai.FileData{FileURI: file.URI, MIMEType: strings.Split(file.MIMEType, ";")[0]}
+		g.params.FileURIs = append(g.params.FileURIs, file.URI)
+	}
+	return nil
+}
+
+// cacheContent moves attached parts and system instruction into a cached
+// content and returns its name. A cache with the same content is reused
+// until it expires, in which case it is created again.
+func (g *Generator) cacheContent() (string, error) {
+	var kept, attached []*genai.Part
+	for _, p := range g.parts {
+		if slices.Contains(g.prompts, p) {
+			kept = append(kept, p)
+		} else {
+			attached = append(attached, p)
+		}
+	}
+	if len(kept) == 0 && len(attached) > 0 && !g.params.ChatMode {
+		// something has to be sent
+		kept = attached[len(attached)-1:]
+		attached = attached[:len(attached)-1]
+	}
+	if len(attached) == 0 && len(g.sysParts) == 0 || partWithKey(g.sysParts, DigestKey) != -1 {
+		return "", g.resolveUploads(g.parts)
+	}
+	cacher, ok := core.As[core.Cacher](g.client)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "caching skipped: %v\n", core.Unsupported(g.client, "context caching"))
+		return "", g.resolveUploads(g.parts)
+	}
+
+	key, err := cacheKey(g.params.GenModel, attached, g.sysParts)
+	if err != nil {
+		return "", err
+	}
+	cachesMu.Lock()
+	caches, err := loadCaches()
+	cachesMu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	if rec, ok := caches[key]; ok && time.Until(rec.ExpireTime) > time.Minute {
+		c, err := cacher.GetCachedContent(g.ctx, rec.Name)
+		if err == nil && time.Until(c.ExpireTime) > time.Minute {
+			if g.params.Verbose {
+				fmt.Fprintf(os.Stderr, infos("%s reused until %s\n"), c.Name, c.ExpireTime.Local().Format(time.DateTime))
+			}
+			g.cachedParts, g.cachedSys = attached, g.sysParts
+			g.cachedKey, g.cachedUntil = key, c.ExpireTime
+			g.parts, g.sysParts = kept, nil
+			return c.Name, g.resolveUploads(g.parts)
+		}
+	}
+
+	if err := g.resolveUploads(attached); err != nil {
+		return "", err
+	}
+	c, err := g.createCache(cacher, key, attached, g.sysParts)
+	if err != nil {
+		// e.g. content below the minimum size, carry on without cache
+		fmt.Fprintf(os.Stderr, "caching skipped: %v\n", err)
+		return "", g.resolveUploads(kept)
+	}
+	g.cachedParts, g.cachedSys = attached, g.sysParts
+	g.cachedKey, g.cachedUntil = key, c.ExpireTime
+	g.parts, g.sysParts = kept, nil
+	if err := g.resolveUploads(g.parts); err != nil {
+		return "", err
+	}
+	return c.Name, nil
+}
+
+// createCache creates the cached content of attached parts and system
+// instruction sysParts and remembers it under key.
+func (g *Generator) createCache(cacher core.Cacher, key string, attached, sysParts []*genai.Part) (*genai.CachedContent, error) {
+	config := &genai.CreateCachedContentConfig{TTL: g.params.CacheTTL}
+	if len(attached) > 0 {
+		config.Contents = []*genai.Content{{Role: "user", Parts: attached}}
+	}
+	if len(sysParts) > 0 {
+		config.SystemInstruction = &genai.Content{Parts: sysParts}
+	}
+	c, err := cacher.CreateCachedContent(g.ctx, g.params.GenModel, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveCache(key, cacheRecord{Name: c.Name, Model: g.params.GenModel, ExpireTime: c.ExpireTime}); err != nil {
+		return nil, err
+	}
+	if g.params.Verbose {
+		fmt.Fprintf(os.Stderr, infos("%s created until %s\n"), c.Name, c.ExpireTime.Local().Format(time.DateTime))
+	}
+	return c, nil
+}
+
+// renewCache creates the cached content of a chat again when it is about
+// to expire. Should that fail, the content goes with the next turn instead.
+func (g *Generator) renewCache(config *genai.GenerateContentConfig) error {
+	if config.CachedContent == "" || time.Until(g.cachedUntil) > time.Minute {
+		return nil
+	}
+	if err := g.resolveUploads(g.cachedParts); err != nil {
+		return err
+	}
+	if cacher, ok := core.As[core.Cacher](g.client); ok {
+		c, err := g.createCache(cacher, g.cachedKey, g.cachedParts, g.cachedSys)
+		if err == nil {
+			config.CachedContent, g.cachedUntil = c.Name, c.ExpireTime
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "caching skipped: %v\n", err)
+	}
+	g.attached = slices.Concat(g.cachedParts, g.attached)
+	g.sysParts = slices.Concat(g.cachedSys, g.sysParts)
+	if len(g.sysParts) > 0 {
+		config.SystemInstruction = &genai.Content{Parts: g.sysParts}
+	}
+	config.CachedContent = ""
+	g.cachedParts, g.cachedSys = nil, nil
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+func TestGenContent_Cache(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	img := filepath.Join(dir, "pic.png")
+	if err := os.WriteFile(img, []byte("\x89PNG\r\n\x1a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	notes := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notes, []byte("long notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeBackend{}
+	run := func() string {
+		fake.replies = append(fake.replies, textReply("answer"))
+		ctx := prepareTestContext(t, true, "-cache", "1h", "-f", img, "-f", notes, "what is in there?")
+		params := ctx.Value(core.ParamsKey).(*core.Parameters)
+		params.Client = fake
+		params.OutRedirected = true
+		var output strings.Builder
+		if err := genContent(ctx, strings.NewReader(""), &output); err != nil {
+			t.Fatalf("genContent failed: %v", err)
+		}
+		last := len(fake.contents) - 1
+		parts := fake.contents[last][0].Parts
+		if len(parts) != 1 || parts[0].Text != "what is in there?" {
+			t.Errorf("expected only the prompt to be sent, got %+v", parts)
+		}
+		return fake.configs[last].CachedContent
+	}
+
+	first := run()
+	if first == "" || fake.created != 1 || fake.uploads != 1 {
+		t.Fatalf("expected cache creation, got %q with %d caches and %d uploads", first, fake.created, fake.uploads)
+	}
+	if second := run(); second != first || fake.created != 1 || fake.uploads != 1 {
+		t.Errorf("expected cache reuse without upload, got %q with %d caches and %d uploads", second, fake.created, fake.uploads)
+	}
+
+	fake.caches[first].ExpireTime = time.Now()
+	if third := run(); third == first || fake.created != 2 {
+		t.Errorf("expected expired cache to be recreated, got %q", third)
+	}
+}
+
+func TestGenContent_CacheKeepsUpload(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	img := filepath.Join(dir, "pic.png")
+	if err := os.WriteFile(img, []byte("\x89PNG\r\n\x1a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	notes := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notes, []byte("long notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := &fakeBackend{}
+	for range 2 { // created then reused
+		fake.replies = append(fake.replies, textReply("answer"))
+		ctx := prepareTestContext(t, true, "-cache", "1h", "-f", notes, "-f", img)
+		params := ctx.Value(core.ParamsKey).(*core.Parameters)
+		params.Client = fake
+		params.OutRedirected = true
+		if err := genContent(ctx, strings.NewReader(""), &strings.Builder{}); err != nil {
+			t.Fatalf("genContent failed: %v", err)
+		}
+		parts := fake.contents[len(fake.contents)-1][0].Parts
+		if len(parts) != 1 || parts[0].FileData == nil || strings.HasPrefix(parts[0].FileData.FileURI, cachePrefix) {
+			t.Errorf("expected the image kept out of the cache to be uploaded, got %+v", parts[0])
+		}
+	}
+	if fake.created != 1 {
+		t.Errorf("expected cache reuse, got %d caches", fake.created)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	a, _ := cacheKey("m", []*genai.Part{{Text: "x"}}, nil)
+	b, _ := cacheKey("m", []*genai.Part{{Text: "x"}}, nil)
+	c, _ := cacheKey("n", []*genai.Part{{Text: "x"}}, nil)
+	d, _ := cacheKey("m", nil, []*genai.Part{{Text: "x"}})
+	if a != b || a == c || a == d {
+		t.Errorf("unexpected keys %s %s %s %s", a, b, c, d)
+	}
+}
+
+// slowReader delays its first read, as a user taking time to type.
+type slowReader struct {
+	r     io.Reader
+	delay time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	r.delay = 0
+	return r.r.Read(p)
+}
+
+func TestGenContent_CacheRenewedInChat(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	os.WriteFile("notes.txt", []byte("long notes"), 0644)
+	fake := &fakeBackend{replies: []fakeReply{textReply("first"), textReply("second")}}
+	ctx := prepareTestContext(t, true, "-c", "-cache", "300ms", "-f", "notes.txt", "hello")
+	params := ctx.Value(core.ParamsKey).(*core.Parameters)
+	params.Client = fake
+	params.OutRedirected = true
+
+	// the cache expires before the second prompt is sent
+	input := &slowReader{r: strings.NewReader("next\n/exit\n"), delay: 500 * time.Millisecond}
+	var output strings.Builder
+	if err := genContent(ctx, input, &output); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.configs) != 2 || fake.created != 2 {
+		t.Fatalf("expected cache created again for the second turn, got %d turns and %d caches", len(fake.configs), fake.created)
+	}
+	if name := fake.configs[1].CachedContent; name != "cachedContents/2" {
+		t.Errorf("expected second turn on the new cache, got %q", name)
+	}
+	second := fake.contents[1][len(fake.contents[1])-1]
+	if text := contentText(second); text != "next" {
+		t.Errorf("expected only the prompt sent, got %q", text)
+	}
+}
+
+// TestResolveUploads_Inline checks placeholders fall back to inline data typed by extension.
+func TestResolveUploads_Inline(t *testing.T) {
+	pdf := filepath.Join(t.TempDir(), "notes.pdf")
+	if err := os.WriteFile(pdf, []byte("plain text, not a PDF header"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	client := newOpenAIBackend("http://localhost/v1", "")
+	uploads := &deferredUploads{Wrapper: core.Wrapper{Backend: client}, paths: map[string]string{}}
+	file, err := uploads.UploadFile(t.Context(), pdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := []*genai.Part{{FileData: &genai.FileData{FileURI: file.URI, MIMEType: file.MIMEType}}}
+	g := &Generator{ctx: t.Context(), client: client, uploads: uploads, params: &core.Parameters{}}
+	if err := g.resolveUploads(parts); err != nil {
+		t.Fatalf("resolveUploads: %v", err)
+	}
+	if parts[0].InlineData == nil || parts[0].InlineData.MIMEType != "application/pdf" {
+		t.Errorf("expected inline application/pdf, got %+v", parts[0])
+	}
+}
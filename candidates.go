@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+	"google.golang.org/genai"
+)
+
+// generateCandidates sends the pending parts asking for several candidates,
+// emits all of them and appends the chosen one to history. In chat mode the
+// user picks the candidate with editor, otherwise the first one is kept.
+func (g *Generator) generateCandidates(history []*genai.Content, config *genai.GenerateContentConfig, editor *lineEditor) ([]*genai.Content, error) {
+	turn := &genai.Content{Role: "user", Parts: g.parts}
+	g.parts = []*genai.Part{}
+	history, err := g.fitBudget(history, turn, config)
+	if err != nil {
+		return nil, err
+	}
+	config.CandidateCount = int32(g.params.Candidates)
+	contents := append(withoutMetadata(history), turn)
+	resp, answered, err := g.generateWithFallback(contents, config)
+	if err != nil {
+		return nil, err
+	}
+	g.usage = addUsage(g.usage, resp.UsageMetadata)
+	if g.params.CountTokens && resp.UsageMetadata != nil {
+		TokenCount.Store(resp.UsageMetadata.TotalTokenCount)
+	}
+	if len(resp.Candidates) == 0 {
+		return nil, fmt.Errorf("no candidates returned")
+	}
+
+	if g.params.JSON {
+		if err := emitCandidatesJSON(g.out, resp.Candidates); err != nil {
+			return nil, err
+		}
+	} else {
+		for n, cand := range resp.Candidates {
+			if n > 0 {
+				fmt.Fprintln(g.out)
+			}
+			if g.params.OutRedirected {
+				fmt.Fprintf(g.out, "Candidate %d\n", n+1)
+			} else {
+				fmt.Fprintf(g.out, important("Candidate %d")+"\n", n+1)
+			}
+			i := 0
+			mp := &MarkdownParser{}
+			if err := emitCandidate(g.out, cand, g.params.OutRedirected, g.params.ImgModality, g.params.Verbose, &i, mp, g.params.OutPath); err != nil {
+				return nil, err
+			}
+			fmt.Fprint(g.out, mp.flush(g.params.OutRedirected))
+		}
+	}
+
+	chosen := resp.Candidates[0]
+	if g.params.ChatMode && len(resp.Candidates) > 1 {
+		n, err := pickCandidate(g.out, editor, len(resp.Candidates))
+		if err != nil {
+			return nil, err
+		}
+		chosen = resp.Candidates[n-1]
+	}
+	g.finishReason = chosen.FinishReason
+
+	var parts []*genai.Part
+	if chosen.Content != nil {
+		for _, p := range chosen.Content.Parts {
+			if isValidPart(p) {
+				parts = append(parts, p)
+			}
+		}
+	}
+	if len(parts) == 0 {
+		parts = []*genai.Part{{Text: " "}}
+	}
+	parts[0].PartMetadata = map[string]any{ModelKey: answered}
+	return append(history, turn, &genai.Content{Role: "model", Parts: parts}), nil
+}
+
+// pickCandidate asks which of n candidates to keep, the first one by default.
+func pickCandidate(out io.Writer, editor *lineEditor, n int) (int, error) {
+	for {
+		fmt.Fprintf(out, important("keep candidate [1-%d]: "), n)
+		input, err := editor.readLine()
+		if errors.Is(err, io.EOF) {
+			return 1, nil
+		}
+		if err != nil && !errors.Is(err, term.ErrPasteIndicator) {
+			return 0, err
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			return 1, nil
+		}
+		if k, err := strconv.Atoi(input); err == nil && k >= 1 && k <= n {
+			return k, nil
+		}
+		fmt.Fprintf(os.Stderr, "expecting a number between 1 and %d\n", n)
+	}
+}
+
+// emitCandidatesJSON writes the text of all candidates as a JSON array.
+// Text which is not valid JSON is emitted as a string.
+func emitCandidatesJSON(out io.Writer, cands []*genai.Candidate) error {
+	var arr []json.RawMessage
+	for _, cand := range cands {
+		var sb strings.Builder
+		if cand.Content != nil {
+			for _, p := range cand.Content.Parts {
+				if !p.Thought {
+					sb.WriteString(p.Text)
+				}
+			}
+		}
+		text := strings.TrimSpace(sb.String())
+		if json.Valid([]byte(text)) {
+			arr = append(arr, json.RawMessage(text))
+			continue
+		}
+		data, err := json.Marshal(text)
+		if err != nil {
+			return err
+		}
+		arr = append(arr, data)
+	}
+	data, err := json.MarshalIndent(arr, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "%s\n", data)
+	return err
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+// candidatesReply builds a reply holding one candidate per text.
+func candidatesReply(texts ...string) fakeReply {
+	resp := &genai.GenerateContentResponse{}
+	for i, text := range texts {
+		resp.Candidates = append(resp.Candidates, &genai.Candidate{
+			Index:        int32(i),
+			Content:      &genai.Content{Role: "model", Parts: []*genai.Part{{Text: text}}},
+			FinishReason: genai.FinishReasonStop,
+		})
+	}
+	return fakeReply{chunks: []*genai.GenerateContentResponse{resp}}
+}
+
+func TestGenContent_Candidates(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		reply    fakeReply
+		input    string
+		contains []string
+		history  string
+	}{
+		{
+			name:     "labeled",
+			args:     []string{"-n", "2", "draft a brief"},
+			reply:    candidatesReply("first draft", "second draft"),
+			contains: []string{"Candidate 1\nfirst draft", "Candidate 2\nsecond draft"},
+		},
+		{
+			name:     "json array",
+			args:     []string{"-n", "2", "-json", "list colors"},
+			reply:    candidatesReply(`{"colors":["red"]}`, "not json"),
+			contains: []string{"[\n  {\n    \"colors\": [\n      \"red\"\n    ]\n  },\n  \"not json\"\n]"},
+		},
+		{
+			name:     "chat pick",
+			args:     []string{"-n", "3", "-c", "name a fruit"},
+			reply:    candidatesReply("apple", "pear", "plum"),
+			input:    "x\n2\n\n\n",
+			contains: []string{"Candidate 3\nplum", "keep candidate [1-3]"},
+			history:  "pear",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			fake := &fakeBackend{replies: []fakeReply{tc.reply}}
+			ctx := prepareTestContext(t, true, tc.args...)
+			params := ctx.Value(core.ParamsKey).(*core.Parameters)
+			params.Client = fake
+			params.OutRedirected = true
+			var output strings.Builder
+			if err := genContent(ctx, iotest.OneByteReader(strings.NewReader(tc.input)), &output); err != nil {
+				t.Fatalf("genContent failed: %v", err)
+			}
+			AssertOutput(t, output.String(), OutputExpectations{Contains: tc.contains})
+			if fake.configs[0].CandidateCount != int32(params.Candidates) {
+				t.Errorf("expected candidate count %d, got %d", params.Candidates, fake.configs[0].CandidateCount)
+			}
+			if tc.history == "" {
+				return
+			}
+			session, err := loadSession("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			hist := session.History
+			if len(hist) != 2 || hist[1].Parts[0].Text != tc.history {
+				t.Errorf("expected %q in history, got %+v", tc.history, hist)
+			}
+		})
+	}
+}
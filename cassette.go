@@ -0,0 +1,614 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+const Cassette = "cassette.jsonl" // name of record/replay file
+
+// interaction is a single request and its responses as stored in a cassette.
+type interaction struct {
+	Kind      string            `json:"kind"`
+	Key       string            `json:"key"`
+	Request   json.RawMessage   `json:"request,omitempty"`
+	Responses []json.RawMessage `json:"responses,omitempty"`
+	Error     *cassetteError    `json:"error,omitempty"`
+}
+
+// cassetteError keeps enough of an error to rebuild it during replay.
+type cassetteError struct {
+	Code    int    `json:"code,omitempty"`
+	Status  string `json:"status,omitempty"`
+	Message string `json:"message"`
+}
+
+func newCassetteError(err error) *cassetteError {
+	if err == nil {
+		return nil
+	}
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		return &cassetteError{Code: apiErr.Code, Status: apiErr.Status, Message: apiErr.Message}
+	}
+	return &cassetteError{Message: err.Error()}
+}
+
+func (e *cassetteError) err() error {
+	if e == nil {
+		return nil
+	}
+	if e.Code != 0 {
+		return genai.APIError{Code: e.Code, Status: e.Status, Message: e.Message}
+	}
+	return errors.New(e.Message)
+}
+
+// cassetteRequest is hashed to match requests across runs.
+type cassetteRequest struct {
+	Model    string                           `json:"model,omitempty"`
+	Contents []*genai.Content                 `json:"contents,omitempty"`
+	Config   *genai.GenerateContentConfig     `json:"config,omitempty"`
+	Name     string                           `json:"name,omitempty"` // file path or name
+	Requests []*genai.InlinedRequest          `json:"requests,omitempty"`
+	Cache    *genai.CreateCachedContentConfig `json:"cache,omitempty"`
+	Prompt   string                           `json:"prompt,omitempty"`
+	Images   []any                            `json:"images,omitempty"` // input and reference images
+	Options  any                              `json:"options,omitempty"`
+}
+
+func newInteraction(kind string, req cassetteRequest) (*interaction, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("cassette: failed to marshal %s request: %v", kind, err)
+	}
+	sum := sha256.Sum256(append([]byte(kind+"\n"), data...))
+	return &interaction{Kind: kind, Key: hex.EncodeToString(sum[:]), Request: data}, nil
+}
+
+// recordBackend forwards requests to a backend and appends them to a cassette.
+type recordBackend struct {
+	core.Wrapper
+	mu   sync.Mutex
+	file *os.File
+}
+
+// newRecordBackend truncates the cassette found in dir.
+func newRecordBackend(b core.Backend, dir string) (*recordBackend, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %v", dir, err)
+	}
+	f, err := os.Create(filepath.Join(dir, Cassette))
+	if err != nil {
+		return nil, err
+	}
+	return &recordBackend{Wrapper: core.Wrapper{Backend: b}, file: f}, nil
+}
+
+func (b *recordBackend) write(it *interaction, err error, responses ...any) error {
+	for _, r := range responses {
+		data, mErr := json.Marshal(r)
+		if mErr != nil {
+			return fmt.Errorf("cassette: failed to marshal %s response: %v", it.Kind, mErr)
+		}
+		it.Responses = append(it.Responses, data)
+	}
+	it.Error = newCassetteError(err)
+	line, mErr := json.Marshal(it)
+	if mErr != nil {
+		return fmt.Errorf("cassette: failed to marshal interaction: %v", mErr)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, wErr := b.file.Write(append(line, '\n')); wErr != nil {
+		return fmt.Errorf("cassette: %v", wErr)
+	}
+	return nil
+}
+
+// Close implements io.Closer.
+func (b *recordBackend) Close() error {
+	return b.file.Close()
+}
+
+func (b *recordBackend) GetModel(ctx context.Context, model string) (*genai.Model, error) {
+	it, err := newInteraction("model", cassetteRequest{Model: model})
+	if err != nil {
+		return nil, err
+	}
+	m, err := b.Backend.GetModel(ctx, model)
+	if wErr := b.write(it, err, m); wErr != nil {
+		return nil, wErr
+	}
+	return m, err
+}
+
+func (b *recordBackend) ListModels(ctx context.Context) iter.Seq2[*genai.Model, error] {
+	return func(yield func(*genai.Model, error) bool) {
+		it, err := newInteraction("models", cassetteRequest{})
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		var models []any
+		defer func() {
+			if wErr := b.write(it, err, models...); wErr != nil && err == nil {
+				yield(nil, wErr)
+			}
+		}()
+		for m, mErr := range b.Backend.ListModels(ctx) {
+			if mErr != nil {
+				err = mErr
+				yield(nil, err)
+				return
+			}
+			models = append(models, m)
+			if !yield(m, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (b *recordBackend) GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	it, err := newInteraction("generate", cassetteRequest{Model: model, Contents: contents, Config: config})
+	if err != nil {
+		return nil, err
+	}
+	res, err := b.Backend.GenerateContent(ctx, model, contents, config)
+	if wErr := b.write(it, err, res); wErr != nil {
+		return nil, wErr
+	}
+	return res, err
+}
+
+func (b *recordBackend) GenerateContentStream(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) iter.Seq2[*genai.GenerateContentResponse, error] {
+	return func(yield func(*genai.GenerateContentResponse, error) bool) {
+		it, err := newInteraction("stream", cassetteRequest{Model: model, Contents: contents, Config: config})
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		var chunks []any
+		stopped := false
+		defer func() {
+			if wErr := b.write(it, err, chunks...); wErr != nil && !stopped {
+				yield(nil, wErr)
+			}
+		}()
+		for resp, rErr := range b.Backend.GenerateContentStream(ctx, model, contents, config) {
+			if rErr != nil {
+				err = rErr
+				stopped = !yield(nil, err)
+				return
+			}
+			chunks = append(chunks, resp)
+			if !yield(resp, nil) {
+				stopped = true
+				return
+			}
+		}
+	}
+}
+
+func (b *recordBackend) EmbedContent(ctx context.Context, model string, contents []*genai.Content) (*genai.EmbedContentResponse, error) {
+	it, err := newInteraction("embed", cassetteRequest{Model: model, Contents: contents})
+	if err != nil {
+		return nil, err
+	}
+	res, err := b.Backend.EmbedContent(ctx, model, contents)
+	if wErr := b.write(it, err, res); wErr != nil {
+		return nil, wErr
+	}
+	return res, err
+}
+
+func (b *recordBackend) CountTokens(ctx context.Context, model string, contents []*genai.Content) (*genai.CountTokensResponse, error) {
+	it, err := newInteraction("count", cassetteRequest{Model: model, Contents: contents})
+	if err != nil {
+		return nil, err
+	}
+	res, err := b.Backend.CountTokens(ctx, model, contents)
+	if wErr := b.write(it, err, res); wErr != nil {
+		return nil, wErr
+	}
+	return res, err
+}
+
+func (b *recordBackend) UploadFile(ctx context.Context, path string) (*genai.File, error) {
+	it, err := newInteraction("upload", cassetteRequest{Name: filepath.ToSlash(path)})
+	if err != nil {
+		return nil, err
+	}
+	f, err := b.Wrapper.UploadFile(ctx, path)
+	if wErr := b.write(it, err, f); wErr != nil {
+		return nil, wErr
+	}
+	return f, err
+}
+
+func (b *recordBackend) GetFile(ctx context.Context, name string) (*genai.File, error) {
+	it, err := newInteraction("file", cassetteRequest{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	f, err := b.Wrapper.GetFile(ctx, name)
+	if wErr := b.write(it, err, f); wErr != nil {
+		return nil, wErr
+	}
+	return f, err
+}
+
+func (b *recordBackend) DeleteFile(ctx context.Context, name string) error {
+	it, err := newInteraction("delete", cassetteRequest{Name: name})
+	if err != nil {
+		return err
+	}
+	err = b.Wrapper.DeleteFile(ctx, name)
+	if wErr := b.write(it, err); wErr != nil {
+		return wErr
+	}
+	return err
+}
+
+func (b *recordBackend) CreateBatchJob(ctx context.Context, model string, requests []*genai.InlinedRequest, displayName string) (*genai.BatchJob, error) {
+	it, err := newInteraction("batch", cassetteRequest{Model: model, Requests: requests, Name: displayName})
+	if err != nil {
+		return nil, err
+	}
+	job, err := b.Wrapper.CreateBatchJob(ctx, model, requests, displayName)
+	if wErr := b.write(it, err, job); wErr != nil {
+		return nil, wErr
+	}
+	return job, err
+}
+
+func (b *recordBackend) GetBatchJob(ctx context.Context, name string) (*genai.BatchJob, error) {
+	it, err := newInteraction("job", cassetteRequest{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	job, err := b.Wrapper.GetBatchJob(ctx, name)
+	if wErr := b.write(it, err, job); wErr != nil {
+		return nil, wErr
+	}
+	return job, err
+}
+
+func (b *recordBackend) CreateCachedContent(ctx context.Context, model string, config *genai.CreateCachedContentConfig) (*genai.CachedContent, error) {
+	it, err := newInteraction("cache", cassetteRequest{Model: model, Cache: config})
+	if err != nil {
+		return nil, err
+	}
+	c, err := b.Wrapper.CreateCachedContent(ctx, model, config)
+	if wErr := b.write(it, err, c); wErr != nil {
+		return nil, wErr
+	}
+	return c, err
+}
+
+func (b *recordBackend) GetCachedContent(ctx context.Context, name string) (*genai.CachedContent, error) {
+	it, err := newInteraction("cached", cassetteRequest{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	c, err := b.Wrapper.GetCachedContent(ctx, name)
+	if wErr := b.write(it, err, c); wErr != nil {
+		return nil, wErr
+	}
+	return c, err
+}
+
+func (b *recordBackend) GenerateImages(ctx context.Context, model string, prompt string, config *genai.GenerateImagesConfig) (*genai.GenerateImagesResponse, error) {
+	it, err := newInteraction("images", cassetteRequest{Model: model, Prompt: prompt, Options: config})
+	if err != nil {
+		return nil, err
+	}
+	res, err := b.Wrapper.GenerateImages(ctx, model, prompt, config)
+	if wErr := b.write(it, err, res); wErr != nil {
+		return nil, wErr
+	}
+	return res, err
+}
+
+func (b *recordBackend) EditImage(ctx context.Context, model string, prompt string, refs []genai.ReferenceImage, config *genai.EditImageConfig) (*genai.EditImageResponse, error) {
+	it, err := newInteraction("edit", cassetteRequest{Model: model, Prompt: prompt, Images: referenceImages(refs), Options: config})
+	if err != nil {
+		return nil, err
+	}
+	res, err := b.Wrapper.EditImage(ctx, model, prompt, refs, config)
+	if wErr := b.write(it, err, res); wErr != nil {
+		return nil, wErr
+	}
+	return res, err
+}
+
+func (b *recordBackend) UpscaleImage(ctx context.Context, model string, image *genai.Image, factor string, config *genai.UpscaleImageConfig) (*genai.UpscaleImageResponse, error) {
+	it, err := newInteraction("upscale", cassetteRequest{Model: model, Name: factor, Images: []any{image}, Options: config})
+	if err != nil {
+		return nil, err
+	}
+	res, err := b.Wrapper.UpscaleImage(ctx, model, image, factor, config)
+	if wErr := b.write(it, err, res); wErr != nil {
+		return nil, wErr
+	}
+	return res, err
+}
+
+func (b *recordBackend) GenerateVideos(ctx context.Context, model string, prompt string, image *genai.Image, config *genai.GenerateVideosConfig) (*genai.GenerateVideosOperation, error) {
+	it, err := newInteraction("videos", cassetteRequest{Model: model, Prompt: prompt, Images: videoImages(image), Options: config})
+	if err != nil {
+		return nil, err
+	}
+	op, err := b.Wrapper.GenerateVideos(ctx, model, prompt, image, config)
+	if wErr := b.write(it, err, op); wErr != nil {
+		return nil, wErr
+	}
+	return op, err
+}
+
+func (b *recordBackend) GetVideosOperation(ctx context.Context, op *genai.GenerateVideosOperation) (*genai.GenerateVideosOperation, error) {
+	it, err := newInteraction("operation", cassetteRequest{Name: op.Name})
+	if err != nil {
+		return nil, err
+	}
+	res, err := b.Wrapper.GetVideosOperation(ctx, op)
+	if wErr := b.write(it, err, res); wErr != nil {
+		return nil, wErr
+	}
+	return res, err
+}
+
+func (b *recordBackend) DownloadVideo(ctx context.Context, video *genai.Video) ([]byte, error) {
+	it, err := newInteraction("download", cassetteRequest{Name: video.URI})
+	if err != nil {
+		return nil, err
+	}
+	data, err := b.Wrapper.DownloadVideo(ctx, video)
+	if wErr := b.write(it, err, data); wErr != nil {
+		return nil, wErr
+	}
+	return data, err
+}
+
+// referenceImages lists reference images for hashing.
+func referenceImages(refs []genai.ReferenceImage) []any {
+	var res []any
+	for _, r := range refs {
+		res = append(res, r)
+	}
+	return res
+}
+
+// videoImages lists the optional first frame of a video for hashing.
+func videoImages(image *genai.Image) []any {
+	if image == nil {
+		return nil
+	}
+	return []any{image}
+}
+
+// replayBackend serves interactions from a cassette without network access.
+// Requests are matched on their key. When lenient, a request matching none
+// gets the next unused interaction of the same kind, with a warning, so that
+// runs with slightly different tool output still replay.
+type replayBackend struct {
+	mu           sync.Mutex
+	interactions []*interaction
+	used         []bool
+	lenient      bool
+}
+
+// newReplayBackend loads the cassette found in dir.
+func newReplayBackend(dir string, lenient bool) (*replayBackend, error) {
+	f, err := os.Open(filepath.Join(dir, Cassette))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b := &replayBackend{lenient: lenient}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		it := &interaction{}
+		if err := json.Unmarshal(scanner.Bytes(), it); err != nil {
+			return nil, fmt.Errorf("cassette: %v", err)
+		}
+		b.interactions = append(b.interactions, it)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cassette: %v", err)
+	}
+	b.used = make([]bool, len(b.interactions))
+	return b, nil
+}
+
+// next returns the recorded interaction matching kind and request.
+func (b *replayBackend) next(kind string, req cassetteRequest) (*interaction, error) {
+	want, err := newInteraction(kind, req)
+	if err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	fallback := -1
+	for i, it := range b.interactions {
+		if b.used[i] || it.Kind != kind {
+			continue
+		}
+		if it.Key == want.Key {
+			b.used[i] = true
+			return it, nil
+		}
+		if fallback == -1 {
+			fallback = i
+		}
+	}
+	if fallback == -1 {
+		return nil, fmt.Errorf("cassette: no recorded %s interaction left", kind)
+	}
+	if !b.lenient {
+		return nil, fmt.Errorf("cassette: %s request %s matches no recorded interaction, use -lenient to replay in recording order", kind, want.Key)
+	}
+	fmt.Fprintf(os.Stderr, "cassette: %s request %s matches no recorded interaction, replaying %s\n", kind, want.Key, b.interactions[fallback].Key)
+	b.used[fallback] = true
+	return b.interactions[fallback], nil
+}
+
+// replayOne decodes the single response of a recorded interaction.
+func replayOne[T any](b *replayBackend, kind string, req cassetteRequest) (*T, error) {
+	it, err := b.next(kind, req)
+	if err != nil {
+		return nil, err
+	}
+	if it.Error != nil {
+		return nil, it.Error.err()
+	}
+	if len(it.Responses) == 0 {
+		return nil, fmt.Errorf("cassette: empty %s interaction", kind)
+	}
+	var res T
+	if err := json.Unmarshal(it.Responses[0], &res); err != nil {
+		return nil, fmt.Errorf("cassette: %v", err)
+	}
+	return &res, nil
+}
+
+func (b *replayBackend) Name() string { return "Replay" }
+
+func (b *replayBackend) GetModel(ctx context.Context, model string) (*genai.Model, error) {
+	return replayOne[genai.Model](b, "model", cassetteRequest{Model: model})
+}
+
+func (b *replayBackend) ListModels(ctx context.Context) iter.Seq2[*genai.Model, error] {
+	return func(yield func(*genai.Model, error) bool) {
+		it, err := b.next("models", cassetteRequest{})
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for _, data := range it.Responses {
+			m := &genai.Model{}
+			if err := json.Unmarshal(data, m); err != nil {
+				yield(nil, fmt.Errorf("cassette: %v", err))
+				return
+			}
+			if !yield(m, nil) {
+				return
+			}
+		}
+		if it.Error != nil {
+			yield(nil, it.Error.err())
+		}
+	}
+}
+
+func (b *replayBackend) GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	return replayOne[genai.GenerateContentResponse](b, "generate", cassetteRequest{Model: model, Contents: contents, Config: config})
+}
+
+func (b *replayBackend) GenerateContentStream(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) iter.Seq2[*genai.GenerateContentResponse, error] {
+	return func(yield func(*genai.GenerateContentResponse, error) bool) {
+		it, err := b.next("stream", cassetteRequest{Model: model, Contents: contents, Config: config})
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for _, data := range it.Responses {
+			resp := &genai.GenerateContentResponse{}
+			if err := json.Unmarshal(data, resp); err != nil {
+				yield(nil, fmt.Errorf("cassette: %v", err))
+				return
+			}
+			if !yield(resp, nil) {
+				return
+			}
+		}
+		if it.Error != nil {
+			yield(nil, it.Error.err())
+		}
+	}
+}
+
+func (b *replayBackend) EmbedContent(ctx context.Context, model string, contents []*genai.Content) (*genai.EmbedContentResponse, error) {
+	return replayOne[genai.EmbedContentResponse](b, "embed", cassetteRequest{Model: model, Contents: contents})
+}
+
+func (b *replayBackend) CountTokens(ctx context.Context, model string, contents []*genai.Content) (*genai.CountTokensResponse, error) {
+	return replayOne[genai.CountTokensResponse](b, "count", cassetteRequest{Model: model, Contents: contents})
+}
+
+func (b *replayBackend) UploadFile(ctx context.Context, path string) (*genai.File, error) {
+	return replayOne[genai.File](b, "upload", cassetteRequest{Name: filepath.ToSlash(path)})
+}
+
+func (b *replayBackend) GetFile(ctx context.Context, name string) (*genai.File, error) {
+	return replayOne[genai.File](b, "file", cassetteRequest{Name: name})
+}
+
+func (b *replayBackend) DeleteFile(ctx context.Context, name string) error {
+	it, err := b.next("delete", cassetteRequest{Name: name})
+	if err != nil {
+		return err
+	}
+	return it.Error.err()
+}
+
+func (b *replayBackend) CreateBatchJob(ctx context.Context, model string, requests []*genai.InlinedRequest, displayName string) (*genai.BatchJob, error) {
+	return replayOne[genai.BatchJob](b, "batch", cassetteRequest{Model: model, Requests: requests, Name: displayName})
+}
+
+func (b *replayBackend) GetBatchJob(ctx context.Context, name string) (*genai.BatchJob, error) {
+	return replayOne[genai.BatchJob](b, "job", cassetteRequest{Name: name})
+}
+
+func (b *replayBackend) CreateCachedContent(ctx context.Context, model string, config *genai.CreateCachedContentConfig) (*genai.CachedContent, error) {
+	return replayOne[genai.CachedContent](b, "cache", cassetteRequest{Model: model, Cache: config})
+}
+
+func (b *replayBackend) GetCachedContent(ctx context.Context, name string) (*genai.CachedContent, error) {
+	return replayOne[genai.CachedContent](b, "cached", cassetteRequest{Name: name})
+}
+
+func (b *replayBackend) GenerateImages(ctx context.Context, model string, prompt string, config *genai.GenerateImagesConfig) (*genai.GenerateImagesResponse, error) {
+	return replayOne[genai.GenerateImagesResponse](b, "images", cassetteRequest{Model: model, Prompt: prompt, Options: config})
+}
+
+func (b *replayBackend) EditImage(ctx context.Context, model string, prompt string, refs []genai.ReferenceImage, config *genai.EditImageConfig) (*genai.EditImageResponse, error) {
+	return replayOne[genai.EditImageResponse](b, "edit", cassetteRequest{Model: model, Prompt: prompt, Images: referenceImages(refs), Options: config})
+}
+
+func (b *replayBackend) UpscaleImage(ctx context.Context, model string, image *genai.Image, factor string, config *genai.UpscaleImageConfig) (*genai.UpscaleImageResponse, error) {
+	return replayOne[genai.UpscaleImageResponse](b, "upscale", cassetteRequest{Model: model, Name: factor, Images: []any{image}, Options: config})
+}
+
+func (b *replayBackend) GenerateVideos(ctx context.Context, model string, prompt string, image *genai.Image, config *genai.GenerateVideosConfig) (*genai.GenerateVideosOperation, error) {
+	return replayOne[genai.GenerateVideosOperation](b, "videos", cassetteRequest{Model: model, Prompt: prompt, Images: videoImages(image), Options: config})
+}
+
+func (b *replayBackend) GetVideosOperation(ctx context.Context, op *genai.GenerateVideosOperation) (*genai.GenerateVideosOperation, error) {
+	return replayOne[genai.GenerateVideosOperation](b, "operation", cassetteRequest{Name: op.Name})
+}
+
+func (b *replayBackend) DownloadVideo(ctx context.Context, video *genai.Video) ([]byte, error) {
+	data, err := replayOne[[]byte](b, "download", cassetteRequest{Name: video.URI})
+	if err != nil {
+		return nil, err
+	}
+	return *data, nil
+}
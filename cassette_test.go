@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+// runCassette executes genContent once against a recording fake and once in replay mode.
+func runCassette(t *testing.T, fake *fakeBackend, input string, args ...string) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(t.TempDir()) // chat history lands in a scratch folder
+
+	record := func() string {
+		ctx := prepareTestContext(t, true, args...)
+		params := ctx.Value(core.ParamsKey).(*core.Parameters)
+		params.OutRedirected = true
+		rec, err := newRecordBackend(fake, dir)
+		if err != nil {
+			t.Fatalf("newRecordBackend failed: %v", err)
+		}
+		params.Client = rec
+		var output strings.Builder
+		if err := genContent(ctx, iotest.OneByteReader(strings.NewReader(input)), &output); err != nil {
+			t.Fatalf("genContent failed while recording: %v", err)
+		}
+		rec.Close()
+		return output.String()
+	}
+	recorded := record()
+	os.RemoveAll(DotGenDir)
+
+	ctx := prepareTestContext(t, true, append([]string{"-replay", dir}, args...)...)
+	params := ctx.Value(core.ParamsKey).(*core.Parameters)
+	params.OutRedirected = true
+	var output strings.Builder
+	if err := genContent(ctx, iotest.OneByteReader(strings.NewReader(input)), &output); err != nil {
+		t.Fatalf("genContent failed while replaying: %v", err)
+	}
+	if _, ok := params.Client.(*replayBackend); !ok {
+		t.Errorf("expected replay backend, got %T", params.Client)
+	}
+	return recorded, output.String()
+}
+
+func TestCassette_SingleTurn(t *testing.T) {
+	fake := &fakeBackend{replies: []fakeReply{textReply("Hello", " world")}}
+	recorded, replayed := runCassette(t, fake, "", "hi")
+	if recorded != replayed || !strings.Contains(replayed, "Hello world") {
+		t.Errorf("replay mismatch: recorded %q, replayed %q", recorded, replayed)
+	}
+}
+
+func TestCassette_Chat(t *testing.T) {
+	fake := &fakeBackend{replies: []fakeReply{textReply("first"), textReply("second")}}
+	recorded, replayed := runCassette(t, fake, "again\n\n\n", "-c", "hi")
+	if recorded != replayed || !strings.Contains(replayed, "second") {
+		t.Errorf("replay mismatch: recorded %q, replayed %q", recorded, replayed)
+	}
+}
+
+func TestCassette_ToolLoop(t *testing.T) {
+	call := fakeReply{chunks: []*genai.GenerateContentResponse{{
+		Candidates: []*genai.Candidate{{
+			Content:      &genai.Content{Role: "model", Parts: []*genai.Part{genai.NewPartFromFunctionCall("ListGeminiModels", nil)}},
+			FinishReason: genai.FinishReasonStop,
+		}},
+	}}}
+	fake := &fakeBackend{replies: []fakeReply{call, textReply("one model")}}
+	recorded, replayed := runCassette(t, fake, "", "-tool", "which models?")
+	if recorded != replayed || !strings.Contains(replayed, "one model") {
+		t.Errorf("replay mismatch: recorded %q, replayed %q", recorded, replayed)
+	}
+}
+
+func TestReplayBackend_Errors(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := newRecordBackend(&fakeBackend{replies: []fakeReply{{err: genai.APIError{Code: 429, Message: "slow down"}}}}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := rec.GenerateContent(ctx, "m", nil, nil); err == nil {
+		t.Fatal("expected recorded error")
+	}
+	rec.Close()
+
+	rep, err := newReplayBackend(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = rep.GenerateContent(ctx, "m", nil, nil)
+	if apiErr, ok := err.(genai.APIError); !ok || apiErr.Code != 429 {
+		t.Errorf("expected replayed API error, got %v", err)
+	}
+	if _, err := rep.GenerateContent(ctx, "m", nil, nil); err == nil {
+		t.Errorf("expected exhausted cassette error")
+	}
+	if _, err := newReplayBackend(filepath.Join(dir, "missing"), false); err == nil {
+		t.Errorf("expected error for missing cassette")
+	}
+}
+
+func TestReplayBackend_Mismatch(t *testing.T) {
+	dir := t.TempDir()
+	rec, err := newRecordBackend(&fakeBackend{replies: []fakeReply{textReply("recorded")}}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if _, err := rec.GenerateContent(ctx, "m", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	rec.Close()
+
+	for _, lenient := range []bool{false, true} {
+		rep, err := newReplayBackend(dir, lenient)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := rep.GenerateContent(ctx, "changed", nil, nil)
+		if lenient && (err != nil || resp.Text() != "recorded") {
+			t.Errorf("expected lenient replay in recording order, got %v", err)
+		}
+		if !lenient && (err == nil || !strings.Contains(err.Error(), "matches no recorded interaction")) {
+			t.Errorf("expected key mismatch error, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// chatCommands lists the slash commands of chat mode for /help.
+var chatCommands = [][2]string{
+	{"/model [name]", "show or change the model, with comma separated fallbacks"},
+	{"/temp [value]", "show or change the temperature [0.0,2.0]"},
+	{"/think [level]", "show or change the thinking level"},
+	{"/attach <path>...", "attach files, directories or patterns to the next prompt"},
+	{"/system [text]", "show or replace the system instruction"},
+	{"/undo", "remove the last turn"},
+	{"/retry", "remove the last turn and send its prompt again"},
+	{"/save [name]", "save the session now, under a new name if given"},
+	{"/history", "show the conversation"},
+	{"/tokens", "count the tokens of the conversation"},
+	{"/compact", "summarize the oldest half of the turns and archive them"},
+	{"/restore", "put the archived turns back in place of their summary"},
+	{"/clear", "remove all turns"},
+	{"/exit", "save and leave the chat"},
+}
+
+// isChatCommand reports whether input is a slash command rather than a
+// prompt, a leading // standing for a prompt starting with /.
+func isChatCommand(input string) bool {
+	return strings.HasPrefix(input, "/") && !strings.HasPrefix(input, "//")
+}
+
+// chatCommand runs a slash command typed in chat mode and reports whether the
+// chat ends. Changes to config apply from the next turn. /retry fills g.parts
+// with the prompt to send again.
+func (g *Generator) chatCommand(input string, config *genai.GenerateContentConfig, history *[]*genai.Content, session *chatSession) (bool, error) {
+	name, arg, _ := strings.Cut(strings.TrimSpace(input), " ")
+	arg = strings.TrimSpace(arg)
+	say := func(format string, a ...any) {
+		if g.events != nil {
+			g.events.emit(event{Type: "info", Text: fmt.Sprintf(format, a...)})
+			return
+		}
+		fmt.Fprintf(g.out, infos(format)+"\n", a...)
+	}
+
+	switch name {
+	case "/model":
+		if arg == "" {
+			say("model %s", strings.Join(append([]string{g.params.GenModel}, g.params.Fallbacks...), ","))
+			break
+		}
+		model, fallbacks := parseModels(arg)
+		if _, err := g.client.GetModel(g.ctx, model); err != nil {
+			say("model %s: %v", model, err)
+			break
+		}
+		if config.CachedContent != "" && model != g.params.GenModel {
+			// a cache belongs to its model, its content goes with the next turn
+			if err := g.resolveUploads(g.cachedParts); err != nil {
+				say("%v", err)
+				break
+			}
+			g.attached = slices.Concat(g.cachedParts, g.attached)
+			g.sysParts = slices.Concat(g.cachedSys, g.sysParts)
+			if len(g.sysParts) > 0 {
+				config.SystemInstruction = &genai.Content{Parts: g.sysParts}
+			}
+			config.CachedContent = ""
+			g.cachedParts, g.cachedSys = nil, nil
+			say("cached content sent with the next turn")
+		}
+		g.params.GenModel, g.params.Fallbacks = model, fallbacks
+		g.model = nil // token limit of the new model
+		say("model %s", arg)
+	case "/temp":
+		if arg == "" {
+			say("temperature %g", g.params.Temp)
+			break
+		}
+		temp, err := strconv.ParseFloat(arg, 64)
+		if err != nil || temp < 0 || temp > 2 {
+			say("expecting a temperature between 0.0 and 2.0")
+			break
+		}
+		g.params.Temp = temp
+		config.Temperature = genai.Ptr(float32(temp))
+		say("temperature %g", temp)
+	case "/think":
+		if arg == "" {
+			say("thinking level %s", g.params.ThinkingLevel)
+			break
+		}
+		level := thinkingLevel(arg)
+		if level == "" {
+			say("expecting %s, %s, %s or %s", genai.ThinkingLevelMinimal, genai.ThinkingLevelLow,
+				genai.ThinkingLevelMedium, genai.ThinkingLevelHigh)
+			break
+		}
+		g.params.ThinkingLevel = level
+		config.ThinkingConfig = &genai.ThinkingConfig{IncludeThoughts: true, ThinkingLevel: level}
+		say("thinking level %s", level)
+	case "/attach":
+		if arg == "" {
+			say("expecting a path")
+			break
+		}
+		sysParts := len(g.sysParts)
+		for _, filePathVal := range strings.Fields(arg) {
+			n, s := len(g.attached), len(g.sysParts)
+			if err := glob(g.ctx, g.client, filePathVal, &g.attached, &g.sysParts, &g.schema); err != nil {
+				say("%v", err)
+				continue
+			}
+			if config.CachedContent != "" && len(g.sysParts) > s {
+				g.sysParts = g.sysParts[:s]
+				say("%s: system instruction is part of the cached content", filePathVal)
+				if len(g.attached) == n {
+					continue
+				}
+			}
+			for _, p := range g.attached[n:] {
+				if p.FileData != nil {
+					g.params.FileURIs = append(g.params.FileURIs, p.FileData.FileURI) // for cleanup
+				}
+			}
+			if path.Ext(filePathVal) == PExt {
+				g.prompts = append(g.prompts, g.attached[n:]...)
+			}
+			say("attached %s", filePathVal)
+		}
+		if len(g.sysParts) > sysParts {
+			config.SystemInstruction = &genai.Content{Parts: g.sysParts}
+		}
+	case "/system":
+		if arg == "" {
+			if config.SystemInstruction == nil {
+				say("no system instruction")
+			}
+			for _, p := range g.sysParts {
+				say("%s", p.Text)
+			}
+			break
+		}
+		if config.CachedContent != "" {
+			say("system instruction is part of the cached content")
+			break
+		}
+		g.sysParts = []*genai.Part{{Text: searchReplace(arg, g.keyVals)}}
+		config.SystemInstruction = &genai.Content{Parts: g.sysParts}
+		say("system instruction replaced")
+	case "/undo", "/retry":
+		starts := turns(*history)
+		if len(starts) == 0 {
+			say("no turn to remove")
+			break
+		}
+		last := starts[len(starts)-1]
+		if name == "/retry" {
+			g.parts = append(g.parts, (*history)[last].Parts...)
+		}
+		*history = (*history)[:last]
+		if name == "/undo" {
+			say("last turn removed")
+		}
+	case "/save":
+		if session == nil {
+			break
+		}
+		if arg != "" {
+			if other, err := findSession(arg); err != nil {
+				say("%v", err)
+				break
+			} else if other != nil {
+				say("session %s exists", arg)
+				break
+			}
+			session.Name, session.Created = arg, time.Now()
+		}
+		session.History = *history
+		session.Archive = g.archive
+		session.Model = g.params.GenModel
+		if err := session.save(); err != nil {
+			return false, err
+		}
+		say("session %s saved", session.Name)
+	case "/history":
+		if g.events != nil {
+			var b strings.Builder
+			emitHistory(&b, *history)
+			say("%s", strings.TrimSpace(b.String()))
+			break
+		}
+		emitHistory(g.out, *history)
+	case "/tokens":
+		var total int32
+		if len(*history) > 0 {
+			res, err := g.client.CountTokens(g.ctx, g.params.GenModel, withoutMetadata(*history))
+			if err != nil {
+				say("%v", err)
+				break
+			}
+			total = res.TotalTokens
+		}
+		used := int32(0)
+		if g.usage != nil {
+			used = g.usage.TotalTokenCount
+		}
+		say("%d tokens in history, %d used in this chat", total, used)
+	case "/compact":
+		h, n, err := g.summarizeOldest(*history)
+		if err != nil {
+			say("%v", err)
+			break
+		}
+		if n == 0 {
+			say("not enough turns to compact")
+			break
+		}
+		*history = h
+		say("compacted %d oldest turns", n)
+	case "/restore":
+		h, n := g.restoreArchive(*history)
+		if n == 0 {
+			say("no archived turns")
+			break
+		}
+		*history = h
+		say("restored %d archived turns", n)
+	case "/clear":
+		*history = nil
+		g.archive = nil
+		say("history cleared")
+	case "/exit":
+		return true, nil
+	default:
+		for _, c := range chatCommands {
+			say("%-18s %s", c[0], c[1])
+		}
+		say("%-18s %s", "//...", "send a prompt starting with /")
+	}
+	return false, nil
+}
+
+// thinkingLevel returns the level val is a prefix of, at least three
+// letters long, or an empty level.
+func thinkingLevel(val string) genai.ThinkingLevel {
+	val = strings.ToUpper(val)
+	if len(val) < 3 {
+		return ""
+	}
+	for _, level := range []genai.ThinkingLevel{genai.ThinkingLevelMinimal, genai.ThinkingLevelLow,
+		genai.ThinkingLevelMedium, genai.ThinkingLevelHigh} {
+		if strings.HasPrefix(string(level), val) {
+			return level
+		}
+	}
+	return ""
+}
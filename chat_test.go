@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+func TestGenContent_ChatCommands(t *testing.T) {
+	t.Chdir(t.TempDir())
+	os.WriteFile("notes.txt", []byte("some notes"), 0644)
+	fake := &fakeBackend{replies: []fakeReply{textReply("first"), textReply("second"), textReply("third")}}
+	ctx := prepareTestContext(t, true, "-c", "hello")
+	params := ctx.Value(core.ParamsKey).(*core.Parameters)
+	params.Client = fake
+	params.OutRedirected = true
+
+	input := strings.Join([]string{
+		"/temp 0.5", "/temp 3", "/think low", "/model other", "/system be brief", "/attach notes.txt",
+		"//etc is a folder", "/undo", "/retry", "/tokens", "/save named", "/help", "/exit", "",
+	}, "\n")
+	var output strings.Builder
+	if err := genContent(ctx, iotest.OneByteReader(strings.NewReader(input)), &output); err != nil {
+		t.Fatal(err)
+	}
+	AssertOutput(t, output.String(), OutputExpectations{Contains: []string{
+		"temperature 0.5", "expecting a temperature", "thinking level LOW", "model other",
+		"system instruction replaced", "attached notes.txt", "last turn removed",
+		"tokens in history", "session named saved", "/retry",
+	}})
+
+	if len(fake.models) != 3 || fake.models[0] == "other" || fake.models[1] != "other" {
+		t.Errorf("unexpected models %v", fake.models)
+	}
+	config := fake.configs[1]
+	if *config.Temperature != 0.5 || config.ThinkingConfig.ThinkingLevel != genai.ThinkingLevelLow ||
+		config.SystemInstruction.Parts[0].Text != "be brief" {
+		t.Errorf("expected changed config, got %+v", config)
+	}
+	second := fake.contents[1][len(fake.contents[1])-1].Parts
+	if len(second) < 2 || !strings.Contains(contentText(&genai.Content{Parts: second}), "some notes") ||
+		second[len(second)-1].Text != "/etc is a folder" {
+		t.Errorf("expected attachment and escaped prompt, got %+v", second)
+	}
+	if third := fake.contents[2]; len(third) != 1 || third[0].Parts[0].Text != "hello" {
+		t.Errorf("expected first prompt sent again, got %+v", third)
+	}
+
+	session, err := findSession("named")
+	if err != nil || session == nil {
+		t.Fatalf("expected named session, got %v", err)
+	}
+	if len(session.History) != 2 || session.History[1].Parts[0].Text != "third" || session.Model != "other" {
+		t.Errorf("unexpected session %+v", session)
+	}
+}
+
+func TestThinkingLevel(t *testing.T) {
+	for val, want := range map[string]genai.ThinkingLevel{
+		"low": genai.ThinkingLevelLow, "med": genai.ThinkingLevelMedium, "HIGH": genai.ThinkingLevelHigh,
+		"mi": "", "max": "",
+	} {
+		if got := thinkingLevel(val); got != want {
+			t.Errorf("%s: expected %q, got %q", val, want, got)
+		}
+	}
+}
+
+func TestGenContent_ChatCommandsCached(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	os.WriteFile("notes.txt", []byte("long notes"), 0644)
+	os.WriteFile("role.sprompt", []byte("be brief"), 0644)
+	os.WriteFile("other.sprompt", []byte("be verbose"), 0644)
+	fake := &fakeBackend{replies: []fakeReply{textReply("first"), textReply("second")}}
+	ctx := prepareTestContext(t, true, "-c", "-cache", "1h", "-f", "notes.txt", "-f", "role.sprompt", "hello")
+	params := ctx.Value(core.ParamsKey).(*core.Parameters)
+	params.Client = fake
+	params.OutRedirected = true
+
+	input := strings.Join([]string{"/attach other.sprompt", "/model other", "next", "/exit", ""}, "\n")
+	var output strings.Builder
+	if err := genContent(ctx, iotest.OneByteReader(strings.NewReader(input)), &output); err != nil {
+		t.Fatal(err)
+	}
+	AssertOutput(t, output.String(), OutputExpectations{Contains: []string{
+		"other.sprompt: system instruction is part of the cached content", "cached content sent with the next turn",
+	}})
+
+	if len(fake.configs) != 2 || fake.created != 1 {
+		t.Fatalf("expected cached first turn, got %d turns and %d caches", len(fake.configs), fake.created)
+	}
+	config := fake.configs[1]
+	if config.CachedContent != "" || config.SystemInstruction == nil || contentText(config.SystemInstruction) != "be brief" {
+		t.Errorf("expected cache replaced by its system instruction, got %+v", config)
+	}
+	second := fake.contents[1][len(fake.contents[1])-1]
+	if text := contentText(second); !strings.Contains(text, "long notes") || !strings.HasSuffix(text, "next") {
+		t.Errorf("expected cached attachment sent with the prompt, got %+v", second.Parts)
+	}
+}
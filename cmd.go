@@ -28,8 +28,9 @@ const (
 	SPExt     = ".sprompt" // system prompt extension
 	PExt      = ".prompt"  // regular prompt extension
 	DigestKey = "{digest}" // key to replace with embedded content
-	DotGen    = ".gen"     // name of chat history file
+	DotGen    = ".gen"     // name of chat history file before sessions
 	DotGenRc  = ".genrc"   // name of preferences file
+	DotGenDir = ".gen.d"   // name of home folder holding jobs and project folder holding sessions
 )
 
 func main() {
@@ -87,8 +88,59 @@ func run(ctx context.Context) error {
 		return fmt.Errorf("")
 	}
 
-	if err := validateEnv(); err != nil {
-		return fmt.Errorf("Environment error: %v", err)
+	if params.Report != "" {
+		if err := runReport(ctx, os.Stdout); err != nil {
+			return fmt.Errorf("Report error: %v", err)
+		}
+		return nil
+	}
+
+	if params.SessionOp != "" {
+		if err := runSessions(ctx, os.Stdout); err != nil {
+			return fmt.Errorf("Session error: %v", err)
+		}
+		return nil
+	}
+
+	if params.Schema != "" && !params.JSON {
+		if err := runSchema(ctx, os.Stdin, os.Stdout); err != nil {
+			return fmt.Errorf("Schema error: %v", err)
+		}
+		return nil
+	}
+
+	if params.ReplayPath == "" && (params.Backend == "" || params.Backend == "gemini") {
+		if err := validateEnv(); err != nil {
+			return fmt.Errorf("Environment error: %v", err)
+		}
+	}
+
+	if params.JobOp != "" {
+		if err := runJob(ctx, os.Stdin, os.Stdout); err != nil {
+			return fmt.Errorf("Job error: %v", err)
+		}
+		return nil
+	}
+
+	if params.Serve != "" {
+		if err := runServe(ctx); err != nil {
+			return fmt.Errorf("Server error: %v", err)
+		}
+		return nil
+	}
+
+	if params.MCPServe != "" {
+		if err := runMCPServe(ctx); err != nil {
+			return fmt.Errorf("MCP server error: %v", err)
+		}
+		return nil
+	}
+
+	if params.BatchPath != "" {
+		if err := runBatch(ctx, os.Stdin, os.Stdout); err != nil {
+			return fmt.Errorf("Batch error: %v", err)
+		}
+		return nil
 	}
 
 	if err := genContent(ctx, os.Stdin, os.Stdout); err != nil {
@@ -107,6 +159,13 @@ func parseFlags(fs *flag.FlagSet, params *core.Parameters, keyVals *core.ParamMa
 	params.TopP = 0.95
 	params.ThinkingLevel = genai.ThinkingLevelUnspecified
 	params.Timeout = 300 * time.Second
+	params.Workers = 4
+	params.Candidates = 1
+	params.Trim = "oldest"
+	params.Retries = 3
+	params.Repairs = 2
+	params.RetryDelay = time.Second
+	params.Voice = "Kore"
 	params.EmbModel = "gemini-embedding-001"
 	params.GenModel = "gemini-3.5-flash-lite"
 
@@ -115,19 +174,31 @@ func parseFlags(fs *flag.FlagSet, params *core.Parameters, keyVals *core.ParamMa
 	}
 
 	fs.BoolVar(&params.Verbose, "V", false, "output model details, system instructions, chat history and thoughts")
+	fs.StringVar(&params.Answer, "answer", "", "regular expression, JSON path with -json or judge .prompt file extracting the answer voted on (default last line)")
+	fs.StringVar(&params.AspectRatio, "aspect", "", "aspect ratio of images or videos from generation models, e.g. 16:9")
+	fs.BoolVar(&params.AudioModality, "audio", false, "generate speech as WAV (use -m to set a supported model)")
+	fs.StringVar(&params.BatchPath, "batch", "", "JSONL file of prompts to run concurrently, - for stdin (incompatible with -c, -e or -img)")
+	fs.DurationVar(&params.CacheTTL, "cache", 0, "cache attached files and system prompt for this long and reuse them (incompatible with -tool, -g or -code)")
 	fs.BoolVar(&params.ChatMode, "c", false, "enter chat mode (incompatible with -json or -img)")
 	fs.BoolVar(&params.CodeGen, "code", false, "code execution tool (incompatible with -g, -img or -tool)")
+	fs.Float64Var(&params.Compact, "compact", params.Compact, "summarize the oldest chat turns past this fraction of the input token limit, 0 to disable [0.0,1.0]")
 	fs.Var(&params.DigestPaths, "d", "path to a digest folder")
 	fs.BoolVar(&params.Embed, "e", false, fmt.Sprintf("write text embeddings to digest (default model \"%s\")", params.EmbModel))
+	fs.StringVar(&params.ExtractPath, "extract", "", "write fenced code blocks of the response to files in folder")
 	fs.Var(&params.FilePaths, "f", "GCS or YouTube URL, file, directory or quoted pattern of files to attach")
 	fs.BoolVar(&params.GoogleSearch, "g", false, "Google search tool (incompatible with -code, -img and -tool)")
 	fs.BoolVar(&params.Help, "h", false, "show available tools, this help message and exit")
 	fs.BoolVar(&params.OnlyKvs, "i", false, "only store metadata with embeddings and ignore the content")
+	fs.StringVar(&params.JobOp, "job", "", "submit -batch file as Batch API job, or status, wait or fetch a job (default last submitted)")
 	fs.BoolVar(&params.ImgModality, "img", false, "generate jpeg images (use -m to set a supported model)")
 	fs.BoolVar(&params.JSON, "json", false, "structured output (incompatible with -c and -img)")
 	fs.IntVar(&params.K, "k", params.K, "maximum number of entries from digest to retrieve")
 	fs.Float64Var(&params.Lambda, "l", params.Lambda, "balance accuracy and diversity querying digests [0.0,1.0]")
-	fs.StringVar(&params.OutPath, "out", "", "output path for images (incompatible with a redirect)")
+	fs.BoolVar(&params.Lenient, "lenient", false, "replay the next recorded interaction with a warning when no request matches (with -replay)")
+	fs.IntVar(&params.Candidates, "n", params.Candidates, "number of candidates to generate and compare, or of images or videos with generation models (incompatible with -tool)")
+	fs.StringVar(&params.NegativePrompt, "negative", "", "what images or videos from generation models should not show")
+	fs.BoolVar(&params.NDJSON, "ndjson", false, "write text, thoughts, function calls, usage and errors as newline-delimited JSON events")
+	fs.StringVar(&params.OutPath, "out", "", "output path for images, speech and videos (incompatible with a redirect)")
 	fs.Func("think", fmt.Sprintf("%s, %s, %s or %s (default: %s)",
 		genai.ThinkingLevelMinimal,
 		genai.ThinkingLevelLow,
@@ -137,23 +208,41 @@ func parseFlags(fs *flag.FlagSet, params *core.Parameters, keyVals *core.ParamMa
 		params.ThinkingLevel = genai.ThinkingLevel(strings.ToUpper(val))
 		return nil
 	})
-	fs.StringVar(&params.GenModel, "m", params.GenModel, "model name")
+	fs.StringVar(&params.MaskPath, "mask", "", "mask of the area to edit in the image attached with -f (image generation models)")
+	fs.StringVar(&params.GenModel, "m", params.GenModel, "model name or comma separated models to fall back on")
 	fs.Var(&params.MCPServers, "mcp", "mcp stdio or streamable server command")
+	fs.StringVar(&params.MCPServe, "mcpserve", "", "publish prompt files of -f, digests of -d and generation as MCP server on stdio or address")
 	fs.Var(keyVals, "p", "prompt parameter value in format key=val")
+	fs.BoolVar(&params.Overwrite, "overwrite", false, "replace existing files with -extract")
 	fs.BoolVar(&params.Walk, "r", false, "process directory declared with -f recursively")
+	fs.Float64Var(&params.Rate, "rate", 0, "maximum batch requests per second (0 for no limit)")
+	fs.StringVar(&params.RecordPath, "record", "", "record requests and responses to a cassette in folder (incompatible with -replay)")
+	fs.IntVar(&params.Repairs, "repair", params.Repairs, "attempts to repair -json output not matching the attached schema")
+	fs.StringVar(&params.Report, "report", "", fmt.Sprintf("report token usage and cost by %s", strings.Join(ReportGroups, ", ")))
+	fs.StringVar(&params.ReplayPath, "replay", "", "serve requests from a cassette in folder without network access")
 	fs.BoolVar(&params.SystemInstruction, "s", false, "treat argument as system prompt")
+	fs.StringVar(&params.Schema, "schema", "", "derive the -json schema from an example JSON file or field specs like name,tags:[]string,notes?:string, printed without -json")
+	fs.StringVar(&params.Serve, "serve", "", "serve OpenAI-compatible chat completions and embeddings on address, e.g. localhost:8080")
+	fs.StringVar(&params.Session, "session", "", "name of the chat session to resume or start with -c (default last updated)")
+	fs.StringVar(&params.SessionOp, "sessions", "", "list, fork <name> <turn> [new], rename <name> <new>, delete <name>..., prune [age] or export md|html|jsonl [name]... chat sessions")
 	fs.BoolVar(&params.CountTokens, "t", false, "output total number of tokens")
 	fs.Float64Var(&params.Temp, "temp", params.Temp, "sampling during response generation [0.0,2.0]")
 	fs.DurationVar(&params.Timeout, "timeout", params.Timeout, "time limit for single turn content generation")
 	fs.BoolVar(&params.Tool, "tool", false, "invoke one of the tools (incompatible with -s, -g, -img or -code)")
 	fs.Float64Var(&params.TopP, "top_p", params.TopP, "how the model selects tokens for generation [0.0,1.0]")
+	fs.StringVar(&params.Trim, "trim", params.Trim, fmt.Sprintf("chat history trimming over the input token limit: %s", strings.Join(TrimStrategies, ", ")))
+	fs.StringVar(&params.Upscale, "upscale", "", fmt.Sprintf("upscale the image attached with -f by %s (image generation models)", strings.Join(UpscaleFactors, ", ")))
 	fs.BoolVar(&params.Unsafe, "unsafe", false, "force generation when gen aborts with FinishReasonSafety")
 	fs.BoolVar(&params.Version, "v", false, "show version and exit")
+	fs.StringVar(&params.Voice, "voice", params.Voice, "prebuilt voice of -audio, or two speaker:voice pairs separated by commas")
+	fs.IntVar(&params.Votes, "vote", 0, "sample the prompt this many times and output the majority answer")
+	fs.IntVar(&params.Workers, "workers", params.Workers, "number of concurrent batch requests")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
 
 	params.Args = fs.Args()
+	params.GenModel, params.Fallbacks = parseModels(params.GenModel)
 	params.Interactive = !isRedirected(os.Stdin)
 	params.OutRedirected = isRedirected(os.Stdout)
 	params.ToolRegistry = core.ToolMap{}
@@ -227,18 +316,15 @@ func cleanup(params *core.Parameters) {
 		}
 	}
 	// delete uploaded files
-	if len(params.FileURIs) > 0 {
+	files, ok := core.As[core.FileStore](params.Client)
+	if len(params.FileURIs) > 0 && ok {
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
-		client, err := genai.NewClient(ctx, nil)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "cleanup: failed to create client %v\n", err)
-		}
 		for _, fileURI := range params.FileURIs {
 			if isYouTubeURL(fileURI) {
 				continue
 			}
-			_, err := client.Files.Delete(ctx, fileURI, nil)
+			err := files.DeleteFile(ctx, fileURI)
 			if err != nil {
 				select {
 				case <-ctx.Done():
@@ -253,8 +339,12 @@ func cleanup(params *core.Parameters) {
 			}
 		}
 	}
+	// flush cassette
+	if closer, ok := params.Client.(io.Closer); ok {
+		closer.Close()
+	}
 	// final token count report
-	if params.CountTokens {
+	if params.CountTokens && !params.NDJSON {
 		fmt.Printf("\n"+important("%d tokens")+"\n", TokenCount.Load())
 	}
 }
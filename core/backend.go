@@ -0,0 +1,185 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+
+	"google.golang.org/genai"
+)
+
+// Backend abstracts the model provider used by gen.
+// Requests and responses are expressed with genai types regardless of the provider.
+// Services other than generation, embeddings and token counts are optional
+// interfaces looked up with As.
+type Backend interface {
+	// Name identifies the backend in verbose output e.g. GeminiAPI.
+	Name() string
+	GetModel(ctx context.Context, model string) (*genai.Model, error)
+	ListModels(ctx context.Context) iter.Seq2[*genai.Model, error]
+	GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error)
+	GenerateContentStream(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) iter.Seq2[*genai.GenerateContentResponse, error]
+	EmbedContent(ctx context.Context, model string, contents []*genai.Content) (*genai.EmbedContentResponse, error)
+	CountTokens(ctx context.Context, model string, contents []*genai.Content) (*genai.CountTokensResponse, error)
+}
+
+// FileStore is implemented by backends with a file service.
+type FileStore interface {
+	UploadFile(ctx context.Context, path string) (*genai.File, error)
+	GetFile(ctx context.Context, name string) (*genai.File, error)
+	DeleteFile(ctx context.Context, name string) error
+}
+
+// BatchRunner is implemented by backends running batch jobs.
+type BatchRunner interface {
+	// CreateBatchJob submits inlined requests as an asynchronous job.
+	CreateBatchJob(ctx context.Context, model string, requests []*genai.InlinedRequest, displayName string) (*genai.BatchJob, error)
+	GetBatchJob(ctx context.Context, name string) (*genai.BatchJob, error)
+}
+
+// Cacher is implemented by backends with context caching.
+type Cacher interface {
+	CreateCachedContent(ctx context.Context, model string, config *genai.CreateCachedContentConfig) (*genai.CachedContent, error)
+	GetCachedContent(ctx context.Context, name string) (*genai.CachedContent, error)
+}
+
+// ImageGenerator is implemented by backends serving image generation models.
+type ImageGenerator interface {
+	GenerateImages(ctx context.Context, model string, prompt string, config *genai.GenerateImagesConfig) (*genai.GenerateImagesResponse, error)
+	EditImage(ctx context.Context, model string, prompt string, refs []genai.ReferenceImage, config *genai.EditImageConfig) (*genai.EditImageResponse, error)
+	UpscaleImage(ctx context.Context, model string, image *genai.Image, factor string, config *genai.UpscaleImageConfig) (*genai.UpscaleImageResponse, error)
+}
+
+// VideoGenerator is implemented by backends serving video generation models.
+type VideoGenerator interface {
+	// GenerateVideos starts a long-running operation polled with GetVideosOperation.
+	GenerateVideos(ctx context.Context, model string, prompt string, image *genai.Image, config *genai.GenerateVideosConfig) (*genai.GenerateVideosOperation, error)
+	GetVideosOperation(ctx context.Context, op *genai.GenerateVideosOperation) (*genai.GenerateVideosOperation, error)
+	DownloadVideo(ctx context.Context, video *genai.Video) ([]byte, error)
+}
+
+// As returns b as T when b and the backends it wraps all implement T.
+func As[T any](b Backend) (T, bool) {
+	t, ok := b.(T)
+	for cur := b; ok; {
+		w, wraps := cur.(interface{ Unwrap() Backend })
+		if !wraps {
+			break
+		}
+		cur = w.Unwrap()
+		_, ok = cur.(T)
+	}
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return t, true
+}
+
+// Unsupported reports a service missing from backend b.
+func Unsupported(b Backend, service string) error {
+	return fmt.Errorf("%s backend: %s %w", b.Name(), service, errors.ErrUnsupported)
+}
+
+// Wrapper is embedded by backends wrapping another one. It forwards the
+// optional interfaces, As telling whether the wrapped backend has them.
+type Wrapper struct {
+	Backend
+}
+
+// Unwrap returns the wrapped backend.
+func (w Wrapper) Unwrap() Backend {
+	return w.Backend
+}
+
+func (w Wrapper) UploadFile(ctx context.Context, path string) (*genai.File, error) {
+	if fs, ok := w.Backend.(FileStore); ok {
+		return fs.UploadFile(ctx, path)
+	}
+	return nil, Unsupported(w.Backend, "file upload")
+}
+
+func (w Wrapper) GetFile(ctx context.Context, name string) (*genai.File, error) {
+	if fs, ok := w.Backend.(FileStore); ok {
+		return fs.GetFile(ctx, name)
+	}
+	return nil, Unsupported(w.Backend, "file lookup")
+}
+
+func (w Wrapper) DeleteFile(ctx context.Context, name string) error {
+	if fs, ok := w.Backend.(FileStore); ok {
+		return fs.DeleteFile(ctx, name)
+	}
+	return Unsupported(w.Backend, "file deletion")
+}
+
+func (w Wrapper) CreateBatchJob(ctx context.Context, model string, requests []*genai.InlinedRequest, displayName string) (*genai.BatchJob, error) {
+	if br, ok := w.Backend.(BatchRunner); ok {
+		return br.CreateBatchJob(ctx, model, requests, displayName)
+	}
+	return nil, Unsupported(w.Backend, "batch jobs")
+}
+
+func (w Wrapper) GetBatchJob(ctx context.Context, name string) (*genai.BatchJob, error) {
+	if br, ok := w.Backend.(BatchRunner); ok {
+		return br.GetBatchJob(ctx, name)
+	}
+	return nil, Unsupported(w.Backend, "batch jobs")
+}
+
+func (w Wrapper) CreateCachedContent(ctx context.Context, model string, config *genai.CreateCachedContentConfig) (*genai.CachedContent, error) {
+	if c, ok := w.Backend.(Cacher); ok {
+		return c.CreateCachedContent(ctx, model, config)
+	}
+	return nil, Unsupported(w.Backend, "context caching")
+}
+
+func (w Wrapper) GetCachedContent(ctx context.Context, name string) (*genai.CachedContent, error) {
+	if c, ok := w.Backend.(Cacher); ok {
+		return c.GetCachedContent(ctx, name)
+	}
+	return nil, Unsupported(w.Backend, "context caching")
+}
+
+func (w Wrapper) GenerateImages(ctx context.Context, model string, prompt string, config *genai.GenerateImagesConfig) (*genai.GenerateImagesResponse, error) {
+	if ig, ok := w.Backend.(ImageGenerator); ok {
+		return ig.GenerateImages(ctx, model, prompt, config)
+	}
+	return nil, Unsupported(w.Backend, "image generation models")
+}
+
+func (w Wrapper) EditImage(ctx context.Context, model string, prompt string, refs []genai.ReferenceImage, config *genai.EditImageConfig) (*genai.EditImageResponse, error) {
+	if ig, ok := w.Backend.(ImageGenerator); ok {
+		return ig.EditImage(ctx, model, prompt, refs, config)
+	}
+	return nil, Unsupported(w.Backend, "image generation models")
+}
+
+func (w Wrapper) UpscaleImage(ctx context.Context, model string, image *genai.Image, factor string, config *genai.UpscaleImageConfig) (*genai.UpscaleImageResponse, error) {
+	if ig, ok := w.Backend.(ImageGenerator); ok {
+		return ig.UpscaleImage(ctx, model, image, factor, config)
+	}
+	return nil, Unsupported(w.Backend, "image generation models")
+}
+
+func (w Wrapper) GenerateVideos(ctx context.Context, model string, prompt string, image *genai.Image, config *genai.GenerateVideosConfig) (*genai.GenerateVideosOperation, error) {
+	if vg, ok := w.Backend.(VideoGenerator); ok {
+		return vg.GenerateVideos(ctx, model, prompt, image, config)
+	}
+	return nil, Unsupported(w.Backend, "video generation models")
+}
+
+func (w Wrapper) GetVideosOperation(ctx context.Context, op *genai.GenerateVideosOperation) (*genai.GenerateVideosOperation, error) {
+	if vg, ok := w.Backend.(VideoGenerator); ok {
+		return vg.GetVideosOperation(ctx, op)
+	}
+	return nil, Unsupported(w.Backend, "video generation models")
+}
+
+func (w Wrapper) DownloadVideo(ctx context.Context, video *genai.Video) ([]byte, error) {
+	if vg, ok := w.Backend.(VideoGenerator); ok {
+		return vg.DownloadVideo(ctx, video)
+	}
+	return nil, Unsupported(w.Backend, "video generation models")
+}
@@ -17,30 +17,61 @@ const (
 	ElicitErrKey ContextKey = "elicitError"
 )
 
-// Parameters holds gen flag values as well as Args and MCP sessions.
+// Parameters holds gen flag values as well as Args, backend client and MCP sessions.
 type Parameters struct {
+	Answer            string   // regex, JSON path or judge prompt for -vote
 	Args              []string // non-flag command-line arguments i.e. prompt
+	AspectRatio       string   // of generated images
+	AudioModality     bool
+	Backend           string        // gemini or openai
+	BaseURL           string        // endpoint of an OpenAI-compatible backend
+	BatchPath         string        // JSONL file of prompts
+	CacheTTL          time.Duration // lifetime of cached attachments
+	Candidates        int           // alternatives per call
 	ChatMode          bool
+	Client            Backend // model backend shared across the run
 	CodeGen           bool
+	Compact           float64 // fraction of the input token limit triggering chat compaction
 	CountTokens       bool
 	DigestPaths       ParamArray // RAG
 	Embed             bool       // RAG
 	EmbModel          string
+	ExtractPath       string   // folder receiving fenced code blocks
+	Fallbacks         []string // models tried after GenModel
 	FilePaths         ParamArray
 	FileURIs          []string
 	GenModel          string
 	GoogleSearch      bool
 	Help              bool
 	ImgModality       bool
-	Interactive       bool // terminal session?
+	Interactive       bool   // terminal session?
+	JobOp             string // submit, status, wait or fetch
 	JSON              bool
 	K                 int
 	Lambda            float64
+	Lenient           bool   // replay in recording order when no request matches
+	MaskPath          string // area of the image to edit
+	MCPServe          string // stdio or address of the MCP server
 	MCPServers        ParamArray
 	MCPSessions       SessionArray
+	NegativePrompt    string // what generated images should not show
+	NDJSON            bool   // output as JSON events
 	OutPath           string
+	Overwrite         bool // replace existing files with -extract
 	OutRedirected     bool
-	OnlyKvs           bool // RAG
+	OnlyKvs           bool          // RAG
+	Prices            PriceMap      // from .genrc [prices]
+	Rate              float64       // batch requests per second
+	RecordPath        string        // cassette folder
+	Repairs           int           // attempts to fix output not matching the JSON schema
+	Report            string        // usage grouped by day, model or prompt
+	ReplayPath        string        // cassette folder
+	Retries           int           // attempts on transient errors
+	RetryDelay        time.Duration // base delay between attempts
+	Schema            string        // example or field specs to derive the JSON schema from
+	Serve             string        // address of the OpenAI-compatible server
+	Session           string        // chat session to resume or start
+	SessionOp         string        // list, fork, rename, delete or prune
 	SystemInstruction bool
 	Temp              float64
 	ThinkingLevel     genai.ThinkingLevel
@@ -48,10 +79,15 @@ type Parameters struct {
 	Tool              bool
 	ToolRegistry      ToolMap
 	TopP              float64
+	Trim              string // chat history trimming strategy
 	Unsafe            bool
+	Upscale           string // factor applied to the attached image
 	Verbose           bool
 	Version           bool
-	Walk              bool // used with FilePaths
+	Voice             string // prebuilt voice or speaker:voice pairs of -audio
+	Votes             int    // self-consistency samples
+	Walk              bool   // used with FilePaths
+	Workers           int    // concurrent batch requests
 }
 
 type Tool struct{}
@@ -92,6 +128,16 @@ func (a *ParamArray) Set(val string) error {
 	return nil
 }
 
+// Price is the cost in USD per million tokens of a model.
+type Price struct {
+	Input  float64
+	Output float64 // including thoughts
+	Cached float64
+}
+
+// PriceMap maps model names to prices.
+type PriceMap map[string]Price
+
 // ToolRegistry maps tool names to the session
 type ToolMap map[string]*mcp.ClientSession
 
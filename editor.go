@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const HistoryFile = "history.txt" // name of chat input history file in DotGenDir
+
+// historyLimit bounds the number of input lines kept in HistoryFile.
+const historyLimit = 500
+
+// multiLineMark starts and ends an explicit multi-line input.
+const multiLineMark = `"""`
+
+// lineEditor reads chat input. On a terminal, lines are edited with the
+// arrow keys, recalled from a persistent history and pastes are kept whole.
+// Otherwise, lines are read from a buffered reader without length limit.
+type lineEditor struct {
+	r       *bufio.Reader
+	term    *term.Terminal
+	fd      int // of a terminal put in raw mode while reading, or -1
+	history *inputHistory
+}
+
+// newLineEditor returns an editor reading from in.
+func newLineEditor(in io.Reader) *lineEditor {
+	f, ok := in.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return &lineEditor{r: bufio.NewReader(in), fd: -1}
+	}
+	// echo on stdout unless redirected
+	var out io.Writer = os.Stderr
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		out = os.Stdout
+	}
+	e := newTermEditor(struct {
+		io.Reader
+		io.Writer
+	}{f, out}, loadInputHistory())
+	e.fd = int(f.Fd())
+	if w, h, err := term.GetSize(e.fd); err == nil {
+		e.term.SetSize(w, h)
+	}
+	e.term.SetBracketedPasteMode(true)
+	return e
+}
+
+// newTermEditor returns an editor handling the terminal sequences of rw.
+func newTermEditor(rw io.ReadWriter, history *inputHistory) *lineEditor {
+	t := term.NewTerminal(rw, "")
+	t.History = history
+	return &lineEditor{term: t, fd: -1, history: history}
+}
+
+// close restores the terminal.
+func (e *lineEditor) close() {
+	if e.term != nil && e.fd >= 0 {
+		e.term.SetBracketedPasteMode(false)
+	}
+}
+
+// readLine returns the next line without its end of line, and io.EOF once
+// input is exhausted or on Ctrl-D or Ctrl-C. Pasted lines are reported with
+// term.ErrPasteIndicator.
+func (e *lineEditor) readLine() (string, error) {
+	if e.term == nil {
+		line, err := e.r.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+	if e.fd >= 0 {
+		if w, h, err := term.GetSize(e.fd); err == nil {
+			e.term.SetSize(w, h)
+		}
+		state, err := term.MakeRaw(e.fd)
+		if err != nil {
+			return "", err
+		}
+		defer term.Restore(e.fd, state)
+	}
+	return e.term.ReadLine()
+}
+
+// readInput returns the next prompt. Lines pasted at once are joined with
+// the line typed after them, and lines between two """ marks are joined too.
+// Single line prompts are added to the history.
+func (e *lineEditor) readInput() (string, error) {
+	var lines []string
+	line, err := e.readLine()
+	for errors.Is(err, term.ErrPasteIndicator) {
+		lines = append(lines, line)
+		line, err = e.readLine()
+	}
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(lines) > 0 {
+			return strings.Join(lines, "\n"), nil
+		}
+		return "", err
+	}
+	if len(lines) > 0 {
+		if line != "" {
+			lines = append(lines, line)
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+	if strings.TrimSpace(line) != multiLineMark {
+		e.remember(line)
+		return line, nil
+	}
+	for {
+		line, err = e.readLine()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && !errors.Is(err, term.ErrPasteIndicator) {
+			return "", err
+		}
+		if strings.TrimSpace(line) == multiLineMark {
+			break
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// remember adds line to the history, which the terminal does not do itself
+// so that the lines of a multi-line input are not recalled one by one.
+func (e *lineEditor) remember(line string) {
+	if e.history != nil && strings.TrimSpace(line) != "" {
+		e.history.add(line)
+	}
+}
+
+// inputHistory is the list of prompts recalled with the arrow keys, saved
+// in HistoryFile of the gen folder unless path is empty.
+type inputHistory struct {
+	entries []string // oldest first
+	path    string
+}
+
+// loadInputHistory reads the history saved in the gen folder, ignoring a
+// missing or unreadable file.
+func loadInputHistory() *inputHistory {
+	h := &inputHistory{}
+	dir, err := genDir()
+	if err != nil {
+		return h
+	}
+	h.path = filepath.Join(dir, HistoryFile)
+	data, err := os.ReadFile(h.path)
+	if err != nil || len(data) == 0 {
+		return h
+	}
+	h.entries = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(h.entries) > historyLimit {
+		h.entries = h.entries[len(h.entries)-historyLimit:]
+		os.WriteFile(h.path, []byte(strings.Join(h.entries, "\n")+"\n"), 0600)
+	}
+	return h
+}
+
+// Add is called by the terminal for each line read and does nothing, see
+// remember.
+func (h *inputHistory) Add(string) {}
+
+// Len returns the number of entries.
+func (h *inputHistory) Len() int {
+	return len(h.entries)
+}
+
+// At returns the entry idx, 0 being the most recent.
+func (h *inputHistory) At(idx int) string {
+	return h.entries[len(h.entries)-1-idx]
+}
+
+func (h *inputHistory) add(line string) {
+	if n := len(h.entries); n > 0 && h.entries[n-1] == line {
+		return
+	}
+	h.entries = append(h.entries, line)
+	if h.path == "" {
+		return
+	}
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	f.WriteString(line + "\n")
+	f.Close()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// TestReadLine tests user input in chat mode.
+func TestReadLine(t *testing.T) {
+	long := strings.Repeat("x", 100*1024)
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{input: "Hello, world!\n", want: []string{"Hello, world!"}},
+		{input: "\n", want: []string{""}},
+		{input: "first\r\nsecond", want: []string{"first", "second"}},
+		{input: long + "\nshort\n", want: []string{long, "short"}},
+	}
+
+	for _, test := range tests {
+		// successive reads share the buffered input
+		e := newLineEditor(iotest.HalfReader(strings.NewReader(test.input)))
+		for _, want := range test.want {
+			res, err := e.readLine()
+			if err != nil {
+				t.Fatalf("did not expect error %v", err)
+			}
+			if res != want {
+				t.Errorf("expected %.20q, got %.20q", want, res)
+			}
+		}
+		if _, err := e.readLine(); err != io.EOF {
+			t.Errorf("expected EOF, got %v", err)
+		}
+	}
+}
+
+func TestReadInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		term  bool
+		input string
+		want  []string
+	}{
+		{"lines", false, "one\n\ntwo\n", []string{"one", "", "two"}},
+		{"multi-line", false, "\"\"\"\nfunc f() {\n\n}\n\"\"\"\nnext\n", []string{"func f() {\n\n}", "next"}},
+		{"unterminated", false, "\"\"\"\na\nb", []string{"a\nb"}},
+		{"typed", true, "hello\r\x7fworld\r", []string{"hello", "world"}},
+		{"paste", true, "\x1b[200~first\r\rthird\r\x1b[201~note\r", []string{"first\n\nthird\nnote"}},
+		{"paste ending a line", true, "\x1b[200~first\rsecond\x1b[201~\r", []string{"first\nsecond"}},
+		{"recall", true, "hello\r\x1b[A!\r", []string{"hello", "hello!"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var e *lineEditor
+			if test.term {
+				e = newTermEditor(struct {
+					io.Reader
+					io.Writer
+				}{strings.NewReader(test.input), io.Discard}, &inputHistory{})
+			} else {
+				e = newLineEditor(strings.NewReader(test.input))
+			}
+			for _, want := range test.want {
+				res, err := e.readInput()
+				if err != nil {
+					t.Fatalf("did not expect error %v", err)
+				}
+				if res != want {
+					t.Errorf("expected %q, got %q", want, res)
+				}
+			}
+			if _, err := e.readInput(); err != io.EOF {
+				t.Errorf("expected EOF, got %v", err)
+			}
+		})
+	}
+}
+
+func TestInputHistory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	h := loadInputHistory()
+	for _, line := range []string{"a", "b", "b", "c"} {
+		h.add(line)
+	}
+	if h.Len() != 3 || h.At(0) != "c" || h.At(2) != "a" {
+		t.Errorf("unexpected history %v", h.entries)
+	}
+
+	dir, _ := genDir()
+	lines := strings.Repeat("line\n", historyLimit+10)
+	os.WriteFile(filepath.Join(dir, HistoryFile), []byte(lines+"last\n"), 0600)
+	if h = loadInputHistory(); h.Len() != historyLimit || h.At(0) != "last" {
+		t.Errorf("expected %d entries ending with last, got %d", historyLimit, h.Len())
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, HistoryFile)); strings.Count(string(data), "\n") != historyLimit {
+		t.Errorf("expected history file trimmed")
+	}
+}
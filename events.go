@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"sync"
+
+	"google.golang.org/genai"
+)
+
+// event is one line of the -ndjson output.
+type event struct {
+	Type         string                                      `json:"type"` // see emit* methods
+	Text         string                                      `json:"text,omitempty"`
+	ID           string                                      `json:"id,omitempty"`
+	Name         string                                      `json:"name,omitempty"`
+	Args         map[string]any                              `json:"args,omitempty"`
+	Response     map[string]any                              `json:"response,omitempty"`
+	Language     string                                      `json:"language,omitempty"`
+	Outcome      genai.Outcome                               `json:"outcome,omitempty"`
+	MIMEType     string                                      `json:"mimeType,omitempty"`
+	URI          string                                      `json:"uri,omitempty"`
+	Path         string                                      `json:"path,omitempty"`
+	FinishReason genai.FinishReason                          `json:"finishReason,omitempty"`
+	From         string                                      `json:"from,omitempty"`
+	Model        string                                      `json:"model,omitempty"`
+	Usage        *genai.GenerateContentResponseUsageMetadata `json:"usage,omitempty"`
+	Error        string                                      `json:"error,omitempty"`
+}
+
+// eventEmitter hands output over as events, by default written as newline-delimited JSON.
+type eventEmitter struct {
+	mu      sync.Mutex
+	send    func(event) error
+	outPath string // folder of inline images
+}
+
+func newEventEmitter(out io.Writer, outPath string) *eventEmitter {
+	enc := json.NewEncoder(out)
+	return &eventEmitter{send: func(ev event) error { return enc.Encode(ev) }, outPath: outPath}
+}
+
+func (e *eventEmitter) emit(ev event) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.send(ev)
+}
+
+// emitCandidate writes one event per part followed by the finish reason, if any.
+func (e *eventEmitter) emitCandidate(cand *genai.Candidate) error {
+	if cand == nil {
+		return nil
+	}
+	if cand.Content != nil {
+		if err := e.emitParts(cand.Content.Parts); err != nil {
+			return err
+		}
+	}
+	if cand.FinishReason != "" {
+		return e.emit(event{Type: "finish", FinishReason: cand.FinishReason})
+	}
+	return nil
+}
+
+func (e *eventEmitter) emitParts(parts []*genai.Part) error {
+	for _, p := range parts {
+		var ev event
+		switch {
+		case p.Thought && p.Text != "":
+			ev = event{Type: "thought", Text: p.Text}
+		case p.Text != "":
+			ev = event{Type: "text", Text: p.Text}
+		case p.FunctionCall != nil:
+			ev = event{Type: "functionCall", ID: p.FunctionCall.ID, Name: p.FunctionCall.Name, Args: p.FunctionCall.Args}
+		case p.FunctionResponse != nil:
+			ev = event{Type: "functionResponse", ID: p.FunctionResponse.ID, Name: p.FunctionResponse.Name, Response: p.FunctionResponse.Response}
+		case p.ExecutableCode != nil:
+			ev = event{Type: "code", Language: string(p.ExecutableCode.Language), Text: p.ExecutableCode.Code}
+		case p.CodeExecutionResult != nil:
+			ev = event{Type: "codeResult", Outcome: p.CodeExecutionResult.Outcome, Text: p.CodeExecutionResult.Output}
+		case p.FileData != nil:
+			ev = event{Type: "file", URI: p.FileData.FileURI, MIMEType: p.FileData.MIMEType}
+		case p.InlineData != nil:
+			path, err := e.saveInline(p.InlineData)
+			if err != nil {
+				return err
+			}
+			ev = event{Type: "inlineData", MIMEType: p.InlineData.MIMEType, Path: path}
+		default:
+			continue
+		}
+		if err := e.emit(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveInline writes inline data such as a generated image to a file
+// whose path is referenced by the event instead of the bytes.
+func (e *eventEmitter) saveInline(blob *genai.Blob) (string, error) {
+	ext := ".bin"
+	if exts, err := mime.ExtensionsByType(blob.MIMEType); err == nil && len(exts) > 0 {
+		ext = exts[len(exts)-1]
+	}
+	f, err := os.CreateTemp(e.outPath, "gen-*"+ext)
+	if err != nil {
+		return "", fmt.Errorf("saving %s: %v", blob.MIMEType, err)
+	}
+	defer f.Close()
+	if _, err := f.Write(blob.Data); err != nil {
+		return "", fmt.Errorf("saving %s: %v", blob.MIMEType, err)
+	}
+	return f.Name(), nil
+}
+
+// emitSaved refers to media saved at path rather than written to out.
+func (e *eventEmitter) emitSaved(mimeType, path string) error {
+	return e.emit(event{Type: "inlineData", MIMEType: mimeType, Path: path})
+}
+
+// hold keeps the events back until release is called, which sends them if
+// keep or discards them otherwise.
+func (e *eventEmitter) hold() (release func(keep bool) error) {
+	e.mu.Lock()
+	send := e.send
+	var held []event
+	e.send = func(ev event) error {
+		held = append(held, ev)
+		return nil
+	}
+	e.mu.Unlock()
+	return func(keep bool) error {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.send = send
+		if !keep {
+			return nil
+		}
+		for _, ev := range held {
+			if err := send(ev); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func (e *eventEmitter) emitUsage(model string, usage *genai.GenerateContentResponseUsageMetadata) error {
+	if usage == nil {
+		return nil
+	}
+	return e.emit(event{Type: "usage", Model: model, Usage: usage})
+}
+
+func (e *eventEmitter) emitError(err error) error {
+	return e.emit(event{Type: "error", Error: err.Error()})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+// readEvents decodes NDJSON output, failing on lines which are not events.
+func readEvents(t *testing.T, out string) []event {
+	t.Helper()
+	var events []event
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		var ev event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("invalid event line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+func eventTypes(events []event) string {
+	var types []string
+	for _, ev := range events {
+		types = append(types, ev.Type)
+	}
+	return strings.Join(types, ",")
+}
+
+func TestGenContent_Events(t *testing.T) {
+	thought := &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{
+		Content: &genai.Content{Role: "model", Parts: []*genai.Part{{Text: "hmm", Thought: true}}},
+	}}}
+	call := fakeReply{chunks: []*genai.GenerateContentResponse{{
+		Candidates: []*genai.Candidate{{
+			Content:      &genai.Content{Role: "model", Parts: []*genai.Part{genai.NewPartFromFunctionCall("ListGeminiModels", nil)}},
+			FinishReason: genai.FinishReasonStop,
+		}},
+	}}}
+	img := &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{
+		Content:      &genai.Content{Role: "model", Parts: []*genai.Part{{InlineData: &genai.Blob{MIMEType: "image/png", Data: []byte("\x89PNG")}}}},
+		FinishReason: genai.FinishReasonStop,
+	}}}
+	testCases := []struct {
+		name    string
+		args    []string
+		replies []fakeReply
+		types   string
+		wantErr bool
+	}{
+		{
+			name:    "text and thoughts",
+			args:    []string{"-ndjson", "-t", "hi"},
+			replies: []fakeReply{{chunks: append([]*genai.GenerateContentResponse{thought}, textReply("Hello", " world").chunks...)}},
+			types:   "thought,text,text,finish,usage",
+		},
+		{
+			name:    "tool loop",
+			args:    []string{"-ndjson", "-tool", "which models?"},
+			replies: []fakeReply{call, textReply("one model")},
+			types:   "functionCall,finish,functionResponse,text,finish,usage",
+		},
+		{
+			name:    "image",
+			args:    []string{"-ndjson", "-img", "draw"},
+			replies: []fakeReply{{chunks: []*genai.GenerateContentResponse{img}}},
+			types:   "inlineData,finish",
+		},
+		{
+			name:    "fallback",
+			args:    []string{"-ndjson", "-m", "a,b", "hi"},
+			replies: []fakeReply{{err: genai.APIError{Code: 429}}, textReply("ok")},
+			types:   "fallback,text,finish,usage",
+		},
+		{
+			name:    "schema repaired",
+			args:    []string{"-ndjson", "-json", "-repair", "1", "-schema", "name", "tea"},
+			replies: []fakeReply{textReply("{}"), textReply(`{"name":"tea"}`)},
+			types:   "text,finish,usage",
+		},
+		{
+			name:    "error",
+			args:    []string{"-ndjson", "hi"},
+			replies: []fakeReply{{err: genai.APIError{Code: 400, Message: "bad"}}},
+			types:   "error",
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("TMPDIR", t.TempDir())
+			fake := &fakeBackend{replies: tc.replies}
+			ctx := prepareTestContext(t, true, tc.args...)
+			params := ctx.Value(core.ParamsKey).(*core.Parameters)
+			params.Client = fake
+			params.OutRedirected = true
+			var output strings.Builder
+			if err := genContent(ctx, strings.NewReader(""), &output); (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			events := readEvents(t, output.String())
+			if got := eventTypes(events); got != tc.types {
+				t.Errorf("expected events %s, got %s", tc.types, got)
+			}
+			for _, ev := range events {
+				if ev.Type == "fallback" && (ev.From != "a" || ev.Model != "b" || ev.Error == "") {
+					t.Errorf("expected fallback from a to b, got %+v", ev)
+				}
+				if ev.Type == "text" && strings.Contains(tc.name, "schema") && ev.Text != `{"name":"tea"}` {
+					t.Errorf("expected repaired response only, got %q", ev.Text)
+				}
+				if ev.Type == "inlineData" {
+					if data, err := os.ReadFile(ev.Path); err != nil || string(data) != "\x89PNG" {
+						t.Errorf("expected image saved at %s, got %q, %v", ev.Path, data, err)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// ExportFormats lists the transcript formats of -sessions export.
+var ExportFormats = []string{"md", "html", "jsonl"}
+
+// exportStyle is the stylesheet of HTML transcripts.
+const exportStyle = `body{font-family:sans-serif;max-width:50em;margin:2em auto;padding:0 1em;line-height:1.5}
+h2{font-size:1em;margin:2em 0 .5em;color:#555;text-transform:uppercase}
+.text{white-space:pre-wrap}
+pre{background:#f4f4f4;padding:.5em;overflow-x:auto}
+details{color:#666;margin:.5em 0}
+img{max-width:100%}`
+
+// exportSessions writes the sessions to out in format, one JSON line per
+// session with jsonl.
+func exportSessions(out io.Writer, format string, sessions []*chatSession) error {
+	for _, s := range sessions {
+		var err error
+		switch format {
+		case "md":
+			err = exportMarkdown(out, s)
+		case "html":
+			err = exportHTML(out, s)
+		case "jsonl":
+			err = exportJSONL(out, s)
+		}
+		if err != nil {
+			return fmt.Errorf("exporting %s: %v", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// speaker names the author of c, a user content of function responses
+// standing for the functions.
+func speaker(c *genai.Content) string {
+	if slices.ContainsFunc(c.Parts, func(p *genai.Part) bool { return p.FunctionResponse != nil }) {
+		return "function"
+	}
+	if m := answeredBy(c); m != "" {
+		return c.Role + " " + m
+	}
+	return c.Role
+}
+
+func indentJSON(v any) string {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%+v", v)
+	}
+	return string(data)
+}
+
+// exportMarkdown writes the session as Markdown, thoughts collapsed and
+// inline data described rather than embedded.
+func exportMarkdown(out io.Writer, s *chatSession) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n*%s, %s, %s*\n", cmp.Or(s.Title, s.Name), s.Name, s.Model, s.Updated.Local().Format(time.DateTime))
+	prev := ""
+	for _, c := range transcript(s) {
+		if who := speaker(c); who != prev {
+			fmt.Fprintf(&b, "\n## %s\n", who)
+			prev = who
+		}
+		for _, p := range c.Parts {
+			b.WriteString("\n")
+			switch {
+			case p.Thought && p.Text != "":
+				fmt.Fprintf(&b, "<details><summary>thoughts</summary>\n\n%s\n\n</details>\n", strings.TrimSpace(p.Text))
+			case p.Text != "":
+				fmt.Fprintf(&b, "%s\n", strings.TrimSpace(p.Text))
+			case p.FunctionCall != nil:
+				fmt.Fprintf(&b, "Function call `%s`\n```json\n%s\n```\n", p.FunctionCall.Name, indentJSON(p.FunctionCall.Args))
+			case p.FunctionResponse != nil:
+				fmt.Fprintf(&b, "Function response `%s`\n```json\n%s\n```\n", p.FunctionResponse.Name, indentJSON(p.FunctionResponse.Response))
+			case p.ExecutableCode != nil:
+				fmt.Fprintf(&b, "```%s\n%s\n```\n", strings.ToLower(string(p.ExecutableCode.Language)), p.ExecutableCode.Code)
+			case p.CodeExecutionResult != nil:
+				fmt.Fprintf(&b, "```\n%s\n```\n", p.CodeExecutionResult.Output)
+			case p.FileData != nil:
+				fmt.Fprintf(&b, "[%s](%s)\n", cmp.Or(p.FileData.DisplayName, p.FileData.FileURI), p.FileData.FileURI)
+			case p.InlineData != nil:
+				fmt.Fprintf(&b, "*%s, %d bytes*\n", p.InlineData.MIMEType, len(p.InlineData.Data))
+			}
+		}
+	}
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// exportHTML writes the session as a self-contained HTML page, images and
+// audio inlined and thoughts collapsed.
+func exportHTML(out io.Writer, s *chatSession) error {
+	var b strings.Builder
+	esc := html.EscapeString
+	title := esc(cmp.Or(s.Title, s.Name))
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s\n</style>\n</head>\n<body>\n", title, exportStyle)
+	fmt.Fprintf(&b, "<h1>%s</h1>\n<p><em>%s, %s, %s</em></p>\n", title, esc(s.Name), esc(s.Model), s.Updated.Local().Format(time.DateTime))
+	prev := ""
+	for _, c := range transcript(s) {
+		if who := speaker(c); who != prev {
+			fmt.Fprintf(&b, "<h2>%s</h2>\n", esc(who))
+			prev = who
+		}
+		for _, p := range c.Parts {
+			switch {
+			case p.Thought && p.Text != "":
+				fmt.Fprintf(&b, "<details><summary>thoughts</summary><div class=\"text\">%s</div></details>\n", esc(strings.TrimSpace(p.Text)))
+			case p.Text != "":
+				fmt.Fprintf(&b, "<div class=\"text\">%s</div>\n", esc(strings.TrimSpace(p.Text)))
+			case p.FunctionCall != nil:
+				fmt.Fprintf(&b, "<p>Function call <code>%s</code></p>\n<pre>%s</pre>\n", esc(p.FunctionCall.Name), esc(indentJSON(p.FunctionCall.Args)))
+			case p.FunctionResponse != nil:
+				fmt.Fprintf(&b, "<details><summary>function response <code>%s</code></summary><pre>%s</pre></details>\n", esc(p.FunctionResponse.Name), esc(indentJSON(p.FunctionResponse.Response)))
+			case p.ExecutableCode != nil:
+				fmt.Fprintf(&b, "<pre>%s</pre>\n", esc(p.ExecutableCode.Code))
+			case p.CodeExecutionResult != nil:
+				fmt.Fprintf(&b, "<pre>%s</pre>\n", esc(p.CodeExecutionResult.Output))
+			case p.FileData != nil:
+				fmt.Fprintf(&b, "<p><a href=\"%s\">%s</a></p>\n", esc(p.FileData.FileURI), esc(cmp.Or(p.FileData.DisplayName, p.FileData.FileURI)))
+			case p.InlineData != nil:
+				mime := p.InlineData.MIMEType
+				src := fmt.Sprintf("data:%s;base64,%s", esc(mime), base64.StdEncoding.EncodeToString(p.InlineData.Data))
+				switch {
+				case strings.HasPrefix(mime, "image/"):
+					fmt.Fprintf(&b, "<p><img src=\"%s\" alt=\"%s\"></p>\n", src, esc(mime))
+				case strings.HasPrefix(mime, "audio/"):
+					fmt.Fprintf(&b, "<p><audio controls src=\"%s\"></audio></p>\n", src)
+				default:
+					fmt.Fprintf(&b, "<p><em>%s, %d bytes</em></p>\n", esc(mime), len(p.InlineData.Data))
+				}
+			}
+		}
+	}
+	b.WriteString("</body>\n</html>\n")
+	_, err := io.WriteString(out, b.String())
+	return err
+}
+
+// exportJSONL writes the session as one line of a Gemini supervised tuning
+// dataset, without thoughts, inline data and gen's part metadata.
+func exportJSONL(out io.Writer, s *chatSession) error {
+	var contents []*genai.Content
+	for _, c := range transcript(s) {
+		var parts []*genai.Part
+		for _, p := range c.Parts {
+			if p.Thought || p.InlineData != nil {
+				continue
+			}
+			parts = append(parts, &genai.Part{Text: p.Text, FunctionCall: p.FunctionCall, FunctionResponse: p.FunctionResponse,
+				FileData: p.FileData, ExecutableCode: p.ExecutableCode, CodeExecutionResult: p.CodeExecutionResult})
+		}
+		if len(parts) > 0 {
+			contents = append(contents, &genai.Content{Role: c.Role, Parts: parts})
+		}
+	}
+	data, err := json.Marshal(map[string]any{"contents": contents})
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"google.golang.org/genai"
+)
+
+func TestExportSession(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s := &chatSession{
+		Name:  "design",
+		Model: "m",
+		Archive: []*genai.Content{
+			{Role: "user", Parts: []*genai.Part{{Text: "which cache <policy>?"}}},
+			{Role: "model", Parts: []*genai.Part{{Text: "pondering", Thought: true}, {Text: "LRU", PartMetadata: map[string]any{ModelKey: "m"}}}},
+		},
+		History: []*genai.Content{
+			{Role: "user", Parts: []*genai.Part{{Text: "Summary of our conversation so far", PartMetadata: map[string]any{SummaryKey: true}}}},
+			{Role: "model", Parts: []*genai.Part{{Text: "Understood."}}},
+			{Role: "user", Parts: []*genai.Part{{Text: "draw it"}, {FileData: &genai.FileData{FileURI: "https://fake/spec.pdf"}}}},
+			{Role: "model", Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{Name: "Draw", Args: map[string]any{"shape": "box"}}}}},
+			{Role: "user", Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{Name: "Draw", Response: map[string]any{"ok": true}}}}},
+			{Role: "model", Parts: []*genai.Part{{InlineData: &genai.Blob{MIMEType: "image/png", Data: []byte("png")}}}},
+		},
+	}
+	if err := s.save(); err != nil {
+		t.Fatal(err)
+	}
+	export := func(args ...string) string {
+		ctx := prepareTestContext(t, true, append([]string{"-sessions", "export"}, args...)...)
+		var out strings.Builder
+		if err := runSessions(ctx, &out); err != nil {
+			t.Fatal(err)
+		}
+		return out.String()
+	}
+
+	md := export("md")
+	AssertOutput(t, md, OutputExpectations{Contains: []string{
+		"# which cache <policy>?", "## user\n\nwhich cache", "<details><summary>thoughts</summary>\n\npondering",
+		"## model m\n", "[https://fake/spec.pdf](https://fake/spec.pdf)", "Function call `Draw`", "\"shape\": \"box\"",
+		"## function\n", "*image/png, 3 bytes*",
+	}})
+	if strings.Contains(md, "Summary of our conversation") {
+		t.Errorf("expected archived turns in place of the summary")
+	}
+
+	AssertOutput(t, export("html", "design"), OutputExpectations{Contains: []string{
+		"<title>which cache &lt;policy&gt;?</title>", "<details><summary>thoughts</summary>",
+		`<img src="data:image/png;base64,cG5n"`, "function response <code>Draw</code>", "&#34;ok&#34;: true",
+	}})
+
+	lines := strings.Split(strings.TrimSpace(export("jsonl", "design", "design")), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected a line per session, got %d", len(lines))
+	}
+	var example struct{ Contents []*genai.Content }
+	if err := json.Unmarshal([]byte(lines[0]), &example); err != nil {
+		t.Fatal(err)
+	}
+	if len(example.Contents) != 5 || len(example.Contents[1].Parts) != 1 || example.Contents[1].Parts[0].PartMetadata != nil ||
+		example.Contents[3].Parts[0].FunctionCall == nil {
+		t.Errorf("unexpected tuning example %s", lines[0])
+	}
+
+	ctx := prepareTestContext(t, true, "-sessions", "export", "md", "missing")
+	if err := runSessions(ctx, &strings.Builder{}); err == nil {
+		t.Errorf("expected error exporting a missing session")
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var (
+	// fileNameRegex matches a relative file name with an extension.
+	fileNameRegex = regexp.MustCompile(`^[\w.\-/]+\.[A-Za-z]\w*$`)
+	// quotedNameRegex matches file names in backticks.
+	quotedNameRegex = regexp.MustCompile("`([\\w.\\-/]+\\.[A-Za-z]\\w*)`")
+	// langRegex matches fence languages usable as file extension.
+	langRegex = regexp.MustCompile(`^[a-z0-9+_-]+$`)
+)
+
+// langExts maps fence languages to file extensions, other languages being
+// used as extension when made of letters, digits, '+', '_' or '-'.
+var langExts = map[string]string{
+	"bash":       "sh",
+	"c++":        "cpp",
+	"csharp":     "cs",
+	"golang":     "go",
+	"javascript": "js",
+	"kotlin":     "kt",
+	"markdown":   "md",
+	"perl":       "pl",
+	"python":     "py",
+	"ruby":       "rb",
+	"rust":       "rs",
+	"shell":      "sh",
+	"text":       "txt",
+	"typescript": "ts",
+	"yaml":       "yml",
+	"zsh":        "sh",
+}
+
+// codeBlock is a fenced block of a response.
+type codeBlock struct {
+	name string // from the info string or the preceding line
+	lang string
+	code string
+}
+
+// codeExtractor writes the fenced code blocks of responses to files in dir.
+type codeExtractor struct {
+	dir       string
+	overwrite bool
+	count     int             // blocks seen, numbering unnamed ones
+	written   map[string]bool // files written in this run may be replaced
+	pending   []codeBlock
+}
+
+// feed collects the fenced blocks of the text of a model turn.
+func (x *codeExtractor) feed(text string) {
+	var block *codeBlock
+	var fence, prev string
+	var code strings.Builder
+	for _, line := range strings.SplitAfter(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if block == nil {
+			if f := fenceOf(trimmed); f != "" {
+				block = &codeBlock{}
+				fence = f
+				block.lang, block.name = parseInfo(strings.TrimSpace(trimmed[len(f):]))
+				if block.name == "" {
+					block.name = nameHint(prev)
+				}
+				code.Reset()
+			} else if trimmed != "" {
+				prev = trimmed
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			block.code = code.String()
+			x.pending = append(x.pending, *block)
+			block, prev = nil, ""
+			continue
+		}
+		code.WriteString(line)
+	}
+	if block != nil { // cut short
+		block.code = code.String()
+		x.pending = append(x.pending, *block)
+	}
+}
+
+// write saves the collected blocks and prints a summary to w, keeping
+// existing files unless overwrite is set.
+func (x *codeExtractor) write(w io.Writer) error {
+	blocks := x.pending
+	x.pending = nil
+	for _, b := range blocks {
+		x.count++
+		name := b.name
+		if name == "" || !filepath.IsLocal(name) {
+			name = fmt.Sprintf("%d.%s", x.count, langExt(b.lang))
+		}
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			fmt.Fprintf(w, "skipped %s, outside %s\n", name, x.dir)
+			continue
+		}
+		path := filepath.Join(x.dir, filepath.FromSlash(name))
+		if _, err := os.Stat(path); err == nil && !x.overwrite && !x.written[path] {
+			fmt.Fprintf(w, "skipped %s, file exists (use -overwrite)\n", path)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("creating folder for %s: %v", path, err)
+		}
+		if err := os.WriteFile(path, []byte(b.code), 0644); err != nil {
+			return fmt.Errorf("writing %s: %v", path, err)
+		}
+		x.written[path] = true
+		fmt.Fprintf(w, "wrote %s (%d lines)\n", path, strings.Count(b.code, "\n"))
+	}
+	return nil
+}
+
+// fenceOf returns the backticks or tildes opening a fenced block, if any.
+func fenceOf(line string) string {
+	for _, c := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, c))
+		if n >= 3 && (c == "~" || !strings.Contains(line[n:], "`")) {
+			return line[:n]
+		}
+	}
+	return ""
+}
+
+// parseInfo reads the language and file name of an info string such as
+// "go", "go main.go", "go:main.go", "python title=app.py" or "main.go".
+func parseInfo(info string) (string, string) {
+	fields := strings.Fields(info)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	lang, name, _ := strings.Cut(fields[0], ":")
+	if name == "" && fileNameRegex.MatchString(lang) {
+		name = lang
+		lang = strings.TrimPrefix(filepath.Ext(lang), ".")
+	}
+	for _, f := range fields[1:] {
+		if name != "" {
+			break
+		}
+		if key, val, ok := strings.Cut(f, "="); ok {
+			if key == "title" || key == "file" || key == "filename" {
+				name = strings.Trim(val, `"'`)
+			}
+		} else if fileNameRegex.MatchString(f) {
+			name = f
+		}
+	}
+	return strings.ToLower(lang), name
+}
+
+// nameHint finds a file name in the line preceding a fence, such as a
+// heading "### server/main.go", "**main.go**:" or "Save it as `main.go`:".
+func nameHint(line string) string {
+	if strings.HasSuffix(line, ":") {
+		if m := quotedNameRegex.FindAllStringSubmatch(line, -1); len(m) > 0 {
+			return m[len(m)-1][1]
+		}
+	}
+	isHeading := strings.HasPrefix(line, "#")
+	line = strings.Trim(line, "#*`: ")
+	if fileNameRegex.MatchString(line) {
+		return line
+	}
+	if isHeading {
+		fields := strings.Fields(line)
+		for i := len(fields) - 1; i >= 0; i-- {
+			if f := strings.Trim(fields[i], "*`:()"); fileNameRegex.MatchString(f) {
+				return f
+			}
+		}
+	}
+	return ""
+}
+
+// langExt returns the file extension of a fence language.
+func langExt(lang string) string {
+	if ext, ok := langExts[lang]; ok {
+		return ext
+	}
+	if langRegex.MatchString(lang) {
+		return lang
+	}
+	return "txt"
+}
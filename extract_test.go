@@ -0,0 +1,135 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jdevoo/gen/core"
+)
+
+func TestCodeExtractor(t *testing.T) {
+	response := "Here is the server:\n\n" +
+		"### server/main.go\n```go\npackage main\n\nfunc main() {}\n```\n" +
+		"Save this as `run.sh`:\n```bash\necho run\n```\n" +
+		"```python title=\"app.py\"\nprint('hi')\n```\n" +
+		"````markdown\n```go\nnested\n```\n````\n" +
+		"```\nplain\n```\n" +
+		"```../escape.go\nbad\n```\n" +
+		"```go\ncut short\n"
+	dir := t.TempDir()
+	x := &codeExtractor{dir: dir, written: map[string]bool{}}
+	x.feed(response)
+	var summary strings.Builder
+	if err := x.write(&summary); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"server/main.go": "package main\n\nfunc main() {}\n",
+		"run.sh":         "echo run\n",
+		"app.py":         "print('hi')\n",
+		"4.md":           "```go\nnested\n```\n",
+		"5.txt":          "plain\n",
+		"6.go":           "bad\n",
+		"7.go":           "cut short\n",
+	}
+	for name, content := range expected {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(data) != content {
+			t.Errorf("expected %s with %q, got %q, %v", name, content, data, err)
+		}
+	}
+	if n := strings.Count(summary.String(), "wrote "); n != len(expected) {
+		t.Errorf("expected %d files in summary, got %q", len(expected), summary.String())
+	}
+
+	// existing files are kept unless overwrite is set
+	x = &codeExtractor{dir: dir, written: map[string]bool{}}
+	x.feed("```sh run.sh\necho again\n```\n")
+	summary.Reset()
+	x.write(&summary)
+	if data, _ := os.ReadFile(filepath.Join(dir, "run.sh")); string(data) != "echo run\n" || !strings.Contains(summary.String(), "skipped") {
+		t.Errorf("expected run.sh kept, got %q, %q", data, summary.String())
+	}
+	x.overwrite = true
+	x.feed("```sh run.sh\necho again\n```\n")
+	x.write(&summary)
+	if data, _ := os.ReadFile(filepath.Join(dir, "run.sh")); string(data) != "echo again\n" {
+		t.Errorf("expected run.sh replaced, got %q", data)
+	}
+}
+
+func TestCodeExtractor_Escape(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "out")
+	x := &codeExtractor{dir: dir, written: map[string]bool{}}
+	x.feed("```x/../../evil\nboom\n```\n")
+	var summary strings.Builder
+	if err := x.write(&summary); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(parent, "evil")); err == nil {
+		t.Errorf("expected nothing written outside %s", dir)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "1.txt")); err != nil || string(data) != "boom\n" {
+		t.Errorf("expected 1.txt with the block, got %q, %v", data, err)
+	}
+}
+
+func TestLangExt(t *testing.T) {
+	testCases := map[string]string{
+		"":             "txt",
+		"python":       "py",
+		"c++":          "cpp",
+		"hcl":          "hcl",
+		"x/../../evil": "txt",
+		"..":           "txt",
+	}
+	for lang, ext := range testCases {
+		if got := langExt(lang); got != ext {
+			t.Errorf("%q: expected %q, got %q", lang, ext, got)
+		}
+	}
+}
+
+func TestParseInfo(t *testing.T) {
+	testCases := []struct {
+		info string
+		lang string
+		name string
+	}{
+		{"", "", ""},
+		{"Go", "go", ""},
+		{"go main.go", "go", "main.go"},
+		{"go:cmd/main.go", "go", "cmd/main.go"},
+		{"main.py", "py", "main.py"},
+		{"js {highlight} file=web/app.js", "js", "web/app.js"},
+		{"text 1.2", "text", ""},
+	}
+	for _, tc := range testCases {
+		lang, name := parseInfo(tc.info)
+		if lang != tc.lang || name != tc.name {
+			t.Errorf("%q: expected %q, %q, got %q, %q", tc.info, tc.lang, tc.name, lang, name)
+		}
+	}
+}
+
+func TestGenContent_Extract(t *testing.T) {
+	dir := t.TempDir()
+	fake := &fakeBackend{replies: []fakeReply{textReply("main.go:\n```go\n", "package main\n```\n")}}
+	ctx := prepareTestContext(t, true, "-extract", dir, "-f", filepath.Join("prompts", "codegen.prompt"))
+	params := ctx.Value(core.ParamsKey).(*core.Parameters)
+	params.Client = fake
+	params.OutRedirected = true
+	var output strings.Builder
+	if err := genContent(ctx, strings.NewReader(""), &output); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(output.String(), "package main") {
+		t.Errorf("expected response printed, got %q", output.String())
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "main.go")); err != nil || string(data) != "package main\n" {
+		t.Errorf("expected main.go extracted, got %q, %v", data, err)
+	}
+}
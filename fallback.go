@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// ModelKey is the part metadata key naming the model which answered a turn.
+const ModelKey = "model"
+
+// parseModels splits a comma separated list of models into the first one
+// and its fallbacks.
+func parseModels(list string) (string, []string) {
+	var models []string
+	for _, m := range strings.Split(list, ",") {
+		if m = strings.TrimSpace(m); m != "" {
+			models = append(models, m)
+		}
+	}
+	if len(models) == 0 {
+		return "", nil
+	}
+	return models[0], models[1:]
+}
+
+// isFallbackError reports whether err calls for the next model i.e. quota
+// exhausted or model unavailable, once retries are spent.
+func isFallbackError(err error) bool {
+	var apiErr genai.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Code {
+	case 404, 429, 500, 503:
+		return true
+	}
+	return false
+}
+
+// isFallbackFinish reports whether the model declined to answer.
+func isFallbackFinish(reason genai.FinishReason) bool {
+	return reason == genai.FinishReasonSafety || reason == genai.FinishReasonRecitation
+}
+
+// emitFallback reports that model failed with err and next takes over, as
+// an event with -ndjson.
+func (g *Generator) emitFallback(model, next string, err error) error {
+	if g.events != nil {
+		return g.events.emit(event{Type: "fallback", From: model, Model: next, Error: err.Error()})
+	}
+	fmt.Fprintf(os.Stderr, "%s: %v, falling back to %s\n", model, err, next)
+	return nil
+}
+
+// generateWithFallback sends contents to each model in turn until one answers
+// and returns the response along with the model which answered.
+func (g *Generator) generateWithFallback(contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, string, error) {
+	models := append([]string{g.params.GenModel}, g.params.Fallbacks...)
+	for k, model := range models {
+		last := k == len(models)-1
+		modelContents, modelConfig, err := g.fallbackRequest(model, contents, config)
+		if err != nil {
+			return nil, "", err
+		}
+		resp, err := g.client.GenerateContent(g.ctx, model, modelContents, modelConfig)
+		if err != nil {
+			if last || !isFallbackError(err) {
+				return nil, "", err
+			}
+			if err := g.emitFallback(model, models[k+1], err); err != nil {
+				return nil, "", err
+			}
+			continue
+		}
+		if !last && len(resp.Candidates) > 0 && isFallbackFinish(resp.Candidates[0].FinishReason) {
+			if err := g.emitFallback(model, models[k+1], fmt.Errorf("finished with %s", resp.Candidates[0].FinishReason)); err != nil {
+				return nil, "", err
+			}
+			continue
+		}
+		return resp, model, nil
+	}
+	return nil, "", fmt.Errorf("no model to generate content")
+}
+
+// answeredBy returns the model recorded on a model turn, if any.
+func answeredBy(c *genai.Content) string {
+	for _, p := range c.Parts {
+		if m, ok := p.PartMetadata[ModelKey].(string); ok {
+			return m
+		}
+	}
+	return ""
+}
+
+// withoutMetadata returns a copy of history stripped of the part metadata
+// gen keeps for itself, which Vertex AI rejects.
+func withoutMetadata(history []*genai.Content) []*genai.Content {
+	res := make([]*genai.Content, len(history))
+	for i, c := range history {
+		res[i] = c
+		if !slices.ContainsFunc(c.Parts, func(p *genai.Part) bool { return p.PartMetadata != nil }) {
+			continue
+		}
+		parts := make([]*genai.Part, len(c.Parts))
+		for j, p := range c.Parts {
+			cp := *p
+			cp.PartMetadata = nil
+			parts[j] = &cp
+		}
+		res[i] = &genai.Content{Role: c.Role, Parts: parts}
+	}
+	return res
+}
+
+// fallbackRequest returns contents and config for model. Fallback models get
+// neither the thinking config nor the cached content made for GenModel, the
+// cached system instruction and attachments being sent with the request.
+func (g *Generator) fallbackRequest(model string, contents []*genai.Content, config *genai.GenerateContentConfig) ([]*genai.Content, *genai.GenerateContentConfig, error) {
+	if model == g.params.GenModel || config == nil {
+		return contents, config, nil
+	}
+	c := *config
+	c.ThinkingConfig = nil
+	if c.CachedContent == "" {
+		return contents, &c, nil
+	}
+	c.CachedContent = ""
+	if len(g.cachedSys) > 0 {
+		c.SystemInstruction = &genai.Content{Parts: g.cachedSys}
+	}
+	if len(g.cachedParts) == 0 {
+		return contents, &c, nil
+	}
+	if err := g.resolveUploads(g.cachedParts); err != nil {
+		return nil, nil, err
+	}
+	return append([]*genai.Content{{Role: "user", Parts: g.cachedParts}}, contents...), &c, nil
+}
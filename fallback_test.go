@@ -0,0 +1,135 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+func TestGenContent_Fallback(t *testing.T) {
+	blocked := fakeReply{chunks: []*genai.GenerateContentResponse{{
+		Candidates: []*genai.Candidate{{FinishReason: genai.FinishReasonSafety}},
+	}}}
+	testCases := []struct {
+		name    string
+		models  string
+		replies []fakeReply
+		called  []string
+		wantErr bool
+	}{
+		{"quota", "a,b", []fakeReply{{err: genai.APIError{Code: 429}}, textReply("ok")}, []string{"a", "b"}, false},
+		{"safety", "a, b ,c", []fakeReply{blocked, textReply("ok")}, []string{"a", "b"}, false},
+		{"unavailable twice", "a,b,c", []fakeReply{{err: genai.APIError{Code: 503}}, {err: genai.APIError{Code: 404}}, textReply("ok")}, []string{"a", "b", "c"}, false},
+		{"bad request", "a,b", []fakeReply{{err: genai.APIError{Code: 400}}, textReply("ok")}, []string{"a"}, true},
+		{"last model", "a", []fakeReply{{err: genai.APIError{Code: 429}}}, []string{"a"}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			fake := &fakeBackend{replies: tc.replies}
+			ctx := prepareTestContext(t, true, "-m", tc.models, "-c", "hello")
+			params := ctx.Value(core.ParamsKey).(*core.Parameters)
+			params.Client = fake
+			params.OutRedirected = true
+			var output strings.Builder
+			err := genContent(ctx, iotest.OneByteReader(strings.NewReader("\n\n")), &output)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if !slices.Equal(fake.models, tc.called) {
+				t.Errorf("expected models %v, got %v", tc.called, fake.models)
+			}
+			if tc.wantErr {
+				return
+			}
+			session, err := loadSession("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			hist := session.History
+			if len(hist) != 2 || answeredBy(hist[1]) != tc.called[len(tc.called)-1] || hist[1].Parts[0].Text != "ok" {
+				t.Errorf("expected answer of %s in history, got %+v", tc.called[len(tc.called)-1], hist)
+			}
+		})
+	}
+}
+
+func TestGenContent_FallbackAfterOutput(t *testing.T) {
+	partial := []*genai.GenerateContentResponse{chunk("partial ", false)}
+	blocked := append(partial, &genai.GenerateContentResponse{
+		Candidates: []*genai.Candidate{{FinishReason: genai.FinishReasonSafety}},
+	})
+	testCases := []struct {
+		name    string
+		reply   fakeReply
+		wantErr bool
+	}{
+		{"quota", fakeReply{chunks: partial, err: genai.APIError{Code: 429}}, true},
+		{"safety", fakeReply{chunks: blocked}, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeBackend{replies: []fakeReply{tc.reply, textReply("ok")}}
+			ctx := prepareTestContext(t, true, "-m", "a,b", "hello")
+			params := ctx.Value(core.ParamsKey).(*core.Parameters)
+			params.Client = fake
+			params.OutRedirected = true
+			var output strings.Builder
+			err := genContent(ctx, strings.NewReader(""), &output)
+			if (err != nil) != tc.wantErr || !slices.Equal(fake.models, []string{"a"}) {
+				t.Errorf("expected no fall back after output, got %v and models %v", err, fake.models)
+			}
+			if strings.Contains(output.String(), "ok") {
+				t.Errorf("expected a single answer, got %q", output.String())
+			}
+		})
+	}
+}
+
+func TestFallbackRequest(t *testing.T) {
+	ctx := prepareTestContext(t, true, "-m", "a,b", "-think", "high", "hello")
+	ctx.Value(core.ParamsKey).(*core.Parameters).Client = &fakeBackend{}
+	g, err := newGenerator(ctx, strings.NewReader(""), &strings.Builder{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.cachedSys = []*genai.Part{{Text: "be brief"}}
+	g.cachedParts = []*genai.Part{{Text: "attached"}}
+	config := &genai.GenerateContentConfig{
+		CachedContent:  "cachedContents/1",
+		ThinkingConfig: &genai.ThinkingConfig{ThinkingLevel: genai.ThinkingLevelHigh},
+	}
+	contents := []*genai.Content{{Role: "user", Parts: []*genai.Part{{Text: "hello"}}}}
+
+	if c, cfg, _ := g.fallbackRequest("a", contents, config); len(c) != 1 || cfg != config {
+		t.Errorf("expected request of a unchanged")
+	}
+	c, cfg, err := g.fallbackRequest("b", contents, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.CachedContent != "" || cfg.ThinkingConfig != nil || cfg.SystemInstruction.Parts[0].Text != "be brief" {
+		t.Errorf("expected config of b without cache and thinking, got %+v", cfg)
+	}
+	if len(c) != 2 || c[0].Parts[0].Text != "attached" || config.CachedContent == "" {
+		t.Errorf("expected cached parts sent to b, got %+v", c)
+	}
+}
+
+func TestWithoutMetadata(t *testing.T) {
+	hist := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{Text: "hi"}}},
+		{Role: "model", Parts: []*genai.Part{{Text: "hello", PartMetadata: map[string]any{ModelKey: "m"}}}},
+	}
+	got := withoutMetadata(hist)
+	if got[0] != hist[0] || got[1].Parts[0].PartMetadata != nil || got[1].Parts[0].Text != "hello" {
+		t.Errorf("unexpected contents %+v", got)
+	}
+	if answeredBy(hist[1]) != "m" {
+		t.Errorf("expected history left untouched")
+	}
+}
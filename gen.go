@@ -2,25 +2,42 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"strings"
+	"time"
 
 	"github.com/jdevoo/gen/core"
 	"google.golang.org/genai"
 )
 
 type Generator struct {
-	ctx      context.Context
-	params   *core.Parameters
-	keyVals  core.ParamMap
-	client   *genai.Client
-	in       io.Reader
-	out      io.Writer
-	parts    []*genai.Part
-	sysParts []*genai.Part
-	schema   map[string]any
+	ctx          context.Context
+	params       *core.Parameters
+	keyVals      core.ParamMap
+	client       core.Backend
+	in           io.Reader
+	out          io.Writer
+	parts        []*genai.Part
+	sysParts     []*genai.Part
+	schema       map[string]any
+	prompts      []*genai.Part                               // parts kept out of a cache
+	uploads      *deferredUploads                            // with -cache
+	finishReason genai.FinishReason                          // of the last response
+	usage        *genai.GenerateContentResponseUsageMetadata // summed over turns
+	model        *genai.Model                                // GenModel details, fetched once
+	events       *eventEmitter                               // with -ndjson
+	history      []*genai.Content                            // prior turns of a served request
+	code         *codeExtractor                              // with -extract
+	cachedParts  []*genai.Part                               // attached parts moved into the cached content
+	cachedSys    []*genai.Part                               // system instruction moved into the cached content
+	cachedKey    string                                      // content hash of the cached content
+	cachedUntil  time.Time                                   // expiry of the cached content
+	attached     []*genai.Part                               // with /attach, sent along the next prompt
+	archive      []*genai.Content                            // turns summarized or trimmed
 }
 
 func genContent(ctx context.Context, in io.Reader, out io.Writer) error {
@@ -37,7 +54,11 @@ func genContent(ctx context.Context, in io.Reader, out io.Writer) error {
 	if err != nil {
 		return err
 	}
-	return g.run()
+	err = g.run()
+	if err != nil && g.events != nil {
+		g.events.emitError(err)
+	}
+	return err
 }
 
 func newGenerator(ctx context.Context, in io.Reader, out io.Writer) (*Generator, error) {
@@ -50,19 +71,26 @@ func newGenerator(ctx context.Context, in io.Reader, out io.Writer) (*Generator,
 		return nil, fmt.Errorf("missing keyVals")
 	}
 
-	client, err := genai.NewClient(ctx, nil)
+	client, err := backendFromContext(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Generator{
+	g := &Generator{
 		ctx:     ctx,
 		params:  params,
 		keyVals: keyVals,
 		client:  client,
 		in:      in,
 		out:     out,
-	}, nil
+	}
+	if params.NDJSON {
+		g.events = newEventEmitter(out, params.OutPath)
+	}
+	if params.ExtractPath != "" {
+		g.code = &codeExtractor{dir: params.ExtractPath, overwrite: params.Overwrite, written: map[string]bool{}}
+	}
+	return g, nil
 }
 
 func (g *Generator) run() error {
@@ -72,6 +100,14 @@ func (g *Generator) run() error {
 		}
 	}
 
+	if g.params.ImgModality && isImageModel(g.params.GenModel) {
+		return g.generateImages() // attached images are edited, not uploaded
+	}
+
+	if isVideoModel(g.params.GenModel) {
+		return g.generateVideos() // attached image is the first frame, not uploaded
+	}
+
 	if err := g.setPromptsAndFiles(); err != nil {
 		return err
 	}
@@ -80,9 +116,39 @@ func (g *Generator) run() error {
 		return g.saveEmbeddings() // exit after embeddings added
 	}
 
+	config, err := g.config()
+	if err != nil {
+		return err
+	}
+
+	if g.params.Votes > 1 {
+		return g.vote(config)
+	}
+
+	if g.params.AudioModality {
+		return g.generateSpeech(config)
+	}
+
+	if g.params.JSON && g.schema != nil && g.params.Candidates == 1 {
+		return g.generateValid(config)
+	}
+
+	return g.generateContent(config)
+}
+
+// config injects digest entries into prompts and returns the generation config.
+func (g *Generator) config() (*genai.GenerateContentConfig, error) {
+	var cached string
+	if g.params.CacheTTL > 0 {
+		var err error
+		if cached, err = g.cacheContent(); err != nil {
+			return nil, err
+		}
+	}
+
 	if len(g.params.DigestPaths) > 0 {
 		if err := g.searchDigests(); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
@@ -91,29 +157,25 @@ func (g *Generator) run() error {
 		TopP:        genai.Ptr(float32(g.params.TopP)),
 	}
 	if err := g.buildConfig(&config); err != nil {
-		return err
+		return nil, err
 	}
-
-	return g.generateContent(&config)
+	config.CachedContent = cached
+	return &config, nil
 }
 
 func (g *Generator) emitModelDetails() error {
-	backend := "GeminiAPI"
-	if g.client.ClientConfig().Backend == genai.BackendVertexAI {
-		backend = "VertexAI"
-	}
 	var m *genai.Model
 	var err error
 	if (g.params.Embed || len(g.params.DigestPaths) > 0) && !isFlagSet("m") {
-		m, err = g.client.Models.Get(g.ctx, g.params.EmbModel, nil)
+		m, err = g.client.GetModel(g.ctx, g.params.EmbModel)
 	} else {
-		m, err = g.client.Models.Get(g.ctx, g.params.GenModel, nil)
+		m, err = g.client.GetModel(g.ctx, g.params.GenModel)
 	}
 	if err != nil {
 		return err
 	}
 	fmt.Fprintf(os.Stderr, infos("%s backend | %s | %d/%d in/out token limit | %s\n\n"),
-		backend, m.Name, m.InputTokenLimit, m.OutputTokenLimit, g.params.ThinkingLevel)
+		g.client.Name(), m.Name, m.InputTokenLimit, m.OutputTokenLimit, g.params.ThinkingLevel)
 	return nil
 }
 
@@ -141,11 +203,18 @@ func (g *Generator) setPromptsAndFiles() error {
 			g.sysParts = append(g.sysParts, &genai.Part{Text: text})
 		} else {
 			g.parts = append(g.parts, &genai.Part{Text: text})
+			g.prompts = append(g.prompts, g.parts[len(g.parts)-1])
 		}
 	}
 
 	// handle files
 	if len(g.params.FilePaths) > 0 {
+		client := g.client
+		if g.params.CacheTTL > 0 {
+			// upload only if no cache matches
+			g.uploads = &deferredUploads{Wrapper: core.Wrapper{Backend: g.client}, paths: map[string]string{}}
+			client = g.uploads
+		}
 		for _, filePathVal := range g.params.FilePaths {
 			// case of redirect passed as file
 			if filePathVal == "-" {
@@ -158,23 +227,34 @@ func (g *Generator) setPromptsAndFiles() error {
 				continue
 			}
 			// case of regular file, json schema, .prompt, .sprompt or directory
-			if err = glob(g.ctx, g.client, filePathVal, &g.parts, &g.sysParts, &g.schema); err != nil {
+			n := len(g.parts)
+			if err = glob(g.ctx, client, filePathVal, &g.parts, &g.sysParts, &g.schema); err != nil {
 				return err
 			}
+			if path.Ext(filePathVal) == PExt {
+				g.prompts = append(g.prompts, g.parts[n:]...)
+			}
 		}
 		// stash URIs of FileData parts for removal
 		for _, p := range g.parts {
-			if p.FileData != nil {
+			if p.FileData != nil && !strings.HasPrefix(p.FileData.FileURI, cachePrefix) {
 				g.params.FileURIs = append(g.params.FileURIs, p.FileData.FileURI)
 			}
 		}
 	}
 
+	// schema derived from an example or field specs
+	if g.params.JSON && g.params.Schema != "" {
+		if g.schema, err = inferSchema(g.params.Schema); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
 func (g *Generator) saveEmbeddings() error {
-	res, err := g.client.Models.EmbedContent(g.ctx, g.params.EmbModel, []*genai.Content{{Parts: g.parts}}, nil)
+	res, err := g.client.EmbedContent(g.ctx, g.params.EmbModel, []*genai.Content{{Parts: g.parts}})
 	if err != nil {
 		return err
 	}
@@ -187,7 +267,7 @@ func (g *Generator) saveEmbeddings() error {
 func (g *Generator) searchDigests() error {
 	var res []QueryResult
 	for _, digestPathVal := range g.params.DigestPaths {
-		query, err := g.client.Models.EmbedContent(g.ctx, g.params.EmbModel, []*genai.Content{{Parts: g.parts}}, nil)
+		query, err := g.client.EmbedContent(g.ctx, g.params.EmbModel, []*genai.Content{{Parts: g.parts}})
 		if err != nil {
 			return err
 		}
@@ -214,6 +294,11 @@ func (g *Generator) buildConfig(config *genai.GenerateContentConfig) error {
 
 	if g.params.ImgModality {
 		config.ResponseModalities = []string{"TEXT", "IMAGE"}
+	} else if g.params.AudioModality {
+		config.ResponseModalities = []string{"AUDIO"}
+		if config.SpeechConfig, err = speechConfig(g.params.Voice); err != nil {
+			return err
+		}
 	} else {
 		config.ResponseModalities = []string{"TEXT"}
 	}
@@ -281,21 +366,34 @@ func (g *Generator) buildConfig(config *genai.GenerateContentConfig) error {
 	return nil
 }
 
+// print writes a to out unless the output is handed over as events.
+func (g *Generator) print(a ...any) {
+	if g.events == nil {
+		fmt.Fprint(g.out, a...)
+	}
+}
+
 func (g *Generator) generateContent(config *genai.GenerateContentConfig) error {
-	var chat *genai.Chat
 	var userAcc []*genai.Part
 	var modelAcc []*genai.Part
 	var err error
 
-	// retrieve previous session, if any
-	history := []*genai.Content{}
+	// resume chat session, if any
+	history := append([]*genai.Content{}, g.history...)
+	var session *chatSession
 	if g.params.ChatMode {
-		if err = retrieveHistory(&history); err != nil {
+		if session, err = loadSession(g.params.Session); err != nil {
 			return err
 		}
-		if len(history) > 0 {
-			fmt.Fprintf(g.out, important("%s found\n"), DotGen)
+		history = append(history, session.History...)
+		g.archive = session.Archive
+		if len(history) > 0 && g.events == nil {
+			fmt.Fprintf(g.out, important("session %s resumed\n"), session.Name)
 			if g.params.Verbose {
+				if len(g.archive) > 0 {
+					fmt.Fprintf(os.Stderr, infos("\n%d turns archived\n"), len(turns(g.archive)))
+					emitHistory(os.Stderr, g.archive)
+				}
 				emitHistory(os.Stderr, history)
 			}
 		}
@@ -311,13 +409,19 @@ func (g *Generator) generateContent(config *genai.GenerateContentConfig) error {
 		}
 	}
 
+	var editor *lineEditor
+	if g.params.ChatMode {
+		editor = newLineEditor(tty)
+		defer editor.close()
+	}
+
 	// main interaction loop
 	for {
-		chat, err = g.client.Chats.Create(g.ctx, g.params.GenModel, config, history)
-		if err != nil {
-			return err
-		}
-		if len(g.parts) > 0 {
+		if len(g.parts) > 0 && g.params.Candidates > 1 {
+			if history, err = g.generateCandidates(history, config, editor); err != nil {
+				return err
+			}
+		} else if len(g.parts) > 0 {
 			i := 0
 			userAcc = g.parts
 			streamAcc := []*genai.Part{}
@@ -326,47 +430,109 @@ func (g *Generator) generateContent(config *genai.GenerateContentConfig) error {
 			var textBuilder strings.Builder
 			var thoughtBuilder strings.Builder
 			var sig []byte
+			var usage *genai.GenerateContentResponseUsageMetadata
 			mp := &MarkdownParser{}
 
-			for resp, err := range chat.SendStream(g.ctx, userAcc...) {
+			turn := &genai.Content{Role: "user", Parts: userAcc}
+			if history, err = g.fitBudget(history, turn, config); err != nil {
+				return err
+			}
+			contents := append(withoutMetadata(history), turn)
+			models := append([]string{g.params.GenModel}, g.params.Fallbacks...)
+			var answered string
+			for k, model := range models {
+				var failure error
+				emitted := false // no fall back once part of the answer is out
+				modelContents, modelConfig, err := g.fallbackRequest(model, contents, config)
 				if err != nil {
-					fmt.Fprintf(g.out, "\n")
 					return err
 				}
-
-				if len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil {
-					for _, p := range resp.Candidates[0].Content.Parts {
-						if !isValidPart(p) {
-							continue
+				for resp, err := range g.client.GenerateContentStream(g.ctx, model, modelContents, modelConfig) {
+					if err != nil {
+						if k < len(models)-1 && !emitted && isFallbackError(err) {
+							failure = err
+							break
 						}
-						if p.Thought {
-							thoughtBuilder.WriteString(p.Text)
-							if len(p.ThoughtSignature) > 0 {
-								sig = p.ThoughtSignature
+						g.print("\n")
+						return err
+					}
+
+					if len(resp.Candidates) > 0 && resp.Candidates[0].Content != nil {
+						for _, p := range resp.Candidates[0].Content.Parts {
+							if !isValidPart(p) {
+								continue
+							}
+							if p.Thought {
+								thoughtBuilder.WriteString(p.Text)
+								if len(p.ThoughtSignature) > 0 {
+									sig = p.ThoughtSignature
+								}
+							} else if p.Text != "" {
+								textBuilder.WriteString(p.Text)
+							} else {
+								streamAcc = append(streamAcc, p)
 							}
-						} else if p.Text != "" {
-							textBuilder.WriteString(p.Text)
-						} else {
-							streamAcc = append(streamAcc, p)
 						}
 					}
-				}
 
-				for _, fc := range resp.FunctionCalls() {
-					fcMap[fc.Name] = fc
-				}
-				if len(fcMap) == 0 {
-					if len(resp.Candidates) > 0 {
-						err := emitCandidate(g.out, resp.Candidates[0], g.params.OutRedirected, g.params.ImgModality, g.params.Verbose, &i, mp, g.params.OutPath)
-						if err != nil {
-							fmt.Fprintf(g.out, "\n")
-							return err
+					if len(resp.Candidates) > 0 && resp.Candidates[0].FinishReason != "" {
+						g.finishReason = resp.Candidates[0].FinishReason
+					}
+					if resp.UsageMetadata != nil {
+						usage = resp.UsageMetadata
+					}
+					if k < len(models)-1 && !emitted && isFallbackFinish(g.finishReason) {
+						failure = fmt.Errorf("finished with %s", g.finishReason)
+						break
+					}
+
+					for _, fc := range resp.FunctionCalls() {
+						fcMap[fc.Name] = fc
+					}
+					if g.events != nil {
+						if len(resp.Candidates) > 0 {
+							if err := g.events.emitCandidate(resp.Candidates[0]); err != nil {
+								return err
+							}
+							emitted = true
+						}
+					} else if len(fcMap) == 0 {
+						if len(resp.Candidates) > 0 {
+							err := emitCandidate(g.out, resp.Candidates[0], g.params.OutRedirected, g.params.ImgModality, g.params.Verbose, &i, mp, g.params.OutPath)
+							if err != nil {
+								fmt.Fprintf(g.out, "\n")
+								return err
+							}
+							emitted = emitted || resp.Candidates[0].Content != nil && len(resp.Candidates[0].Content.Parts) > 0
 						}
 					}
-				}
 
-				if g.params.CountTokens && resp.UsageMetadata != nil {
-					TokenCount.Store(resp.UsageMetadata.TotalTokenCount)
+					if g.params.CountTokens && resp.UsageMetadata != nil {
+						TokenCount.Store(resp.UsageMetadata.TotalTokenCount)
+					}
+				}
+				g.usage = addUsage(g.usage, usage)
+				if failure == nil {
+					answered = model
+					break
+				}
+				// start the turn over on the next model
+				g.print(mp.flush(g.params.OutRedirected))
+				if err := g.emitFallback(model, models[k+1], failure); err != nil {
+					return err
+				}
+				i, mp, sig, usage = 0, &MarkdownParser{}, nil, nil
+				streamAcc = []*genai.Part{}
+				clear(fcMap)
+				textBuilder.Reset()
+				thoughtBuilder.Reset()
+			}
+			if g.params.Verbose {
+				fmt.Fprintf(os.Stderr, infos("[%s]\n"), answered)
+			}
+			if g.events != nil {
+				if err := g.events.emitUsage(answered, usage); err != nil {
+					return err
 				}
 			}
 
@@ -390,6 +556,10 @@ func (g *Generator) generateContent(config *genai.GenerateContentConfig) error {
 			if len(modelAcc) == 0 {
 				modelAcc = append(modelAcc, &genai.Part{Text: " "})
 			}
+			modelAcc[0].PartMetadata = map[string]any{ModelKey: answered}
+			if g.code != nil {
+				g.code.feed(textBuilder.String())
+			}
 
 			history = append(history, &genai.Content{
 				Role:  "user",
@@ -406,13 +576,17 @@ func (g *Generator) generateContent(config *genai.GenerateContentConfig) error {
 					return err
 				}
 				if len(resCand.Content.Parts) > 0 {
-					err := emitCandidate(g.out, resCand, g.params.OutRedirected, g.params.ImgModality, g.params.Verbose, &i, mp, g.params.OutPath)
+					if g.events != nil {
+						err = g.events.emitCandidate(resCand)
+					} else {
+						err = emitCandidate(g.out, resCand, g.params.OutRedirected, g.params.ImgModality, g.params.Verbose, &i, mp, g.params.OutPath)
+					}
 					if err != nil {
-						fmt.Fprintf(g.out, "\n")
+						g.print("\n")
 						return err
 					}
 					if mp != nil {
-						fmt.Fprint(g.out, mp.flush(g.params.OutRedirected))
+						g.print(mp.flush(g.params.OutRedirected))
 					}
 					// carry forward function response to next iteration
 					g.parts = append(g.parts, resCand.Content.Parts...)
@@ -421,7 +595,12 @@ func (g *Generator) generateContent(config *genai.GenerateContentConfig) error {
 			}
 
 			if mp != nil {
-				fmt.Fprint(g.out, mp.flush(g.params.OutRedirected))
+				g.print(mp.flush(g.params.OutRedirected))
+			}
+			if g.code != nil {
+				if err := g.code.write(os.Stderr); err != nil {
+					return err
+				}
 			}
 		}
 
@@ -430,30 +609,54 @@ func (g *Generator) generateContent(config *genai.GenerateContentConfig) error {
 			break
 		}
 
-		input, err := readLine(tty)
+		input, err := editor.readInput()
+		if errors.Is(err, io.EOF) {
+			break // exit chat mode
+		}
 		if err != nil {
 			return err
 		}
 		// check for double blank line
 		if input == "" {
-			input, err = readLine(tty)
+			input, err = editor.readInput()
+			if errors.Is(err, io.EOF) || err == nil && input == "" {
+				break // exit chat mode
+			}
 			if err != nil {
 				return err
 			}
-			if input == "" {
-				break // exit chat mode
+		}
+		if isChatCommand(input) {
+			exit, err := g.chatCommand(input, config, &history, session)
+			if err != nil {
+				return err
 			}
+			if exit {
+				break
+			}
+			continue
 		}
-		if g.params.OutRedirected {
+		input = strings.TrimPrefix(input, "/") // escaped with //
+		if g.params.OutRedirected && g.events == nil {
 			fmt.Fprintf(g.out, "\n%s\n\n", input)
 		}
 
+		// a chat may outlive its cache
+		if err := g.renewCache(config); err != nil {
+			return err
+		}
+		g.parts = append(g.parts, g.attached...)
 		g.parts = append(g.parts, &genai.Part{Text: input})
+		g.attached = nil
 	} // end main interaction loop
-
-	if g.params.ChatMode {
-		if err = persistChat(history); err != nil {
-			fmt.Fprintf(g.out, "\n")
+	g.history = history
+
+	if session != nil {
+		session.History = history
+		session.Archive = g.archive
+		session.Model = g.params.GenModel
+		if err = session.save(); err != nil {
+			g.print("\n")
 			return err
 		}
 	}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+// UpscaleFactors lists the values of -upscale.
+var UpscaleFactors = []string{"x2", "x3", "x4"}
+
+// isImageModel reports whether model is served through GenerateImages
+// rather than GenerateContent, as Imagen models are.
+func isImageModel(model string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(model, "models/"), "imagen")
+}
+
+// generateImages generates images from the prompt, or edits or upscales the
+// images attached with -f, using an image generation model.
+func (g *Generator) generateImages() error {
+	images, prompt, err := g.mediaInputs()
+	if err != nil {
+		return err
+	}
+
+	imager, ok := core.As[core.ImageGenerator](g.client)
+	if !ok {
+		return core.Unsupported(g.client, "image generation models")
+	}
+	var generated []*genai.GeneratedImage
+	switch {
+	case g.params.Upscale != "":
+		if len(images) != 1 {
+			return fmt.Errorf("upscaling needs one image attached with -f, got %d", len(images))
+		}
+		res, err := imager.UpscaleImage(g.ctx, g.params.GenModel, images[0], g.params.Upscale, &genai.UpscaleImageConfig{})
+		if err != nil {
+			return err
+		}
+		generated = res.GeneratedImages
+	case len(images) > 0:
+		config := &genai.EditImageConfig{
+			NumberOfImages: int32(g.params.Candidates),
+			AspectRatio:    g.params.AspectRatio,
+			NegativePrompt: g.params.NegativePrompt,
+		}
+		var refs []genai.ReferenceImage
+		for n, img := range images {
+			refs = append(refs, genai.NewRawReferenceImage(img, int32(n+1)))
+		}
+		if g.params.MaskPath != "" {
+			mask, err := loadImage(g.params.MaskPath)
+			if err != nil {
+				return err
+			}
+			refs = append(refs, genai.NewMaskReferenceImage(mask, int32(len(refs)+1),
+				&genai.MaskReferenceConfig{MaskMode: genai.MaskReferenceModeMaskModeUserProvided}))
+			config.EditMode = genai.EditModeInpaintInsertion
+		}
+		res, err := imager.EditImage(g.ctx, g.params.GenModel, prompt, refs, config)
+		if err != nil {
+			return err
+		}
+		generated = res.GeneratedImages
+	default:
+		res, err := imager.GenerateImages(g.ctx, g.params.GenModel, prompt, &genai.GenerateImagesConfig{
+			NumberOfImages: int32(g.params.Candidates),
+			AspectRatio:    g.params.AspectRatio,
+			NegativePrompt: g.params.NegativePrompt,
+		})
+		if err != nil {
+			return err
+		}
+		generated = res.GeneratedImages
+	}
+	return g.emitGeneratedImages(generated)
+}
+
+// mediaInputs loads the images attached with -f and joins the texts of the
+// other prompts and prompt files into a single prompt.
+func (g *Generator) mediaInputs() ([]*genai.Image, string, error) {
+	var images []*genai.Image
+	var others core.ParamArray
+	for _, path := range g.params.FilePaths {
+		if ext := filepath.Ext(path); path == "-" || ext == PExt || ext == SPExt {
+			others = append(others, path)
+			continue
+		}
+		img, err := loadImage(path)
+		if err != nil {
+			return nil, "", err
+		}
+		images = append(images, img)
+	}
+	filePaths := g.params.FilePaths
+	g.params.FilePaths = others
+	err := g.setPromptsAndFiles()
+	g.params.FilePaths = filePaths
+	if err != nil {
+		return nil, "", err
+	}
+	var texts []string
+	for _, p := range append(g.sysParts, g.parts...) {
+		if p.Text != "" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return images, strings.Join(texts, "\n"), nil
+}
+
+// emitGeneratedImages writes the first image to stdout when redirected,
+// otherwise saves each image as gen-<time>-<n> in -out or the temp folder
+// and renders it via sixel.
+func (g *Generator) emitGeneratedImages(generated []*genai.GeneratedImage) error {
+	prefix := "gen-" + time.Now().Format("20060102-150405")
+	n := 0
+	for _, gi := range generated {
+		if gi.Image == nil || len(gi.Image.ImageBytes) == 0 {
+			if gi.RAIFilteredReason != "" {
+				fmt.Fprintf(os.Stderr, "image filtered: %s\n", gi.RAIFilteredReason)
+			}
+			continue
+		}
+		n++
+		if g.params.OutRedirected && g.events == nil {
+			if n == 1 { // output first image only
+				if _, err := g.out.Write(gi.Image.ImageBytes); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		path, err := saveImage(g.params.OutPath, fmt.Sprintf("%s-%d", prefix, n), gi.Image)
+		if err != nil {
+			return err
+		}
+		if g.events != nil {
+			mimeType := gi.Image.MIMEType
+			if mimeType == "" {
+				mimeType = http.DetectContentType(gi.Image.ImageBytes)
+			}
+			if err := g.events.emitSaved(mimeType, path); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Fprintf(g.out, infos("%s")+"\n", path)
+		img, _, err := image.Decode(bytes.NewReader(gi.Image.ImageBytes))
+		if err != nil {
+			continue // saved but not rendered
+		}
+		senc := SixelEncoder(g.out)
+		senc.Dither = true
+		if err := senc.Encode(img); err != nil {
+			return fmt.Errorf("emitting image: %v", err)
+		}
+		fmt.Fprint(g.out, "\n")
+	}
+	if n == 0 {
+		return fmt.Errorf("no image generated")
+	}
+	return nil
+}
+
+// saveImage writes img to dir, the temp folder if empty, under name with the
+// extension of its MIME type, never replacing an existing file.
+func saveImage(dir string, name string, img *genai.Image) (string, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	mimeType := img.MIMEType
+	if mimeType == "" {
+		mimeType = http.DetectContentType(img.ImageBytes)
+	}
+	ext := ".png"
+	if exts, err := mime.ExtensionsByType(mimeType); err == nil && len(exts) > 0 {
+		ext = exts[len(exts)-1]
+	}
+	path := filepath.Join(dir, name+ext)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", fmt.Errorf("saving image: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(img.ImageBytes); err != nil {
+		return "", fmt.Errorf("saving image: %v", err)
+	}
+	return path, nil
+}
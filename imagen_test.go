@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+// pngBytes encodes a blank image of the given width.
+func pngBytes(t *testing.T, width int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestGenContent_Imagen(t *testing.T) {
+	dir := t.TempDir()
+	photo := filepath.Join(dir, "photo.png")
+	mask := filepath.Join(dir, "mask.png")
+	os.WriteFile(photo, pngBytes(t, 1), 0644)
+	os.WriteFile(mask, pngBytes(t, 1), 0644)
+	images := []*genai.GeneratedImage{
+		{Image: &genai.Image{ImageBytes: pngBytes(t, 2), MIMEType: "image/png"}},
+		{RAIFilteredReason: "filtered"},
+		{Image: &genai.Image{ImageBytes: pngBytes(t, 3), MIMEType: "image/png"}},
+	}
+
+	testCases := []struct {
+		name       string
+		args       []string
+		redirected bool
+		call       string
+		files      int
+		refs       int
+	}{
+		{"generate", []string{"-n", "3", "-aspect", "16:9", "-negative", "dogs", "a cat"}, false, "generate:a cat", 2, 0},
+		{"generate redirected", []string{"a cat"}, true, "generate:a cat", 0, 0},
+		{"edit with mask", []string{"-f", photo, "-mask", mask, "add a hat"}, false, "edit:add a hat", 2, 2},
+		{"upscale", []string{"-upscale", "x2", "-f", photo}, false, "upscale:x2", 1, 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := t.TempDir()
+			fake := &fakeBackend{images: images}
+			args := []string{"-img", "-m", "imagen-4.0-generate-001"}
+			if !tc.redirected {
+				args = append(args, "-out", out)
+			}
+			ctx := prepareTestContext(t, true, append(args, tc.args...)...)
+			params := ctx.Value(core.ParamsKey).(*core.Parameters)
+			params.Client = fake
+			params.OutRedirected = tc.redirected
+			var output bytes.Buffer
+			if err := genContent(ctx, strings.NewReader(""), &output); err != nil {
+				t.Fatal(err)
+			}
+			if len(fake.calls) != 1 || fake.calls[0] != tc.call {
+				t.Errorf("expected %s, got %v", tc.call, fake.calls)
+			}
+			if len(fake.refs) != tc.refs {
+				t.Errorf("expected %d reference images, got %d", tc.refs, len(fake.refs))
+			}
+			if tc.redirected {
+				if !bytes.Equal(output.Bytes(), images[0].Image.ImageBytes) {
+					t.Errorf("expected first image on stdout")
+				}
+				return
+			}
+			entries, _ := os.ReadDir(out)
+			if len(entries) != tc.files {
+				t.Fatalf("expected %d files, got %v", tc.files, entries)
+			}
+			for n, e := range entries {
+				if !regexp.MustCompile(`^gen-\d{8}-\d{6}-\d\.png$`).MatchString(e.Name()) || !strings.Contains(output.String(), e.Name()) {
+					t.Errorf("unexpected file %d %s", n, e.Name())
+				}
+			}
+		})
+	}
+}
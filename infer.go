@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/jdevoo/gen/core"
+)
+
+// specKinds maps the type names of field specs, in Go or JSON schema
+// spelling, to the kinds understood by goTypeToGenAIType.
+var specKinds = map[string]reflect.Kind{
+	"string":  reflect.String,
+	"int":     reflect.Int,
+	"int64":   reflect.Int64,
+	"integer": reflect.Int,
+	"float64": reflect.Float64,
+	"number":  reflect.Float64,
+	"bool":    reflect.Bool,
+	"boolean": reflect.Bool,
+}
+
+// runSchema writes the schema derived from -schema, stdin being read for -.
+func runSchema(ctx context.Context, in io.Reader, out io.Writer) error {
+	params, ok := ctx.Value(core.ParamsKey).(*core.Parameters)
+	if !ok {
+		return fmt.Errorf("missing params")
+	}
+	var schema map[string]any
+	var err error
+	if params.Schema == "-" {
+		var data []byte
+		if data, err = io.ReadAll(in); err == nil {
+			schema, err = exampleSchema(data)
+		}
+	} else {
+		schema, err = inferSchema(params.Schema)
+	}
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(schema)
+}
+
+// inferSchema derives a JSON schema from a file of example documents, an
+// inline JSON example or comma separated field specs.
+func inferSchema(spec string) (map[string]any, error) {
+	if info, err := os.Stat(spec); err == nil && !info.IsDir() {
+		data, err := os.ReadFile(spec)
+		if err != nil {
+			return nil, fmt.Errorf("reading file %s: %v", spec, err)
+		}
+		return exampleSchema(data)
+	}
+	if s := strings.TrimSpace(spec); strings.HasPrefix(s, "{") || strings.HasPrefix(s, "[") {
+		return exampleSchema([]byte(s))
+	}
+	return specSchema(spec)
+}
+
+// exampleSchema infers the schema of one or more concatenated JSON documents,
+// properties missing from some of them being optional.
+func exampleSchema(data []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var docs []any
+	for {
+		var v any
+		err := dec.Decode(&v)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid example: %v", err)
+		}
+		docs = append(docs, v)
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("no example document")
+	}
+	return valuesSchema(docs), nil
+}
+
+// valuesSchema infers the schema matching all values. Integers seen along
+// numbers become numbers, nulls make the schema nullable and values of
+// different types yield an anyOf.
+func valuesSchema(values []any) map[string]any {
+	byKind := map[string][]any{}
+	nullable := false
+	for _, v := range values {
+		kind := kindOf(v)
+		if kind == "null" {
+			nullable = true
+			continue
+		}
+		byKind[kind] = append(byKind[kind], v)
+	}
+	if ints, ok := byKind["integer"]; ok && byKind["number"] != nil {
+		byKind["number"] = append(byKind["number"], ints...)
+		delete(byKind, "integer")
+	}
+
+	var variants []any
+	for _, kind := range slices.Sorted(maps.Keys(byKind)) {
+		variants = append(variants, kindSchema(kind, byKind[kind]))
+	}
+	var schema map[string]any
+	switch len(variants) {
+	case 0:
+		schema = map[string]any{}
+	case 1:
+		schema = variants[0].(map[string]any)
+	default:
+		schema = map[string]any{"anyOf": variants}
+	}
+	if nullable {
+		schema["nullable"] = true
+	}
+	return schema
+}
+
+// kindSchema infers the schema of values of the same JSON type.
+func kindSchema(kind string, values []any) map[string]any {
+	schema := map[string]any{"type": kind}
+	switch kind {
+	case "array":
+		var items []any
+		for _, v := range values {
+			items = append(items, v.([]any)...)
+		}
+		if len(items) > 0 {
+			schema["items"] = valuesSchema(items)
+		}
+	case "object":
+		fields := map[string][]any{}
+		for _, v := range values {
+			for k, field := range v.(map[string]any) {
+				fields[k] = append(fields[k], field)
+			}
+		}
+		props := map[string]any{}
+		var required []any
+		for _, k := range slices.Sorted(maps.Keys(fields)) {
+			props[k] = valuesSchema(fields[k])
+			if len(fields[k]) == len(values) {
+				required = append(required, k)
+			}
+		}
+		schema["properties"] = props
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+	}
+	return schema
+}
+
+// specSchema builds an object schema from field specs such as
+// "name,tags:[]string,price:float64,notes?:string". Fields are strings
+// unless typed and required unless marked with ? or a pointer type.
+func specSchema(spec string) (map[string]any, error) {
+	props := map[string]any{}
+	var required []any
+	for _, field := range strings.Split(spec, ",") {
+		name, typ, _ := strings.Cut(strings.TrimSpace(field), ":")
+		name, optional := strings.CutSuffix(strings.TrimSpace(name), "?")
+		if name == "" {
+			return nil, fmt.Errorf("missing field name in '%s'", field)
+		}
+		if _, found := props[name]; found {
+			return nil, fmt.Errorf("duplicate field '%s'", name)
+		}
+		typ = strings.TrimSpace(typ)
+		if typ == "" {
+			typ = "string"
+		}
+		schema, err := typeSchema(typ)
+		if err != nil {
+			return nil, fmt.Errorf("field '%s': %v", name, err)
+		}
+		props[name] = schema
+		if !optional && !strings.HasPrefix(typ, "*") {
+			required = append(required, name)
+		}
+	}
+	schema := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema, nil
+}
+
+// typeSchema maps a Go type expression of basic types, slices, pointers and
+// string keyed maps to a schema.
+func typeSchema(typ string) (map[string]any, error) {
+	switch {
+	case strings.HasPrefix(typ, "*"):
+		schema, err := typeSchema(typ[1:])
+		if err != nil {
+			return nil, err
+		}
+		schema["nullable"] = true
+		return schema, nil
+	case strings.HasPrefix(typ, "[]"):
+		items, err := typeSchema(typ[2:])
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "array", "items": items}, nil
+	case strings.HasPrefix(typ, "map[string]"):
+		values, err := typeSchema(strings.TrimPrefix(typ, "map[string]"))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "object", "additionalProperties": values}, nil
+	}
+	kind, ok := specKinds[strings.ToLower(typ)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported type: %s", typ)
+	}
+	genaiType, err := goTypeToGenAIType(kind)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"type": strings.ToLower(string(genaiType))}, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jdevoo/gen/core"
+)
+
+func TestInferSchema(t *testing.T) {
+	example := filepath.Join(t.TempDir(), "example.json")
+	os.WriteFile(example, []byte(`{"name":"tea","price":2,"tags":["hot"],"notes":null}
+{"name":"cake","price":3.5,"tags":[],"size":"L"}`), 0644)
+	testCases := []struct {
+		name     string
+		spec     string
+		expected string
+		wantErr  bool
+	}{
+		{"example file", example, `{"properties":{"name":{"type":"string"},"notes":{"nullable":true},"price":{"type":"number"},"size":{"type":"string"},"tags":{"items":{"type":"string"},"type":"array"}},"required":["name","price","tags"],"type":"object"}`, false},
+		{"inline nested", `{"items":[{"id":1,"ok":true},{"id":2}]}`, `{"properties":{"items":{"items":{"properties":{"id":{"type":"integer"},"ok":{"type":"boolean"}},"required":["id"],"type":"object"},"type":"array"}},"required":["items"],"type":"object"}`, false},
+		{"mixed types", `[1,"one",null]`, `{"items":{"anyOf":[{"type":"integer"},{"type":"string"}],"nullable":true},"type":"array"}`, false},
+		{"field specs", "name, tags:[]string, price:float64, count:*int, notes?:string, attrs:map[string]bool", `{"properties":{"attrs":{"additionalProperties":{"type":"boolean"},"type":"object"},"count":{"nullable":true,"type":"integer"},"name":{"type":"string"},"notes":{"type":"string"},"price":{"type":"number"},"tags":{"items":{"type":"string"},"type":"array"}},"required":["name","tags","price","attrs"],"type":"object"}`, false},
+		{"unsupported type", "when:time.Time", "", true},
+		{"duplicate field", "name,name:int", "", true},
+		{"invalid example", `{"name":`, "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			schema, err := inferSchema(tc.spec)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if tc.wantErr {
+				return
+			}
+			if got := jsonString(schema); got != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestRunSchema(t *testing.T) {
+	ctx := prepareTestContext(t, false, "-schema", "-")
+	var output strings.Builder
+	if err := runSchema(ctx, strings.NewReader(`{"a":[1.5]}`), &output); err != nil {
+		t.Fatal(err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal([]byte(output.String()), &schema); err != nil || !strings.Contains(output.String(), "\n  ") {
+		t.Errorf("expected indented schema, got %q, %v", output.String(), err)
+	}
+	if violations := validateJSON(`{"a":[2]}`, schema); len(violations) > 0 {
+		t.Errorf("expected example to validate, got %v", violations)
+	}
+}
+
+func TestGenContent_InferredSchema(t *testing.T) {
+	fake := &fakeBackend{replies: []fakeReply{textReply(`{"name":"tea"}`)}}
+	ctx := prepareTestContext(t, true, "-json", "-schema", "name,tags?:[]string", "tea")
+	params := ctx.Value(core.ParamsKey).(*core.Parameters)
+	params.Client = fake
+	params.OutRedirected = true
+	var output strings.Builder
+	if err := genContent(ctx, strings.NewReader(""), &output); err != nil {
+		t.Fatal(err)
+	}
+	schema, ok := fake.configs[0].ResponseJsonSchema.(map[string]any)
+	if !ok || jsonString(schema["required"]) != `["name"]` {
+		t.Errorf("expected derived schema in config, got %+v", fake.configs[0].ResponseJsonSchema)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"image"
 	"io"
+	"mime"
 	"net/http"
 	"os"
 	"path"
@@ -38,15 +39,6 @@ func isRedirected(stream any) bool {
 	return fileInfo.Mode()&os.ModeCharDevice == 0
 }
 
-// readLine reads a line from standard input on Linux, Mac or Windows.
-func readLine(r io.Reader) (string, error) {
-	scanner := bufio.NewScanner(r)
-	if scanner.Scan() {
-		return scanner.Text(), nil
-	}
-	return "", scanner.Err()
-}
-
 // isEmpty `out` was already used.
 func isEmpty(out io.Writer) bool {
 	if f, ok := out.(*os.File); ok {
@@ -219,6 +211,21 @@ func emitInlineData(out io.Writer, part *genai.Part, outRedirected bool, idx *in
 		}
 		return nil
 	}
+	if strings.HasPrefix(part.InlineData.MIMEType, "audio") {
+		path, err := saveAudio(outPath, part.InlineData)
+		if err != nil {
+			return err
+		}
+		if outRedirected {
+			fmt.Fprintf(out, "%s\n", path)
+		} else {
+			fmt.Fprintf(out, infos("%s")+"\n", path)
+		}
+		if idx != nil {
+			*idx++
+		}
+		return nil
+	}
 	if !strings.HasPrefix(part.InlineData.MIMEType, "image") {
 		return fmt.Errorf("emitContent of type %s: not supported", part.InlineData.MIMEType)
 	}
@@ -267,13 +274,17 @@ func emitHistory(out io.Writer, hist []*genai.Content) {
 	var prev string
 	fmt.Fprint(out, "\nHISTORY START\n")
 	for _, c := range hist {
-		if prev != c.Role {
+		role := c.Role
+		if m := answeredBy(c); m != "" {
+			role += " " + m
+		}
+		if prev != role {
 			if !isRedirected(out) {
-				fmt.Fprintf(out, "\n"+roles("%s")+"\n", c.Role)
+				fmt.Fprintf(out, "\n"+roles("%s")+"\n", role)
 			} else {
-				fmt.Fprintf(out, "\n<%s>\n", c.Role)
+				fmt.Fprintf(out, "\n<%s>\n", role)
 			}
-			prev = c.Role
+			prev = role
 		}
 		emitContent(out, c, false, false, true, nil, nil, "")
 	}
@@ -282,8 +293,12 @@ func emitHistory(out io.Writer, hist []*genai.Content) {
 
 // uploadFile tracks state until FileStateActive reached.
 // TODO timeout hardcoded
-func uploadFile(ctx context.Context, client *genai.Client, path string) (*genai.File, error) {
-	file, err := client.Files.UploadFromPath(ctx, path, nil)
+func uploadFile(ctx context.Context, client core.Backend, path string) (*genai.File, error) {
+	files, ok := core.As[core.FileStore](client)
+	if !ok {
+		return nil, core.Unsupported(client, "file upload")
+	}
+	file, err := files.UploadFile(ctx, path)
 	if err != nil {
 		return nil, fmt.Errorf("uploading file '%s': %v", path, err)
 	}
@@ -296,7 +311,7 @@ func uploadFile(ctx context.Context, client *genai.Client, path string) (*genai.
 		case <-pollingCtx.Done():
 			return nil, fmt.Errorf("upload cancelled or timed out for '%s': %v", file.Name, pollingCtx.Err())
 		case <-time.After(1 * time.Second):
-			file, err = client.Files.Get(pollingCtx, file.Name, nil)
+			file, err = files.GetFile(pollingCtx, file.Name)
 			if err != nil {
 				return nil, fmt.Errorf("processing state for '%s': %v", file.Name, err)
 			}
@@ -308,6 +323,16 @@ func uploadFile(ctx context.Context, client *genai.Client, path string) (*genai.
 	return file, nil
 }
 
+// inlineMIMEType guesses the type of inline content from its extension,
+// sniffing the data only when the extension is unknown.
+func inlineMIMEType(path string, data []byte) string {
+	mimeType := mime.TypeByExtension(filepath.Ext(path))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	return strings.Split(mimeType, ";")[0]
+}
+
 func loadImage(filePathVal string) (*genai.Image, error) {
 	f, err := os.Open(filePathVal)
 	if err != nil {
@@ -371,7 +396,7 @@ func loadPrompt(filePath string, seen map[string]bool) (string, error) {
 
 // filePathHandler processes a single file path for glob.
 // parts and sysParts are extended with file content.
-func filePathHandler(ctx context.Context, client *genai.Client, filePathVal string, parts *[]*genai.Part, sysParts *[]*genai.Part, jsonSchema *map[string]any) error {
+func filePathHandler(ctx context.Context, client core.Backend, filePathVal string, parts *[]*genai.Part, sysParts *[]*genai.Part, jsonSchema *map[string]any) error {
 	keyVals, ok := ctx.Value(core.KeyValsKey).(core.ParamMap)
 	if !ok {
 		return fmt.Errorf("filePathHandler: keyVals not found in context")
@@ -395,6 +420,18 @@ func filePathHandler(ctx context.Context, client *genai.Client, filePathVal stri
 	case ".jpg", ".jpeg", ".png", ".gif", ".webp",
 		".mp3", ".wav", ".aiff", ".aac", ".ogg", ".flac", ".pdf":
 		file, err := uploadFile(ctx, client, filePathVal)
+		if errors.Is(err, errors.ErrUnsupported) {
+			// backend without file service, send content inline
+			data, err := io.ReadAll(f)
+			if err != nil {
+				return fmt.Errorf("reading file %s: %v", filePathVal, err)
+			}
+			*parts = append(*parts, &genai.Part{InlineData: &genai.Blob{
+				Data:     data,
+				MIMEType: inlineMIMEType(filePathVal, data),
+			}})
+			return nil
+		}
 		if err != nil {
 			return fmt.Errorf("uploading file '%s': %v", filePathVal, err)
 		}
@@ -435,7 +472,7 @@ func isHidden(name string) bool {
 }
 
 // glob processes files and directories passed as argument (recursively if walk is true).
-func glob(ctx context.Context, client *genai.Client, filePathVal string, parts *[]*genai.Part, sysParts *[]*genai.Part, jsonSchema *map[string]any) error {
+func glob(ctx context.Context, client core.Backend, filePathVal string, parts *[]*genai.Part, sysParts *[]*genai.Part, jsonSchema *map[string]any) error {
 	params, ok := ctx.Value(core.ParamsKey).(*core.Parameters)
 	if !ok {
 		return fmt.Errorf("glob: params not found in context")
@@ -520,33 +557,17 @@ func glob(ctx context.Context, client *genai.Client, filePathVal string, parts *
 	return nil
 }
 
-// persistChat saves chat history to .gen in the current directory.
-func persistChat(hist []*genai.Content) error {
-	file, err := os.Create(DotGen)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-	encoder := json.NewEncoder(file)
-	if err := encoder.Encode(hist); err != nil {
-		return err
-	}
-	return nil
-}
-
-// retrieveHistory reads content from .gen if it exists.
-func retrieveHistory(hist *[]*genai.Content) error {
-	if _, err := os.Stat(DotGen); errors.Is(err, os.ErrNotExist) {
-		return nil
-	}
-	dat, err := os.ReadFile(DotGen)
+// genDir returns the gen folder in the home directory, creating it if needed.
+func genDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		return err
+		return "", fmt.Errorf("failed to get user home directory: %v", err)
 	}
-	if err := json.Unmarshal(dat, hist); err != nil {
-		return err
+	dir := filepath.Join(homeDir, DotGenDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
 	}
-	return nil
+	return dir, nil
 }
 
 // loadPrefs reads and parses .genrc from the user's home directory.
@@ -586,6 +607,10 @@ func loadPrefs(params *core.Parameters) error {
 			key := strings.TrimSpace(parts[0])
 			value := strings.TrimSpace(parts[1])
 			switch strings.ToLower(key) {
+			case "compact":
+				if val, err := strconv.ParseFloat(value, 64); err == nil {
+					params.Compact = val
+				}
 			case "k":
 				if val, err := strconv.Atoi(value); err == nil {
 					params.K = val
@@ -603,6 +628,18 @@ func loadPrefs(params *core.Parameters) error {
 					genai.ThinkingLevelHigh:
 					params.ThinkingLevel = val
 				}
+			case "repairs":
+				if val, err := strconv.Atoi(value); err == nil && val >= 0 {
+					params.Repairs = val
+				}
+			case "retries":
+				if val, err := strconv.Atoi(value); err == nil && val > 0 {
+					params.Retries = val
+				}
+			case "retrydelay":
+				if val, err := time.ParseDuration(value); err == nil && val > 0 {
+					params.RetryDelay = val
+				}
 			case "temp":
 				if val, err := strconv.ParseFloat(value, 64); err == nil {
 					params.Temp = val
@@ -615,6 +652,14 @@ func loadPrefs(params *core.Parameters) error {
 				if val, err := strconv.ParseFloat(value, 64); err == nil {
 					params.TopP = val
 				}
+			case "trim":
+				params.Trim = strings.ToLower(value)
+			case "backend":
+				params.Backend = strings.ToLower(value)
+			case "baseurl":
+				params.BaseURL = value
+			case "voice":
+				params.Voice = value
 			case "embmodel":
 				params.EmbModel = value
 			case "genmodel":
@@ -632,6 +677,28 @@ func loadPrefs(params *core.Parameters) error {
 			if err := os.Setenv(key, val); err != nil {
 				return fmt.Errorf("failed to set env '%s': %v", key, err)
 			}
+		case "prices":
+			parts := strings.SplitN(line, "=", 2)
+			if len(parts) != 2 {
+				return fmt.Errorf("price error on line: %s", line)
+			}
+			var price core.Price
+			vals := strings.Split(parts[1], ",")
+			dst := []*float64{&price.Input, &price.Output, &price.Cached}
+			if len(vals) < 2 || len(vals) > len(dst) {
+				return fmt.Errorf("price error on line: %s", line)
+			}
+			for i, v := range vals {
+				f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+				if err != nil {
+					return fmt.Errorf("price error on line: %s", line)
+				}
+				*dst[i] = f
+			}
+			if params.Prices == nil {
+				params.Prices = core.PriceMap{}
+			}
+			params.Prices[strings.TrimSpace(parts[0])] = price
 		case "digestpaths":
 			params.DigestPaths = append(params.DigestPaths, line)
 		case "mcpservers":
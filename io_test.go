@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"io"
 	"os"
@@ -14,38 +15,6 @@ import (
 	"google.golang.org/genai"
 )
 
-// TestReadLine tests user input in chat mode.
-func TestReadLine(t *testing.T) {
-	tests := []struct {
-		input   string
-		want    string
-		wantErr bool
-	}{
-		{
-			input:   "Hello, world!\n",
-			want:    "Hello, world!",
-			wantErr: false,
-		},
-		{
-			input:   "\n",
-			want:    "",
-			wantErr: false,
-		},
-	}
-
-	for _, test := range tests {
-		reader := strings.NewReader(test.input)
-		res, err := readLine(reader)
-		if (err != nil) != test.wantErr {
-			t.Errorf("Did not expect error for '%s'", test.input)
-			continue
-		}
-		if res != test.want {
-			t.Errorf("Expected '%s', got '%s' for '%s'", test.want, res, test.input)
-		}
-	}
-}
-
 func TestEmitCandidates(t *testing.T) {
 	base64Data := `/9j/4AAQSkZJRgABAQIAHAAcAAD/2wBDABALDA4MChAODQ4SERATGCgaGBYWGDEjJR0oOjM9PDkzODdA
 SFxOQERXRTc4UG1RV19iZ2hnPk1xeXBkeFxlZ2P/2wBDARESEhgVGC8aGi9jQjhCY2NjY2NjY2NjY2Nj
@@ -262,8 +231,48 @@ func TestIsValidPath(t *testing.T) {
 	}
 }
 
-// TestPersistChatAndRetrieveHistory tests serialized chat history persistence.
-func TestPersistChatAndRetrieveHistory(t *testing.T) {
+// TestFilePathHandler_Inline checks attachments sent inline take their type from the extension.
+func TestFilePathHandler_Inline(t *testing.T) {
+	tmpDir := t.TempDir()
+	pdf := filepath.Join(tmpDir, "notes.pdf")
+	if err := os.WriteFile(pdf, []byte("plain text, not a PDF header"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var parts, sysParts []*genai.Part
+	var schema map[string]any
+	b := newOpenAIBackend("http://localhost/v1", "")
+	ctx := context.WithValue(t.Context(), core.KeyValsKey, core.ParamMap{})
+	if err := filePathHandler(ctx, b, pdf, &parts, &sysParts, &schema); err != nil {
+		t.Fatalf("filePathHandler: %v", err)
+	}
+	if len(parts) != 1 || parts[0].InlineData == nil {
+		t.Fatalf("expected one inline part, got %+v", parts)
+	}
+	if got := parts[0].InlineData.MIMEType; got != "application/pdf" {
+		t.Errorf("MIMEType = %q, want application/pdf", got)
+	}
+}
+
+func TestInlineMIMEType(t *testing.T) {
+	tests := []struct {
+		path string
+		data string
+		want string
+	}{
+		{"doc.pdf", "hello", "application/pdf"},
+		{"pic.png", "hello", "image/png"},
+		{"blob.unknownext", "hello", "text/plain"},
+		{"blob.unknownext", "\x89PNG\r\n\x1a\n", "image/png"},
+	}
+	for _, tt := range tests {
+		if got := inlineMIMEType(tt.path, []byte(tt.data)); got != tt.want {
+			t.Errorf("inlineMIMEType(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestSaveAndLoadSession tests serialized chat history persistence.
+func TestSaveAndLoadSession(t *testing.T) {
 	tmpDir := t.TempDir()
 
 	oldWd, err := os.Getwd()
@@ -285,14 +294,15 @@ func TestPersistChatAndRetrieveHistory(t *testing.T) {
 		},
 	}
 
-	if err := persistChat(hist); err != nil {
-		t.Fatalf("persistChat failed: %v", err)
+	if err := (&chatSession{Name: "hello", History: hist}).save(); err != nil {
+		t.Fatalf("save failed: %v", err)
 	}
 
-	var loadedHist []*genai.Content
-	if err := retrieveHistory(&loadedHist); err != nil {
-		t.Fatalf("retrieveHistory failed: %v", err)
+	session, err := loadSession("")
+	if err != nil {
+		t.Fatalf("loadSession failed: %v", err)
 	}
+	loadedHist := session.History
 
 	if len(loadedHist) != 1 || loadedHist[0].Role != "user" || loadedHist[0].Parts[0].Text != "Hello!" {
 		t.Errorf("Retrieved history mismatch: %+v", loadedHist)
@@ -318,6 +328,7 @@ timeout = 10s
 topp = 0.8
 embmodel = custom-emb
 genmodel = custom-gen
+retrydelay = -1s
 
 [digestpaths]
 path/to/digest1
@@ -335,7 +346,7 @@ TEST_GENRC_ENV_VAR = hello_from_genrc
 		t.Fatal(err)
 	}
 
-	params := &core.Parameters{}
+	params := &core.Parameters{RetryDelay: time.Second}
 	if err := loadPrefs(params); err != nil {
 		t.Fatalf("loadPrefs failed: %v", err)
 	}
@@ -361,6 +372,9 @@ TEST_GENRC_ENV_VAR = hello_from_genrc
 	if params.EmbModel != "custom-emb" {
 		t.Errorf("Expected EmbModel=custom-emb, got %q", params.EmbModel)
 	}
+	if params.RetryDelay != time.Second {
+		t.Errorf("Expected negative RetryDelay ignored, got %v", params.RetryDelay)
+	}
 	if params.GenModel != "custom-gen" {
 		t.Errorf("Expected GenModel=custom-gen, got %q", params.GenModel)
 	}
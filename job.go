@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+const JobsFile = "jobs.json" // name of submitted jobs file in DotGenDir
+
+// jobPollInterval is the delay between two status checks while waiting.
+var jobPollInterval = 30 * time.Second
+
+// jobRecord is persisted locally for each submitted Batch API job.
+type jobRecord struct {
+	Name    string    `json:"name"`
+	Model   string    `json:"model"`
+	IDs     []string  `json:"ids"` // request ids in submission order
+	Created time.Time `json:"created"`
+}
+
+func loadJobs() ([]jobRecord, error) {
+	dir, err := genDir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, JobsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var jobs []jobRecord
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", JobsFile, err)
+	}
+	return jobs, nil
+}
+
+func saveJob(rec jobRecord) error {
+	jobs, err := loadJobs()
+	if err != nil {
+		return err
+	}
+	dir, err := genDir()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(append(jobs, rec), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, JobsFile), data, 0600)
+}
+
+// findJob returns the record of the named job or of the most recent one.
+func findJob(args []string) (jobRecord, error) {
+	jobs, err := loadJobs()
+	if err != nil {
+		return jobRecord{}, err
+	}
+	if len(args) == 0 {
+		if len(jobs) == 0 {
+			return jobRecord{}, fmt.Errorf("no batch job submitted yet")
+		}
+		return jobs[len(jobs)-1], nil
+	}
+	name := args[0]
+	if !strings.HasPrefix(name, "batches/") {
+		name = "batches/" + name
+	}
+	for i := len(jobs) - 1; i >= 0; i-- {
+		if jobs[i].Name == name {
+			return jobs[i], nil
+		}
+	}
+	return jobRecord{Name: name}, nil // submitted elsewhere
+}
+
+// isJobDone reports whether the job reached a terminal state.
+func isJobDone(job *genai.BatchJob) bool {
+	switch job.State {
+	case genai.JobStateSucceeded, genai.JobStatePartiallySucceeded,
+		genai.JobStateFailed, genai.JobStateCancelled, genai.JobStateExpired:
+		return true
+	}
+	return false
+}
+
+// runJob submits the batch file as a Batch API job or reports on a submitted one.
+func runJob(ctx context.Context, in io.Reader, out io.Writer) error {
+	params, ok := ctx.Value(core.ParamsKey).(*core.Parameters)
+	if !ok {
+		return fmt.Errorf("missing params")
+	}
+	keyVals, ok := ctx.Value(core.KeyValsKey).(core.ParamMap)
+	if !ok {
+		return fmt.Errorf("missing keyVals")
+	}
+	client, err := backendFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	jobs, ok := core.As[core.BatchRunner](client)
+	if !ok {
+		return core.Unsupported(client, "batch jobs")
+	}
+
+	if params.JobOp == "submit" {
+		job, err := submitJob(ctx, params, keyVals, client, jobs, in)
+		if err != nil {
+			return err
+		}
+		emitJobStatus(out, job)
+		return nil
+	}
+
+	rec, err := findJob(params.Args)
+	if err != nil {
+		return err
+	}
+	job, err := jobs.GetBatchJob(ctx, rec.Name)
+	if err != nil {
+		return err
+	}
+	switch params.JobOp {
+	case "status":
+		emitJobStatus(out, job)
+	case "wait":
+		for !isJobDone(job) {
+			if params.Verbose {
+				fmt.Fprintf(os.Stderr, infos("%s %s\n"), job.Name, job.State)
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(jobPollInterval):
+			}
+			if job, err = jobs.GetBatchJob(ctx, rec.Name); err != nil {
+				return err
+			}
+		}
+		emitJobStatus(out, job)
+	case "fetch":
+		return fetchJob(out, job, rec, params)
+	}
+	return nil
+}
+
+// submitJob builds one inlined request per line of the batch file the same
+// way a Generator would and submits them as a single job.
+func submitJob(ctx context.Context, params *core.Parameters, keyVals core.ParamMap, client core.Backend, jobs core.BatchRunner, in io.Reader) (*genai.BatchJob, error) {
+	reqs, err := readBatch(params.BatchPath, in)
+	if err != nil {
+		return nil, err
+	}
+	// uploaded files are left for the job to read and expire on their own
+	uploads := &uploadOnce{Wrapper: core.Wrapper{Backend: client}, files: map[string]*uploadCall{}}
+	var inlined []*genai.InlinedRequest
+	var ids []string
+	for _, req := range reqs {
+		if req.Model != "" && req.Model != params.GenModel {
+			return nil, fmt.Errorf("request %s: batch jobs run a single model, use -m", req.ID)
+		}
+		rctx, _ := batchContext(ctx, params, keyVals, uploads, req)
+		g, err := newGenerator(rctx, strings.NewReader(""), io.Discard)
+		if err != nil {
+			return nil, err
+		}
+		if err := g.setPromptsAndFiles(); err != nil {
+			return nil, fmt.Errorf("request %s: %v", req.ID, err)
+		}
+		config, err := g.config()
+		if err != nil {
+			return nil, fmt.Errorf("request %s: %v", req.ID, err)
+		}
+		inlined = append(inlined, &genai.InlinedRequest{
+			Contents: []*genai.Content{{Role: "user", Parts: g.parts}},
+			Config:   config,
+			Metadata: map[string]string{"id": req.ID},
+		})
+		ids = append(ids, req.ID)
+	}
+
+	job, err := jobs.CreateBatchJob(ctx, params.GenModel, inlined, "gen "+filepath.Base(params.BatchPath))
+	if err != nil {
+		return nil, err
+	}
+	rec := jobRecord{Name: job.Name, Model: params.GenModel, IDs: ids, Created: time.Now()}
+	if err := saveJob(rec); err != nil {
+		return nil, fmt.Errorf("job %s submitted but not saved: %v", job.Name, err)
+	}
+	return job, nil
+}
+
+func emitJobStatus(out io.Writer, job *genai.BatchJob) {
+	fmt.Fprintf(out, "%s %s %s\n", job.Name, job.State, job.Model)
+	if job.Error != nil {
+		fmt.Fprintf(out, "%s\n", job.Error.Message)
+	}
+}
+
+// fetchJob emits the response of each request of a completed job.
+func fetchJob(out io.Writer, job *genai.BatchJob, rec jobRecord, params *core.Parameters) error {
+	if job.State != genai.JobStateSucceeded && job.State != genai.JobStatePartiallySucceeded {
+		return fmt.Errorf("job %s is %s", job.Name, job.State)
+	}
+	if job.Dest == nil || len(job.Dest.InlinedResponses) == 0 {
+		return fmt.Errorf("job %s has no inlined responses", job.Name)
+	}
+	failed := 0
+	for n, r := range job.Dest.InlinedResponses {
+		id := r.Metadata["id"]
+		if id == "" && n < len(rec.IDs) {
+			id = rec.IDs[n]
+		}
+		if id == "" {
+			id = strconv.Itoa(n + 1)
+		}
+		if len(job.Dest.InlinedResponses) > 1 {
+			if n > 0 {
+				fmt.Fprintln(out)
+			}
+			if params.OutRedirected {
+				fmt.Fprintf(out, "%s\n", id)
+			} else {
+				fmt.Fprintf(out, important("%s")+"\n", id)
+			}
+		}
+		if r.Error != nil {
+			failed++
+			fmt.Fprintf(out, "%s\n", r.Error.Message)
+			continue
+		}
+		if r.Response == nil || len(r.Response.Candidates) == 0 {
+			continue
+		}
+		i := 0
+		mp := &MarkdownParser{}
+		if err := emitCandidate(out, r.Response.Candidates[0], params.OutRedirected, false, params.Verbose, &i, mp, ""); err != nil {
+			return err
+		}
+		fmt.Fprint(out, mp.flush(params.OutRedirected))
+		if params.CountTokens && r.Response.UsageMetadata != nil {
+			TokenCount.Add(r.Response.UsageMetadata.TotalTokenCount)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d job requests failed", failed, len(job.Dest.InlinedResponses))
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+// newBatchStandIn serves the Gemini API batch endpoints and completes a job after two polls.
+func newBatchStandIn(t *testing.T) (*httptest.Server, *string) {
+	t.Helper()
+	var body string
+	polls := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1beta/models/", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, ":batchGenerateContent") {
+			http.NotFound(w, r)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		fmt.Fprint(w, `{"name":"batches/abc","metadata":{"displayName":"gen","state":"BATCH_STATE_PENDING","model":"models/m"}}`)
+	})
+	mux.HandleFunc("GET /v1beta/batches/abc", func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		if polls < 3 {
+			fmt.Fprint(w, `{"name":"batches/abc","metadata":{"state":"BATCH_STATE_RUNNING","model":"models/m"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"name":"batches/abc","metadata":{"state":"BATCH_STATE_SUCCEEDED","model":"models/m","output":{"inlinedResponses":{"inlinedResponses":[
+			{"response":{"candidates":[{"content":{"role":"model","parts":[{"text":"first answer"}]},"finishReason":"STOP"}]},"metadata":{"id":"q1"}},
+			{"error":{"code":8,"message":"quota exhausted"},"metadata":{"id":"q2"}}
+		]}}}}`)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, &body
+}
+
+func TestRunJob(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	srv, body := newBatchStandIn(t)
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		APIKey:      "test",
+		Backend:     genai.BackendGeminiAPI,
+		HTTPOptions: genai.HTTPOptions{BaseURL: srv.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend := &geminiBackend{client: client}
+	defer func(d time.Duration) { jobPollInterval = d }(jobPollInterval)
+	jobPollInterval = time.Millisecond
+
+	batch := filepath.Join(t.TempDir(), "prompts.jsonl")
+	if err := os.WriteFile(batch, []byte(`{"id":"q1","prompt":"capital of {c}?","params":{"c":"France"}}`+"\n"+`{"id":"q2","prompt":"why?"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	job := func(args ...string) (string, error) {
+		ctx := prepareTestContext(t, true, append([]string{"-m", "m"}, args...)...)
+		params := ctx.Value(core.ParamsKey).(*core.Parameters)
+		params.Client = backend
+		params.OutRedirected = true
+		var output strings.Builder
+		err := runJob(ctx, strings.NewReader(""), &output)
+		return output.String(), err
+	}
+
+	out, err := job("-batch", batch, "-job", "submit")
+	if err != nil || !strings.Contains(out, "batches/abc JOB_STATE_PENDING") {
+		t.Fatalf("submit got %q, %v", out, err)
+	}
+	if !strings.Contains(*body, "capital of France?") || !strings.Contains(*body, `"q2"`) {
+		t.Errorf("unexpected batch request body: %s", *body)
+	}
+	jobs, err := loadJobs()
+	if err != nil || len(jobs) != 1 || jobs[0].Name != "batches/abc" {
+		t.Errorf("expected persisted job, got %+v, %v", jobs, err)
+	}
+
+	if out, err := job("-job", "status"); err != nil || !strings.Contains(out, "JOB_STATE_RUNNING") {
+		t.Errorf("status got %q, %v", out, err)
+	}
+	if _, err := job("-job", "fetch"); err == nil {
+		t.Errorf("expected fetch to fail on running job")
+	}
+	if out, err := job("-job", "wait", "abc"); err != nil || !strings.Contains(out, "JOB_STATE_SUCCEEDED") {
+		t.Errorf("wait got %q, %v", out, err)
+	}
+	out, err = job("-job", "fetch")
+	if err == nil || !strings.Contains(err.Error(), "1 of 2") {
+		t.Errorf("expected one failed request, got %v", err)
+	}
+	AssertOutput(t, out, OutputExpectations{
+		Contains: []string{"q1\nfirst answer", "q2\nquota exhausted"},
+	})
+}
+
+func TestFindJob(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	if _, err := findJob(nil); err == nil {
+		t.Errorf("expected error without submitted jobs")
+	}
+	if err := saveJob(jobRecord{Name: "batches/1", IDs: []string{"a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveJob(jobRecord{Name: "batches/2"}); err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		args []string
+		name string
+		ids  int
+	}{
+		{nil, "batches/2", 0},
+		{[]string{"1"}, "batches/1", 1},
+		{[]string{"batches/9"}, "batches/9", 0},
+	}
+	for _, tc := range testCases {
+		rec, err := findJob(tc.args)
+		if err != nil || rec.Name != tc.name || len(rec.IDs) != tc.ids {
+			t.Errorf("findJob(%v) = %+v, %v", tc.args, rec, err)
+		}
+	}
+}
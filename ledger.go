@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+const LedgerFile = "usage.jsonl" // name of usage ledger file in DotGenDir
+
+// ReportGroups lists the ways usage can be aggregated.
+var ReportGroups = []string{"day", "model", "prompt"}
+
+// ledgerMu serializes appends to the ledger e.g. from batch workers.
+var ledgerMu sync.Mutex
+
+// ledgerEntry records the usage of a single generation call.
+type ledgerEntry struct {
+	Time       time.Time `json:"time"`
+	Model      string    `json:"model"`
+	Prompts    []string  `json:"prompts,omitempty"` // prompt file names
+	Prompt     int32     `json:"prompt"`
+	Cached     int32     `json:"cached,omitempty"`
+	Candidates int32     `json:"candidates"`
+	Thoughts   int32     `json:"thoughts,omitempty"`
+	ToolUse    int32     `json:"toolUse,omitempty"`
+	Total      int32     `json:"total"`
+	Cost       float64   `json:"cost"` // USD, 0 without price
+}
+
+// cost applies the price per million tokens to the usage of the entry.
+// Cached tokens are part of the prompt and billed at the cached rate.
+func (e ledgerEntry) cost(price core.Price) float64 {
+	cached := price.Cached
+	if cached == 0 {
+		cached = price.Input
+	}
+	in := float64(e.Prompt-e.Cached+e.ToolUse)*price.Input + float64(e.Cached)*cached
+	out := float64(e.Candidates+e.Thoughts) * price.Output
+	return (in + out) / 1e6
+}
+
+// promptNames returns the base names of prompt files attached with -f.
+func promptNames(paths []string) []string {
+	var names []string
+	for _, path := range paths {
+		if strings.HasSuffix(path, PExt) || strings.HasSuffix(path, SPExt) {
+			names = append(names, filepath.Base(path))
+		}
+	}
+	return names
+}
+
+func appendLedger(e ledgerEntry) error {
+	dir, err := genDir()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+	f, err := os.OpenFile(filepath.Join(dir, LedgerFile), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func loadLedger() ([]ledgerEntry, error) {
+	dir, err := genDir()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(dir, LedgerFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []ledgerEntry
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		var e ledgerEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("reading %s line %d: %v", LedgerFile, n, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// ledgerBackend appends the usage of each generation call to the ledger.
+type ledgerBackend struct {
+	core.Wrapper
+}
+
+// record writes the entry for usage, warning instead of failing the call.
+func (b *ledgerBackend) record(ctx context.Context, model string, usage *genai.GenerateContentResponseUsageMetadata) {
+	if usage == nil {
+		return
+	}
+	e := ledgerEntry{
+		Time:       time.Now(),
+		Model:      strings.TrimPrefix(model, "models/"),
+		Prompt:     usage.PromptTokenCount,
+		Cached:     usage.CachedContentTokenCount,
+		Candidates: usage.CandidatesTokenCount,
+		Thoughts:   usage.ThoughtsTokenCount,
+		ToolUse:    usage.ToolUsePromptTokenCount,
+		Total:      usage.TotalTokenCount,
+	}
+	if params, ok := ctx.Value(core.ParamsKey).(*core.Parameters); ok {
+		e.Prompts = promptNames(params.FilePaths)
+		if price, ok := params.Prices[e.Model]; ok {
+			e.Cost = e.cost(price)
+		}
+	}
+	if err := appendLedger(e); err != nil {
+		fmt.Fprintf(os.Stderr, "usage not recorded: %v\n", err)
+	}
+}
+
+func (b *ledgerBackend) GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	resp, err := b.Backend.GenerateContent(ctx, model, contents, config)
+	if err == nil {
+		b.record(ctx, model, resp.UsageMetadata)
+	}
+	return resp, err
+}
+
+// GenerateContentStream records the usage of the last chunk carrying one.
+func (b *ledgerBackend) GenerateContentStream(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) iter.Seq2[*genai.GenerateContentResponse, error] {
+	return func(yield func(*genai.GenerateContentResponse, error) bool) {
+		var usage *genai.GenerateContentResponseUsageMetadata
+		defer func() { b.record(ctx, model, usage) }()
+		for resp, err := range b.Backend.GenerateContentStream(ctx, model, contents, config) {
+			if resp != nil && resp.UsageMetadata != nil {
+				usage = resp.UsageMetadata
+			}
+			if !yield(resp, err) {
+				return
+			}
+		}
+	}
+}
+
+// usageRow aggregates ledger entries sharing a key.
+type usageRow struct {
+	key    string
+	calls  int
+	input  int64 // prompt and tool use
+	output int64 // candidates and thoughts
+	cost   float64
+}
+
+// runReport prints usage and cost from the ledger grouped by day, model or prompt.
+func runReport(ctx context.Context, out io.Writer) error {
+	params, ok := ctx.Value(core.ParamsKey).(*core.Parameters)
+	if !ok {
+		return fmt.Errorf("missing params")
+	}
+	entries, err := loadLedger()
+	if err != nil {
+		return err
+	}
+	rows := map[string]*usageRow{}
+	var total usageRow
+	for _, e := range entries {
+		var keys []string
+		switch params.Report {
+		case "day":
+			keys = []string{e.Time.Local().Format(time.DateOnly)}
+		case "model":
+			keys = []string{e.Model}
+		case "prompt":
+			keys = e.Prompts
+			if len(keys) == 0 {
+				keys = []string{"-"}
+			}
+		}
+		for _, k := range keys {
+			r, ok := rows[k]
+			if !ok {
+				r = &usageRow{key: k}
+				rows[k] = r
+			}
+			r.add(e)
+		}
+		total.add(e)
+	}
+	keys := slices.Sorted(maps.Keys(rows))
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tcalls\tinput\toutput\tcost\t\n", params.Report)
+	for _, k := range keys {
+		rows[k].emit(w)
+	}
+	total.key = "total"
+	total.emit(w)
+	return w.Flush()
+}
+
+func (r *usageRow) add(e ledgerEntry) {
+	r.calls++
+	r.input += int64(e.Prompt + e.ToolUse)
+	r.output += int64(e.Candidates + e.Thoughts)
+	r.cost += e.Cost
+}
+
+func (r *usageRow) emit(w io.Writer) {
+	fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.4f\t\n", r.key, r.calls, r.input, r.output, r.cost)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/jdevoo/gen/core"
+)
+
+func TestLedger(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	fake := &fakeBackend{replies: []fakeReply{textReply("one"), textReply("two", "three")}}
+	b := &ledgerBackend{Wrapper: core.Wrapper{Backend: fake}}
+	params := &core.Parameters{
+		FilePaths: []string{"data.csv", "prompts/review.prompt"},
+		Prices:    core.PriceMap{"m": {Input: 1, Output: 10}},
+	}
+	ctx := context.WithValue(context.Background(), core.ParamsKey, params)
+
+	if _, err := b.GenerateContent(ctx, "models/m", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range b.GenerateContentStream(ctx, "other", nil, nil) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := loadLedger()
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("expected two entries, got %+v, %v", entries, err)
+	}
+	e := entries[0]
+	if e.Model != "m" || len(e.Prompts) != 1 || e.Prompts[0] != "review.prompt" || e.Prompt != 2 || e.Candidates != 3 {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if math.Abs(e.Cost-32e-6) > 1e-12 || entries[1].Cost != 0 {
+		t.Errorf("unexpected costs %g and %g", e.Cost, entries[1].Cost)
+	}
+
+	var out strings.Builder
+	params.Report = "model"
+	if err := runReport(ctx, &out); err != nil {
+		t.Fatal(err)
+	}
+	AssertOutput(t, out.String(), OutputExpectations{
+		Contains: []string{"m      1", "other  1", "total  2      4      6       0.0000"},
+	})
+}
+
+func TestLedgerEntryCost(t *testing.T) {
+	price := core.Price{Input: 2, Output: 8, Cached: 0.5}
+	e := ledgerEntry{Prompt: 1000, Cached: 400, Candidates: 100, Thoughts: 50, ToolUse: 10}
+	want := (610*2 + 400*0.5 + 150*8) / 1e6
+	if got := e.cost(price); math.Abs(got-want) > 1e-12 {
+		t.Errorf("cost = %g, want %g", got, want)
+	}
+}
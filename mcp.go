@@ -98,28 +98,40 @@ func initMCPSessions(ctx context.Context, params *core.Parameters) error {
 			mcpCtx, cancel := context.WithTimeout(gCtx, 30*time.Second)
 			defer cancel()
 
-			if isStreamableServer {
-				session, connErr = client.Connect(mcpCtx, &mcp.StreamableClientTransport{
-					Endpoint: srvStr,
-				}, nil)
-			} else {
-				parts, err := shlex.Split(srvStr)
+			var parts []string
+			var cmdPath string
+			if !isStreamableServer {
+				var err error
+				parts, err = shlex.Split(srvStr)
 				if err != nil || len(parts) == 0 {
 					return fmt.Errorf("invalid MCP command '%s': %v", srvStr, err)
 				}
-				cmdPath, err := exec.LookPath(parts[0])
+				cmdPath, err = exec.LookPath(parts[0])
 				if err != nil {
 					return fmt.Errorf("cannot find MCP server '%s': %v", parts[0], err)
 				}
-				cmd := exec.Command(cmdPath, parts[1:]...)
-				if params.Verbose {
-					cmd.Stderr = os.Stderr
+			}
+			// servers still starting up or briefly unreachable get a few more tries
+			policy := newRetryPolicy(params)
+			for attempt := 1; ; attempt++ {
+				if isStreamableServer {
+					session, connErr = client.Connect(mcpCtx, &mcp.StreamableClientTransport{
+						Endpoint: srvStr,
+					}, nil)
 				} else {
-					cmd.Stderr = io.Discard
+					cmd := exec.Command(cmdPath, parts[1:]...)
+					if params.Verbose {
+						cmd.Stderr = os.Stderr
+					} else {
+						cmd.Stderr = io.Discard
+					}
+					session, connErr = client.Connect(mcpCtx, &mcp.CommandTransport{
+						Command: cmd,
+					}, nil)
+				}
+				if connErr == nil || !policy.pause(mcpCtx, attempt, "MCP connect", connErr) {
+					break
 				}
-				session, connErr = client.Connect(mcpCtx, &mcp.CommandTransport{
-					Command: cmd,
-				}, nil)
 			}
 			if connErr != nil {
 				return fmt.Errorf("MCP connect error: %v", connErr)
@@ -384,9 +396,9 @@ func genSampling(ctx context.Context, req *mcp.CreateMessageRequest) (*mcp.Creat
 		return nil, fmt.Errorf("genSampling: params not found in context")
 	}
 
-	client, err := genai.NewClient(ctx, nil)
+	client, err := backendFromContext(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("genSampling: failed to create genai client")
+		return nil, fmt.Errorf("genSampling: failed to create backend client")
 	}
 
 	if len((*req.Params).Messages) == 0 || (*req.Params).Messages[0].Content == nil {
@@ -394,7 +406,7 @@ func genSampling(ctx context.Context, req *mcp.CreateMessageRequest) (*mcp.Creat
 	}
 	prompt := genai.Text((*req.Params).Messages[0].Content.(*mcp.TextContent).Text)
 
-	res, err := client.Models.GenerateContent(ctx, params.GenModel, prompt, nil)
+	res, err := client.GenerateContent(ctx, params.GenModel, prompt, nil)
 	if err != nil {
 		return nil, err
 	}
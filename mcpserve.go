@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/jdevoo/gen/core"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/genai"
+)
+
+// placeholderRegex matches the {key} placeholders of prompt files.
+var placeholderRegex = regexp.MustCompile(`\{(\w+)\}`)
+
+type generateInput struct {
+	Prompt string            `json:"prompt" jsonschema:"prompt text with optional {key} placeholders"`
+	Params map[string]string `json:"params,omitempty" jsonschema:"values of the {key} placeholders"`
+	Model  string            `json:"model,omitempty" jsonschema:"model to use instead of the default one"`
+}
+
+type searchInput struct {
+	Query string `json:"query" jsonschema:"text to look up in the digests"`
+	K     int    `json:"k,omitempty" jsonschema:"maximum number of entries to retrieve"`
+}
+
+// digestEntry is a document of a digest without its embedding.
+type digestEntry struct {
+	Content  string            `json:"content,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type searchOutput struct {
+	Entries []digestEntry `json:"entries"`
+}
+
+// runMCPServe publishes prompt files, digests and generation as an MCP server
+// over stdio or streamable HTTP on the address in params.MCPServe.
+func runMCPServe(ctx context.Context) error {
+	params, ok := ctx.Value(core.ParamsKey).(*core.Parameters)
+	if !ok {
+		return fmt.Errorf("missing params")
+	}
+	keyVals, ok := ctx.Value(core.KeyValsKey).(core.ParamMap)
+	if !ok {
+		return fmt.Errorf("missing keyVals")
+	}
+	client, err := backendFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	uploads := &uploadOnce{Wrapper: core.Wrapper{Backend: client}, files: map[string]*uploadCall{}}
+	defer func() {
+		params.FileURIs = append(params.FileURIs, uploads.uris()...) // for cleanup
+	}()
+	server, err := newMCPServer(params, keyVals, uploads)
+	if err != nil {
+		return err
+	}
+	if params.MCPServe == "stdio" {
+		// closing stdin ends the session
+		if err := server.Run(ctx, &mcp.StdioTransport{}); err != nil && ctx.Err() == nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		return nil
+	}
+	handler := mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, nil)
+	return listenAndServe(ctx, params.MCPServe, "", handler)
+}
+
+// newMCPServer publishes the prompt files attached with -f as prompts, the
+// digests set with -d as resources and the generate and search_digest tools.
+func newMCPServer(params *core.Parameters, keyVals core.ParamMap, client core.Backend) (*mcp.Server, error) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "gen", Version: Version}, nil)
+
+	files, err := promptFiles(params.FilePaths, params.Walk)
+	if err != nil {
+		return nil, err
+	}
+	var sysPaths []string // of the system prompts kept by the generate tool
+	for name, path := range files {
+		prompt, err := mcpPrompt(name, path, keyVals)
+		if err != nil {
+			return nil, err
+		}
+		server.AddPrompt(prompt, promptHandler(path, keyVals))
+		if filepath.Ext(path) == SPExt {
+			sysPaths = append(sysPaths, path)
+		}
+	}
+	slices.Sort(sysPaths)
+
+	for _, path := range params.DigestPaths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		server.AddResource(&mcp.Resource{
+			URI:         "file://" + filepath.ToSlash(absPath),
+			Name:        filepath.Base(absPath),
+			Description: "digest entries as JSON lines",
+			MIMEType:    "application/jsonl",
+		}, digestHandler(path))
+	}
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "generate",
+		Description: "Generate content with the system prompts, digests and tools of this gen server",
+	}, func(ctx context.Context, req *mcp.CallToolRequest, in generateInput) (*mcp.CallToolResult, any, error) {
+		p := *params
+		p.FilePaths = sysPaths // prompts published, not attached
+		res := runBatchRequest(ctx, &p, keyVals, client, batchRequest{ID: "mcp", Prompt: in.Prompt, Params: in.Params, Model: in.Model})
+		if res.Error != "" {
+			return nil, nil, errors.New(res.Error)
+		}
+		return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: res.Text}}}, nil, nil
+	})
+
+	if len(params.DigestPaths) > 0 {
+		mcp.AddTool(server, &mcp.Tool{
+			Name:        "search_digest",
+			Description: "Retrieve the digest entries most relevant to a query",
+		}, func(ctx context.Context, req *mcp.CallToolRequest, in searchInput) (*mcp.CallToolResult, searchOutput, error) {
+			out := searchOutput{Entries: []digestEntry{}}
+			k := params.K
+			if in.K > 0 {
+				k = in.K
+			}
+			query, err := client.EmbedContent(ctx, params.EmbModel, []*genai.Content{{Parts: []*genai.Part{{Text: in.Query}}}})
+			if err != nil {
+				return nil, out, err
+			}
+			if len(query.Embeddings) == 0 {
+				return nil, out, fmt.Errorf("no embedding returned")
+			}
+			var res []QueryResult
+			for _, path := range params.DigestPaths {
+				if res, err = queryDigest(path, query.Embeddings[0], res, k, float32(params.Lambda), params.Verbose); err != nil {
+					return nil, out, err
+				}
+			}
+			for _, r := range res {
+				out.Entries = append(out.Entries, digestEntry{Content: r.doc.content, Metadata: r.doc.metadata})
+			}
+			return nil, out, nil
+		})
+	}
+
+	return server, nil
+}
+
+// promptFiles maps names to the .prompt and .sprompt files found in paths,
+// directories being walked as with -f.
+func promptFiles(paths []string, walk bool) (map[string]string, error) {
+	files := map[string]string{}
+	for _, root := range paths {
+		matches, err := filepath.Glob(root)
+		if err != nil {
+			return nil, fmt.Errorf("'%s': %v", root, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("directory or file not found: '%s'", root)
+		}
+		for _, match := range matches {
+			err := filepath.WalkDir(match, func(path string, d os.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() {
+					if path != match && (!walk || isHidden(d.Name())) {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if ext := filepath.Ext(path); isHidden(d.Name()) || (ext != PExt && ext != SPExt) {
+					return nil
+				}
+				name, err := filepath.Rel(match, path)
+				if err != nil || name == "." {
+					name = filepath.Base(path)
+				}
+				files[filepath.ToSlash(name)] = path
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// mcpPrompt declares the placeholders of a prompt file as arguments, those
+// set with -p being optional.
+func mcpPrompt(name string, path string, keyVals core.ParamMap) (*mcp.Prompt, error) {
+	text, err := loadPrompt(path, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	prompt := &mcp.Prompt{Name: name, Description: fmt.Sprintf("prompt from %s", path)}
+	if filepath.Ext(path) == SPExt {
+		prompt.Description = fmt.Sprintf("system instructions from %s", path)
+	}
+	var seen []string
+	for _, m := range placeholderRegex.FindAllStringSubmatch(text, -1) {
+		key := strings.ToLower(m[1])
+		if "{"+key+"}" == DigestKey || slices.Contains(seen, key) {
+			continue
+		}
+		seen = append(seen, key)
+		_, isSet := keyVals[key]
+		prompt.Arguments = append(prompt.Arguments, &mcp.PromptArgument{Name: key, Required: !isSet})
+	}
+	return prompt, nil
+}
+
+// promptHandler reads the prompt file again and replaces its placeholders.
+func promptHandler(path string, keyVals core.ParamMap) mcp.PromptHandler {
+	return func(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		text, err := loadPrompt(path, map[string]bool{})
+		if err != nil {
+			return nil, err
+		}
+		kv := core.ParamMap{}
+		for k, v := range keyVals {
+			kv[k] = v
+		}
+		for k, v := range req.Params.Arguments {
+			kv[k] = v
+		}
+		return &mcp.GetPromptResult{
+			Messages: []*mcp.PromptMessage{{Role: "user", Content: &mcp.TextContent{Text: searchReplace(text, kv)}}},
+		}, nil
+	}
+}
+
+// digestHandler returns the entries of a digest as JSON lines.
+func digestHandler(path string) mcp.ResourceHandler {
+	return func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+		var sb strings.Builder
+		enc := json.NewEncoder(&sb)
+		err := readDigest(path, func(doc Document) error {
+			return enc.Encode(digestEntry{Content: doc.content, Metadata: doc.metadata})
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{{
+			URI:      req.Params.URI,
+			MIMEType: "application/jsonl",
+			Text:     sb.String(),
+		}}}, nil
+	}
+}
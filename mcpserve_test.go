@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jdevoo/gen/core"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"google.golang.org/genai"
+)
+
+// connectMCPServer serves the fake backend and returns a connected client session.
+func connectMCPServer(t *testing.T, fake *fakeBackend, args ...string) *mcp.ClientSession {
+	t.Helper()
+	ctx := prepareTestContext(t, true, args...)
+	params := ctx.Value(core.ParamsKey).(*core.Parameters)
+	server, err := newMCPServer(params, ctx.Value(core.KeyValsKey).(core.ParamMap), fake)
+	if err != nil {
+		t.Fatalf("newMCPServer failed: %v", err)
+	}
+	st, ct := mcp.NewInMemoryTransports()
+	if _, err := server.Connect(t.Context(), st, nil); err != nil {
+		t.Fatal(err)
+	}
+	client := mcp.NewClient(&mcp.Implementation{Name: "test"}, nil)
+	session, err := client.Connect(t.Context(), ct, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { session.Close() })
+	return session
+}
+
+func TestMCPServe_Prompts(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "greet.prompt"), []byte("say hello to {name} in {Lang} as {name} likes, @sub.sprompt"), 0644)
+	os.WriteFile(filepath.Join(dir, "sub.sprompt"), []byte("politely"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a prompt"), 0644)
+	os.Mkdir(filepath.Join(dir, "nested"), 0755)
+	os.WriteFile(filepath.Join(dir, "nested", "deep.prompt"), []byte("deep"), 0644)
+
+	session := connectMCPServer(t, &fakeBackend{}, "-mcpserve", "stdio", "-p", "lang=French", "-f", dir)
+	list, err := session.ListPrompts(t.Context(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, p := range list.Prompts {
+		names = append(names, p.Name)
+		if p.Name == "greet.prompt" {
+			if len(p.Arguments) != 2 || p.Arguments[0].Name != "name" || !p.Arguments[0].Required || p.Arguments[1].Required {
+				t.Errorf("unexpected arguments %+v %+v", p.Arguments[0], p.Arguments[1:])
+			}
+		}
+	}
+	if strings.Join(names, ",") != "greet.prompt,sub.sprompt" {
+		t.Errorf("unexpected prompts %v", names)
+	}
+
+	res, err := session.GetPrompt(t.Context(), &mcp.GetPromptParams{Name: "greet.prompt", Arguments: map[string]string{"name": "Ada"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := res.Messages[0].Content.(*mcp.TextContent).Text; text != "say hello to Ada in French as Ada likes, politely" {
+		t.Errorf("unexpected prompt %q", text)
+	}
+}
+
+func TestMCPServe_Tools(t *testing.T) {
+	digest := filepath.Join(t.TempDir(), "digest")
+	for _, content := range []string{"first entry", "second entry"} {
+		err := appendToDigest(digest, &genai.ContentEmbedding{Values: []float32{0.1, 0.2, 0.3}}, core.ParamMap{"src": content}, false, false, &genai.Part{Text: content})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	prompts := t.TempDir()
+	os.WriteFile(filepath.Join(prompts, "role.sprompt"), []byte("be terse"), 0644)
+	os.WriteFile(filepath.Join(prompts, "greet.prompt"), []byte("hello"), 0644)
+	fake := &fakeBackend{replies: []fakeReply{textReply("generated"), {err: genai.APIError{Code: 400, Message: "bad"}}}}
+	session := connectMCPServer(t, fake, "-mcpserve", "stdio", "-d", digest, "-f", prompts)
+
+	resources, err := session.ListResources(t.Context(), nil)
+	if err != nil || len(resources.Resources) != 1 {
+		t.Fatalf("expected digest resource, got %+v, %v", resources, err)
+	}
+	read, err := session.ReadResource(t.Context(), &mcp.ReadResourceParams{URI: resources.Resources[0].URI})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(read.Contents[0].Text), "\n"); len(lines) != 2 || !strings.Contains(lines[1], `"second entry"`) {
+		t.Errorf("unexpected digest entries %q", read.Contents[0].Text)
+	}
+
+	res, err := session.CallTool(t.Context(), &mcp.CallToolParams{Name: "search_digest", Arguments: map[string]any{"query": "entry", "k": 1}})
+	if err != nil || res.IsError {
+		t.Fatalf("search failed: %+v, %v", res, err)
+	}
+	if text := res.Content[0].(*mcp.TextContent).Text; strings.Count(text, `"content"`) != 1 {
+		t.Errorf("expected one entry, got %s", text)
+	}
+
+	res, err = session.CallTool(t.Context(), &mcp.CallToolParams{Name: "generate", Arguments: map[string]any{"prompt": "hi {who}", "params": map[string]string{"who": "there"}}})
+	if err != nil || res.IsError || res.Content[0].(*mcp.TextContent).Text != "generated" {
+		t.Errorf("unexpected generation %+v, %v", res, err)
+	}
+	if parts := fake.contents[0][0].Parts; !strings.HasSuffix(parts[0].Text, "entry") || parts[len(parts)-1].Text != "hi there" {
+		t.Errorf("expected digest entry and prompt with params, got %+v", parts)
+	}
+	if sys := fake.configs[0].SystemInstruction; sys == nil || contentText(sys) != "be terse" {
+		t.Errorf("expected system prompt kept, got %+v", sys)
+	}
+	for _, p := range fake.contents[0][0].Parts {
+		if p.Text == "hello" {
+			t.Errorf("expected prompt file not attached, got %+v", fake.contents[0][0].Parts)
+		}
+	}
+	res, err = session.CallTool(t.Context(), &mcp.CallToolParams{Name: "generate", Arguments: map[string]any{"prompt": "hi"}})
+	if err != nil || !res.IsError {
+		t.Errorf("expected tool error, got %+v, %v", res, err)
+	}
+}
@@ -0,0 +1,630 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// openAIBackend serves requests through a server implementing the OpenAI
+// chat completions protocol such as Ollama, vLLM or llama.cpp server.
+type openAIBackend struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+type oaiMessage struct {
+	Role       string        `json:"role"`
+	Content    any           `json:"content,omitempty"` // string or []oaiContentPart
+	ToolCalls  []oaiToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string        `json:"tool_call_id,omitempty"`
+}
+
+type oaiContentPart struct {
+	Type     string       `json:"type"`
+	Text     string       `json:"text,omitempty"`
+	ImageURL *oaiImageURL `json:"image_url,omitempty"`
+}
+
+type oaiImageURL struct {
+	URL string `json:"url"`
+}
+
+type oaiToolCall struct {
+	Index    *int            `json:"index,omitempty"`
+	ID       string          `json:"id,omitempty"`
+	Type     string          `json:"type,omitempty"`
+	Function oaiFunctionCall `json:"function"`
+}
+
+// oaiToolKey identifies a streamed tool call by choice and tool index.
+type oaiToolKey struct {
+	choice int32
+	tool   int
+}
+
+type oaiFunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+type oaiTool struct {
+	Type     string      `json:"type"`
+	Function oaiFunction `json:"function"`
+}
+
+type oaiFunction struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters,omitempty"`
+}
+
+type oaiResponseFormat struct {
+	Type       string         `json:"type"`
+	JSONSchema *oaiJSONSchema `json:"json_schema,omitempty"`
+}
+
+type oaiJSONSchema struct {
+	Name   string `json:"name"`
+	Schema any    `json:"schema"`
+}
+
+type oaiStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type oaiChatRequest struct {
+	Model          string             `json:"model"`
+	Messages       []oaiMessage       `json:"messages"`
+	Stream         bool               `json:"stream,omitempty"`
+	StreamOptions  *oaiStreamOptions  `json:"stream_options,omitempty"`
+	Temperature    *float32           `json:"temperature,omitempty"`
+	TopP           *float32           `json:"top_p,omitempty"`
+	MaxTokens      int32              `json:"max_tokens,omitempty"`
+	N              int32              `json:"n,omitempty"`
+	Stop           []string           `json:"stop,omitempty"`
+	Tools          []oaiTool          `json:"tools,omitempty"`
+	ResponseFormat *oaiResponseFormat `json:"response_format,omitempty"`
+}
+
+type oaiMessageOut struct {
+	Role             string        `json:"role"`
+	Content          string        `json:"content"`
+	ReasoningContent string        `json:"reasoning_content"` // vLLM and llama.cpp
+	Reasoning        string        `json:"reasoning"`         // Ollama
+	ToolCalls        []oaiToolCall `json:"tool_calls"`
+}
+
+type oaiChoice struct {
+	Index        int32          `json:"index"`
+	Message      *oaiMessageOut `json:"message"`
+	Delta        *oaiMessageOut `json:"delta"`
+	FinishReason string         `json:"finish_reason"`
+}
+
+type oaiUsage struct {
+	PromptTokens     int32 `json:"prompt_tokens"`
+	CompletionTokens int32 `json:"completion_tokens"`
+	TotalTokens      int32 `json:"total_tokens"`
+}
+
+type oaiChatResponse struct {
+	Model   string      `json:"model"`
+	Choices []oaiChoice `json:"choices"`
+	Usage   *oaiUsage   `json:"usage"`
+}
+
+type oaiEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type oaiEmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+type oaiModel struct {
+	ID      string `json:"id"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// newOpenAIBackend defaults to the local Ollama endpoint when baseURL is empty.
+func newOpenAIBackend(baseURL string, apiKey string) *openAIBackend {
+	if baseURL == "" {
+		baseURL = "http://localhost:11434/v1"
+	}
+	return &openAIBackend{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		http:    http.DefaultClient,
+	}
+}
+
+func (b *openAIBackend) Name() string {
+	return "OpenAI"
+}
+
+// do sends a request and returns the response body or an API error.
+func (b *openAIBackend) do(ctx context.Context, method string, path string, payload any) (io.ReadCloser, error) {
+	var body io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, b.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if b.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+b.apiKey)
+	}
+	resp, err := b.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		var e struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		msg := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &e) == nil && e.Error.Message != "" {
+			msg = e.Error.Message
+		}
+		apiErr := genai.APIError{Code: resp.StatusCode, Message: msg, Status: http.StatusText(resp.StatusCode)}
+		if d := parseRetryAfter(resp.Header.Get("Retry-After")); d > 0 {
+			// same shape as the RetryInfo detail of the Gemini API
+			apiErr.Details = []map[string]any{{
+				"@type":      "type.googleapis.com/google.rpc.RetryInfo",
+				"retryDelay": fmt.Sprintf("%ds", int(d.Round(time.Second).Seconds())),
+			}}
+		}
+		return nil, apiErr
+	}
+	return resp.Body, nil
+}
+
+func (b *openAIBackend) GetModel(ctx context.Context, model string) (*genai.Model, error) {
+	body, err := b.do(ctx, http.MethodGet, "/models/"+url.PathEscape(model), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var m oaiModel
+	if err := json.NewDecoder(body).Decode(&m); err != nil {
+		return nil, err
+	}
+	return &genai.Model{Name: m.ID, Description: m.OwnedBy}, nil
+}
+
+func (b *openAIBackend) ListModels(ctx context.Context) iter.Seq2[*genai.Model, error] {
+	return func(yield func(*genai.Model, error) bool) {
+		body, err := b.do(ctx, http.MethodGet, "/models", nil)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer body.Close()
+		var list struct {
+			Data []oaiModel `json:"data"`
+		}
+		if err := json.NewDecoder(body).Decode(&list); err != nil {
+			yield(nil, err)
+			return
+		}
+		for _, m := range list.Data {
+			if !yield(&genai.Model{Name: m.ID, Description: m.OwnedBy}, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (b *openAIBackend) GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	req, err := newOAIChatRequest(model, contents, config)
+	if err != nil {
+		return nil, err
+	}
+	body, err := b.do(ctx, http.MethodPost, "/chat/completions", req)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var resp oaiChatResponse
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return nil, err
+	}
+	res := &genai.GenerateContentResponse{ModelVersion: resp.Model}
+	for _, c := range resp.Choices {
+		if c.Message == nil {
+			continue
+		}
+		parts := messageToParts(c.Message)
+		for _, tc := range c.Message.ToolCalls {
+			parts = append(parts, toolCallToPart(tc))
+		}
+		res.Candidates = append(res.Candidates, &genai.Candidate{
+			Index:        c.Index,
+			Content:      &genai.Content{Role: "model", Parts: parts},
+			FinishReason: finishReason(c.FinishReason),
+		})
+	}
+	res.UsageMetadata = usageMetadata(resp.Usage)
+	return res, nil
+}
+
+// GenerateContentStream parses server-sent events into genai responses.
+// Tool call fragments are accumulated and emitted with the finish reason.
+func (b *openAIBackend) GenerateContentStream(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) iter.Seq2[*genai.GenerateContentResponse, error] {
+	return func(yield func(*genai.GenerateContentResponse, error) bool) {
+		req, err := newOAIChatRequest(model, contents, config)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		req.Stream = true
+		req.StreamOptions = &oaiStreamOptions{IncludeUsage: true}
+		body, err := b.do(ctx, http.MethodPost, "/chat/completions", req)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		defer body.Close()
+
+		toolCalls := map[oaiToolKey]*oaiToolCall{} // streamed in fragments
+		order := map[int32][]int{}                 // tool indexes of each choice
+		reader := bufio.NewReader(body)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil && err != io.EOF {
+				yield(nil, err)
+				return
+			}
+			line = strings.TrimSpace(line)
+			if data, ok := strings.CutPrefix(line, "data:"); ok {
+				data = strings.TrimSpace(data)
+				if data == "[DONE]" {
+					return
+				}
+				var chunk oaiChatResponse
+				if jsonErr := json.Unmarshal([]byte(data), &chunk); jsonErr != nil {
+					yield(nil, fmt.Errorf("openai stream: %v", jsonErr))
+					return
+				}
+				res := &genai.GenerateContentResponse{
+					ModelVersion:  chunk.Model,
+					UsageMetadata: usageMetadata(chunk.Usage),
+				}
+				for _, c := range chunk.Choices {
+					cand := &genai.Candidate{Index: c.Index, Content: &genai.Content{Role: "model"}}
+					if c.Delta != nil {
+						cand.Content.Parts = messageToParts(c.Delta)
+						for _, tc := range c.Delta.ToolCalls {
+							idx := len(order[c.Index])
+							if tc.Index != nil {
+								idx = *tc.Index
+							}
+							key := oaiToolKey{c.Index, idx}
+							acc, ok := toolCalls[key]
+							if !ok {
+								acc = &oaiToolCall{}
+								toolCalls[key] = acc
+								order[c.Index] = append(order[c.Index], idx)
+							}
+							if tc.ID != "" {
+								acc.ID = tc.ID
+							}
+							acc.Function.Name += tc.Function.Name
+							acc.Function.Arguments += tc.Function.Arguments
+						}
+					}
+					if c.FinishReason != "" {
+						for _, idx := range order[c.Index] {
+							key := oaiToolKey{c.Index, idx}
+							cand.Content.Parts = append(cand.Content.Parts, toolCallToPart(*toolCalls[key]))
+							delete(toolCalls, key)
+						}
+						delete(order, c.Index)
+						cand.FinishReason = finishReason(c.FinishReason)
+					}
+					res.Candidates = append(res.Candidates, cand)
+				}
+				if len(res.Candidates) > 0 || res.UsageMetadata != nil {
+					if !yield(res, nil) {
+						return
+					}
+				}
+			}
+			if err == io.EOF {
+				return
+			}
+		}
+	}
+}
+
+func (b *openAIBackend) EmbedContent(ctx context.Context, model string, contents []*genai.Content) (*genai.EmbedContentResponse, error) {
+	req := oaiEmbeddingRequest{Model: model}
+	for _, c := range contents {
+		var sb strings.Builder
+		for _, p := range c.Parts {
+			sb.WriteString(p.Text)
+		}
+		req.Input = append(req.Input, sb.String())
+	}
+	body, err := b.do(ctx, http.MethodPost, "/embeddings", req)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	var resp oaiEmbeddingResponse
+	if err := json.NewDecoder(body).Decode(&resp); err != nil {
+		return nil, err
+	}
+	res := &genai.EmbedContentResponse{Embeddings: make([]*genai.ContentEmbedding, len(resp.Data))}
+	for i, d := range resp.Data {
+		idx := d.Index
+		if idx < 0 || idx >= len(res.Embeddings) {
+			idx = i
+		}
+		res.Embeddings[idx] = &genai.ContentEmbedding{Values: d.Embedding}
+	}
+	return res, nil
+}
+
+// CountTokens estimates four characters per token since the protocol has no counting endpoint.
+func (b *openAIBackend) CountTokens(ctx context.Context, model string, contents []*genai.Content) (*genai.CountTokensResponse, error) {
+	var n int
+	for _, c := range contents {
+		for _, p := range c.Parts {
+			n += len(p.Text)
+			if p.InlineData != nil {
+				n += len(p.InlineData.Data)
+			}
+		}
+	}
+	return &genai.CountTokensResponse{TotalTokens: int32((n + 3) / 4)}, nil
+}
+
+// newOAIChatRequest maps genai contents and config onto a chat completions request.
+func newOAIChatRequest(model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*oaiChatRequest, error) {
+	req := &oaiChatRequest{Model: model}
+	if config == nil {
+		config = &genai.GenerateContentConfig{}
+	}
+	if config.SystemInstruction != nil {
+		var texts []string
+		for _, p := range config.SystemInstruction.Parts {
+			if p.Text != "" {
+				texts = append(texts, p.Text)
+			}
+		}
+		if len(texts) > 0 {
+			req.Messages = append(req.Messages, oaiMessage{Role: "system", Content: strings.Join(texts, "\n")})
+		}
+	}
+	for _, c := range contents {
+		msgs, err := contentToMessages(c)
+		if err != nil {
+			return nil, err
+		}
+		req.Messages = append(req.Messages, msgs...)
+	}
+	req.Temperature = config.Temperature
+	req.TopP = config.TopP
+	req.MaxTokens = config.MaxOutputTokens
+	req.N = config.CandidateCount
+	req.Stop = config.StopSequences
+	for _, tool := range config.Tools {
+		if tool.FunctionDeclarations == nil {
+			return nil, fmt.Errorf("openai backend: only function tools are %w", errors.ErrUnsupported)
+		}
+		for _, decl := range tool.FunctionDeclarations {
+			fn := oaiFunction{Name: decl.Name, Description: decl.Description}
+			if decl.ParametersJsonSchema != nil {
+				fn.Parameters = decl.ParametersJsonSchema
+			} else if decl.Parameters != nil {
+				params, err := schemaToJSONSchema(decl.Parameters)
+				if err != nil {
+					return nil, err
+				}
+				fn.Parameters = params
+			} else {
+				fn.Parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			req.Tools = append(req.Tools, oaiTool{Type: "function", Function: fn})
+		}
+	}
+	if config.ResponseMIMEType == "application/json" {
+		if config.ResponseJsonSchema != nil {
+			req.ResponseFormat = &oaiResponseFormat{
+				Type:       "json_schema",
+				JSONSchema: &oaiJSONSchema{Name: "response", Schema: config.ResponseJsonSchema},
+			}
+		} else {
+			req.ResponseFormat = &oaiResponseFormat{Type: "json_object"}
+		}
+	}
+	return req, nil
+}
+
+// contentToMessages converts a genai content into one or more chat messages.
+// Function responses become separate tool messages.
+func contentToMessages(c *genai.Content) ([]oaiMessage, error) {
+	role := "user"
+	if c.Role == "model" {
+		role = "assistant"
+	}
+	var res []oaiMessage
+	var texts []string
+	var images []oaiContentPart
+	var toolCalls []oaiToolCall
+	for _, p := range c.Parts {
+		switch {
+		case p.Thought:
+			continue // thoughts are not replayed
+		case p.Text != "":
+			texts = append(texts, p.Text)
+		case p.InlineData != nil:
+			if !strings.HasPrefix(p.InlineData.MIMEType, "image") {
+				return nil, fmt.Errorf("openai backend: inline data of type %s %w", p.InlineData.MIMEType, errors.ErrUnsupported)
+			}
+			images = append(images, oaiContentPart{
+				Type: "image_url",
+				ImageURL: &oaiImageURL{
+					URL: "data:" + p.InlineData.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(p.InlineData.Data),
+				},
+			})
+		case p.FileData != nil:
+			return nil, fmt.Errorf("openai backend: file data '%s' %w", p.FileData.FileURI, errors.ErrUnsupported)
+		case p.FunctionCall != nil:
+			args, err := json.Marshal(p.FunctionCall.Args)
+			if err != nil {
+				return nil, err
+			}
+			toolCalls = append(toolCalls, oaiToolCall{
+				ID:       callID(p.FunctionCall.ID, p.FunctionCall.Name),
+				Type:     "function",
+				Function: oaiFunctionCall{Name: p.FunctionCall.Name, Arguments: string(args)},
+			})
+		case p.FunctionResponse != nil:
+			out, err := json.Marshal(p.FunctionResponse.Response)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, oaiMessage{
+				Role:       "tool",
+				ToolCallID: callID(p.FunctionResponse.ID, p.FunctionResponse.Name),
+				Content:    string(out),
+			})
+		}
+	}
+	if len(texts) == 0 && len(images) == 0 && len(toolCalls) == 0 {
+		return res, nil
+	}
+	msg := oaiMessage{Role: role, ToolCalls: toolCalls}
+	if len(images) > 0 {
+		var content []oaiContentPart
+		for _, t := range texts {
+			content = append(content, oaiContentPart{Type: "text", Text: t})
+		}
+		msg.Content = append(content, images...)
+	} else if len(texts) > 0 {
+		msg.Content = strings.Join(texts, "")
+	}
+	return append([]oaiMessage{msg}, res...), nil
+}
+
+// callID falls back on the function name when the call carries no ID.
+func callID(id string, name string) string {
+	if id != "" {
+		return id
+	}
+	return name
+}
+
+// schemaToJSONSchema converts a genai schema into a lower-case JSON schema.
+func schemaToJSONSchema(s *genai.Schema) (map[string]any, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	lowerTypes(m)
+	return m, nil
+}
+
+func lowerTypes(m map[string]any) {
+	if t, ok := m["type"].(string); ok {
+		m["type"] = strings.ToLower(t)
+	}
+	delete(m, "nullable")
+	if props, ok := m["properties"].(map[string]any); ok {
+		for _, v := range props {
+			if sub, ok := v.(map[string]any); ok {
+				lowerTypes(sub)
+			}
+		}
+	}
+	if items, ok := m["items"].(map[string]any); ok {
+		lowerTypes(items)
+	}
+}
+
+func messageToParts(m *oaiMessageOut) []*genai.Part {
+	var parts []*genai.Part
+	if thought := m.ReasoningContent + m.Reasoning; thought != "" {
+		parts = append(parts, &genai.Part{Text: thought, Thought: true})
+	}
+	if m.Content != "" {
+		parts = append(parts, &genai.Part{Text: m.Content})
+	}
+	return parts
+}
+
+func toolCallToPart(tc oaiToolCall) *genai.Part {
+	args := map[string]any{}
+	if tc.Function.Arguments != "" {
+		if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+			args = map[string]any{"arguments": tc.Function.Arguments}
+		}
+	}
+	return &genai.Part{FunctionCall: &genai.FunctionCall{
+		ID:   tc.ID,
+		Name: tc.Function.Name,
+		Args: args,
+	}}
+}
+
+func finishReason(reason string) genai.FinishReason {
+	switch reason {
+	case "":
+		return ""
+	case "stop", "tool_calls", "function_call":
+		return genai.FinishReasonStop
+	case "length":
+		return genai.FinishReasonMaxTokens
+	case "content_filter":
+		return genai.FinishReasonSafety
+	default:
+		return genai.FinishReasonOther
+	}
+}
+
+func usageMetadata(u *oaiUsage) *genai.GenerateContentResponseUsageMetadata {
+	if u == nil {
+		return nil
+	}
+	return &genai.GenerateContentResponseUsageMetadata{
+		PromptTokenCount:     u.PromptTokens,
+		CandidatesTokenCount: u.CompletionTokens,
+		TotalTokenCount:      u.TotalTokens,
+	}
+}
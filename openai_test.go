@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+// newOpenAIStandIn serves canned chat completions, embeddings and models.
+func newOpenAIStandIn(t *testing.T, chunks []string) (*httptest.Server, *[]oaiChatRequest) {
+	t.Helper()
+	var reqs []oaiChatRequest
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		var req oaiChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reqs = append(reqs, req)
+		if !req.Stream {
+			fmt.Fprint(w, `{"model":"stand-in","choices":[{"index":0,"message":{"role":"assistant","content":"pong"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, c := range chunks {
+			fmt.Fprintf(w, "data: %s\n\n", c)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	})
+	mux.HandleFunc("POST /v1/embeddings", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":[{"index":0,"embedding":[0.1,0.2,0.3]}]}`)
+	})
+	mux.HandleFunc("GET /v1/models/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":{"message":"model not found"}}`)
+			return
+		}
+		fmt.Fprintf(w, `{"id":"%s","owned_by":"library"}`, r.PathValue("id"))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, &reqs
+}
+
+func TestOpenAIBackend_Stream(t *testing.T) {
+	srv, reqs := newOpenAIStandIn(t, []string{
+		`{"model":"m","choices":[{"index":0,"delta":{"role":"assistant","reasoning_content":"hmm"}}]}`,
+		`{"model":"m","choices":[{"index":0,"delta":{"content":"Hello"}}]}`,
+		`{"model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"Lookup","arguments":"{\"q\":"}}]}}]}`,
+		`{"model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"go\"}"}}]}}]}`,
+		`{"model":"m","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`{"model":"m","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":7,"total_tokens":12}}`,
+	})
+	b := newOpenAIBackend(srv.URL+"/v1", "")
+	config := &genai.GenerateContentConfig{
+		Temperature:       genai.Ptr(float32(0)),
+		SystemInstruction: &genai.Content{Parts: []*genai.Part{{Text: "be brief"}}},
+		Tools: []*genai.Tool{{FunctionDeclarations: []*genai.FunctionDeclaration{{
+			Name: "Lookup",
+			Parameters: &genai.Schema{
+				Type:       genai.TypeObject,
+				Properties: map[string]*genai.Schema{"q": {Type: genai.TypeString}},
+			},
+		}}}},
+	}
+	contents := []*genai.Content{{Role: "user", Parts: []*genai.Part{{Text: "hi"}}}}
+
+	var text, thought strings.Builder
+	var calls []*genai.FunctionCall
+	var finish genai.FinishReason
+	var total int32
+	for resp, err := range b.GenerateContentStream(context.Background(), "m", contents, config) {
+		if err != nil {
+			t.Fatalf("stream error: %v", err)
+		}
+		for _, c := range resp.Candidates {
+			for _, p := range c.Content.Parts {
+				if p.Thought {
+					thought.WriteString(p.Text)
+				} else {
+					text.WriteString(p.Text)
+				}
+			}
+			if c.FinishReason != "" {
+				finish = c.FinishReason
+			}
+		}
+		calls = append(calls, resp.FunctionCalls()...)
+		if resp.UsageMetadata != nil {
+			total = resp.UsageMetadata.TotalTokenCount
+		}
+	}
+
+	if text.String() != "Hello" || thought.String() != "hmm" {
+		t.Errorf("unexpected text %q or thought %q", text.String(), thought.String())
+	}
+	if len(calls) != 1 || calls[0].ID != "call_1" || calls[0].Args["q"] != "go" {
+		t.Errorf("unexpected function calls: %+v", calls)
+	}
+	if finish != genai.FinishReasonStop || total != 12 {
+		t.Errorf("unexpected finish %s or total %d", finish, total)
+	}
+	req := (*reqs)[0]
+	if req.Messages[0].Role != "system" || req.Messages[1].Content != "hi" {
+		t.Errorf("unexpected messages: %+v", req.Messages)
+	}
+	params, _ := req.Tools[0].Function.Parameters.(map[string]any)
+	if params["type"] != "object" {
+		t.Errorf("expected lower-case JSON schema, got %+v", params)
+	}
+}
+
+func TestOpenAIBackend_StreamCandidates(t *testing.T) {
+	srv, _ := newOpenAIStandIn(t, []string{
+		`{"model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_a","function":{"name":"Lookup","arguments":"{\"q\":"}}]}}]}`,
+		`{"model":"m","choices":[{"index":1,"delta":{"tool_calls":[{"index":0,"id":"call_b","function":{"name":"Lookup","arguments":"{\"q\":"}}]}}]}`,
+		`{"model":"m","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"go\"}"}}]}},{"index":1,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"rust\"}"}}]}}]}`,
+		`{"model":"m","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"},{"index":1,"delta":{},"finish_reason":"tool_calls"}]}`,
+	})
+	b := newOpenAIBackend(srv.URL+"/v1", "")
+	contents := []*genai.Content{{Role: "user", Parts: []*genai.Part{{Text: "hi"}}}}
+	config := &genai.GenerateContentConfig{CandidateCount: 2}
+
+	calls := map[int32][]*genai.FunctionCall{}
+	for resp, err := range b.GenerateContentStream(context.Background(), "m", contents, config) {
+		if err != nil {
+			t.Fatalf("stream error: %v", err)
+		}
+		for _, c := range resp.Candidates {
+			for _, p := range c.Content.Parts {
+				if p.FunctionCall != nil {
+					calls[c.Index] = append(calls[c.Index], p.FunctionCall)
+				}
+			}
+		}
+	}
+	for i, expected := range []string{"go", "rust"} {
+		fc := calls[int32(i)]
+		if len(fc) != 1 || fc[0].Args["q"] != expected {
+			t.Errorf("candidate %d: expected one call for %q, got %+v", i, expected, fc)
+		}
+	}
+}
+
+func TestOpenAIBackend_EmbedAndModel(t *testing.T) {
+	srv, _ := newOpenAIStandIn(t, nil)
+	b := newOpenAIBackend(srv.URL+"/v1", "")
+
+	res, err := b.EmbedContent(context.Background(), "e", []*genai.Content{{Parts: []*genai.Part{{Text: "x"}}}})
+	if err != nil {
+		t.Fatalf("EmbedContent failed: %v", err)
+	}
+	if len(res.Embeddings) != 1 || len(res.Embeddings[0].Values) != 3 {
+		t.Errorf("unexpected embeddings: %+v", res.Embeddings)
+	}
+
+	m, err := b.GetModel(context.Background(), "llama3")
+	if err != nil || m.Name != "llama3" {
+		t.Errorf("GetModel got %+v, %v", m, err)
+	}
+	_, err = b.GetModel(context.Background(), "missing")
+	var apiErr genai.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 API error, got %v", err)
+	}
+}
+
+func TestContentToMessages(t *testing.T) {
+	c := &genai.Content{Role: "user", Parts: []*genai.Part{
+		{FunctionResponse: &genai.FunctionResponse{ID: "call_1", Name: "Lookup", Response: map[string]any{"output": "ok"}}},
+	}}
+	msgs, err := contentToMessages(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].Role != "tool" || msgs[0].ToolCallID != "call_1" {
+		t.Errorf("unexpected tool message: %+v", msgs)
+	}
+
+	c = &genai.Content{Role: "user", Parts: []*genai.Part{{FileData: &genai.FileData{FileURI: "gs://x"}}}}
+	if _, err := contentToMessages(c); err == nil {
+		t.Errorf("expected file data to be rejected")
+	}
+}
+
+func TestGenContent_OpenAIBackend(t *testing.T) {
+	srv, reqs := newOpenAIStandIn(t, []string{
+		`{"model":"m","choices":[{"index":0,"delta":{"content":"pong"},"finish_reason":"stop"}]}`,
+	})
+	input := strings.NewReader("")
+	var output strings.Builder
+
+	ctx := prepareTestContext(t, true, "-m", "m", "ping")
+	params := ctx.Value(core.ParamsKey).(*core.Parameters)
+	params.Backend = "openai"
+	params.BaseURL = srv.URL + "/v1"
+	params.OutRedirected = true
+
+	if err := genContent(ctx, input, &output); err != nil {
+		t.Fatalf("genContent failed: %v", err)
+	}
+	AssertOutput(t, output.String(), OutputExpectations{
+		Contains: []string{"pong"},
+	})
+	if len(*reqs) != 1 || (*reqs)[0].Model != "m" {
+		t.Errorf("unexpected requests: %+v", *reqs)
+	}
+}
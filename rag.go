@@ -90,6 +90,34 @@ func queryDigest(path string, queryEmbedding *genai.ContentEmbedding, cand []Que
 	return selection, nil
 }
 
+// readDigest calls fn for each document of the digest at path.
+func readDigest(path string, fn func(Document) error) error {
+	d, err := Open(path, nil)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	for s := 1; s <= d.Segments(); s++ {
+		for idx := 0; ; idx++ {
+			data, err := d.Read(uint64(s), uint64(idx))
+			if err == ErrEOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			doc, err := deserializeDoc(data)
+			if err != nil {
+				return err
+			}
+			if err := fn(doc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // deserializeDoc deserializes []byte to Document.
 func deserializeDoc(data []byte) (Document, error) {
 	var doc Document
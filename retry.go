@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+// retryPolicy bounds the number of attempts and the delay between them.
+type retryPolicy struct {
+	attempts int           // including the first one
+	delay    time.Duration // doubled after each attempt
+	verbose  bool
+}
+
+func newRetryPolicy(params *core.Parameters) retryPolicy {
+	return retryPolicy{attempts: max(params.Retries, 1), delay: params.RetryDelay, verbose: params.Verbose}
+}
+
+// isTransient reports whether err is worth another attempt.
+func isTransient(err error) bool {
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case 429, 500, 502, 503, 504:
+			return true
+		}
+		return false
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// retryAfter returns the delay requested by the server, if any.
+// Gemini sends a google.rpc.RetryInfo detail, the openai backend maps Retry-After onto one.
+func retryAfter(err error) time.Duration {
+	var apiErr genai.APIError
+	if !errors.As(err, &apiErr) {
+		return 0
+	}
+	for _, detail := range apiErr.Details {
+		if s, ok := detail["retryDelay"].(string); ok {
+			if d, err := time.ParseDuration(s); err == nil {
+				return d
+			}
+		}
+	}
+	return 0
+}
+
+// parseRetryAfter converts a Retry-After header in seconds or HTTP date.
+func parseRetryAfter(val string) time.Duration {
+	if secs, err := strconv.Atoi(val); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := time.Parse(time.RFC1123, val); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+// backoff returns the jittered delay before attempt+1.
+func (p retryPolicy) backoff(attempt int, err error) time.Duration {
+	d := p.delay << (attempt - 1)
+	if d <= 0 { // no delay or overflow
+		d = max(p.delay, 0)
+	}
+	if d > 0 {
+		d = d/2 + rand.N(d/2+1)
+	}
+	return max(d, retryAfter(err))
+}
+
+// wait sleeps before the next attempt and reports whether there should be one.
+func (p retryPolicy) wait(ctx context.Context, attempt int, what string, err error) bool {
+	return isTransient(err) && p.pause(ctx, attempt, what, err)
+}
+
+// pause is wait for callers which cannot tell transient errors apart.
+func (p retryPolicy) pause(ctx context.Context, attempt int, what string, err error) bool {
+	if attempt >= p.attempts {
+		return false
+	}
+	d := p.backoff(attempt, err)
+	if p.verbose {
+		fmt.Fprintf(os.Stderr, infos("%s retry %d/%d in %s: %v\n"), what, attempt, p.attempts-1, d.Round(time.Millisecond), err)
+	}
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// retry calls fn until it succeeds, fails for good or attempts run out.
+func retry[T any](ctx context.Context, p retryPolicy, what string, fn func() (T, error)) (T, error) {
+	for attempt := 1; ; attempt++ {
+		res, err := fn()
+		if err == nil || !p.wait(ctx, attempt, what, err) {
+			return res, err
+		}
+	}
+}
+
+// retryBackend retries requests failing with transient errors.
+type retryBackend struct {
+	core.Wrapper
+	policy retryPolicy
+}
+
+func (b *retryBackend) GetModel(ctx context.Context, model string) (*genai.Model, error) {
+	return retry(ctx, b.policy, "model", func() (*genai.Model, error) {
+		return b.Backend.GetModel(ctx, model)
+	})
+}
+
+func (b *retryBackend) GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	return retry(ctx, b.policy, "generation", func() (*genai.GenerateContentResponse, error) {
+		return b.Backend.GenerateContent(ctx, model, contents, config)
+	})
+}
+
+// GenerateContentStream starts the stream again when it fails before the
+// first chunk. Once a chunk is yielded, the error is returned as a new
+// attempt would not produce the same text.
+func (b *retryBackend) GenerateContentStream(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) iter.Seq2[*genai.GenerateContentResponse, error] {
+	return func(yield func(*genai.GenerateContentResponse, error) bool) {
+		for attempt := 1; ; attempt++ {
+			yielded := false
+			var err error
+			for resp, rErr := range b.Backend.GenerateContentStream(ctx, model, contents, config) {
+				if rErr != nil {
+					err = rErr
+					break
+				}
+				yielded = true
+				if !yield(resp, nil) {
+					return
+				}
+			}
+			if err == nil {
+				return
+			}
+			if yielded || !b.policy.wait(ctx, attempt, "generation", err) {
+				yield(nil, err)
+				return
+			}
+		}
+	}
+}
+
+func (b *retryBackend) EmbedContent(ctx context.Context, model string, contents []*genai.Content) (*genai.EmbedContentResponse, error) {
+	return retry(ctx, b.policy, "embedding", func() (*genai.EmbedContentResponse, error) {
+		return b.Backend.EmbedContent(ctx, model, contents)
+	})
+}
+
+func (b *retryBackend) CountTokens(ctx context.Context, model string, contents []*genai.Content) (*genai.CountTokensResponse, error) {
+	return retry(ctx, b.policy, "count", func() (*genai.CountTokensResponse, error) {
+		return b.Backend.CountTokens(ctx, model, contents)
+	})
+}
+
+func (b *retryBackend) UploadFile(ctx context.Context, path string) (*genai.File, error) {
+	return retry(ctx, b.policy, "upload", func() (*genai.File, error) {
+		return b.Wrapper.UploadFile(ctx, path)
+	})
+}
+
+func (b *retryBackend) GetFile(ctx context.Context, name string) (*genai.File, error) {
+	return retry(ctx, b.policy, "file", func() (*genai.File, error) {
+		return b.Wrapper.GetFile(ctx, name)
+	})
+}
+
+func (b *retryBackend) GetBatchJob(ctx context.Context, name string) (*genai.BatchJob, error) {
+	return retry(ctx, b.policy, "job", func() (*genai.BatchJob, error) {
+		return b.Wrapper.GetBatchJob(ctx, name)
+	})
+}
+
+func (b *retryBackend) GetCachedContent(ctx context.Context, name string) (*genai.CachedContent, error) {
+	return retry(ctx, b.policy, "cache", func() (*genai.CachedContent, error) {
+		return b.Wrapper.GetCachedContent(ctx, name)
+	})
+}
+
+func (b *retryBackend) GenerateImages(ctx context.Context, model string, prompt string, config *genai.GenerateImagesConfig) (*genai.GenerateImagesResponse, error) {
+	return retry(ctx, b.policy, "image", func() (*genai.GenerateImagesResponse, error) {
+		return b.Wrapper.GenerateImages(ctx, model, prompt, config)
+	})
+}
+
+func (b *retryBackend) EditImage(ctx context.Context, model string, prompt string, refs []genai.ReferenceImage, config *genai.EditImageConfig) (*genai.EditImageResponse, error) {
+	return retry(ctx, b.policy, "image", func() (*genai.EditImageResponse, error) {
+		return b.Wrapper.EditImage(ctx, model, prompt, refs, config)
+	})
+}
+
+func (b *retryBackend) UpscaleImage(ctx context.Context, model string, image *genai.Image, factor string, config *genai.UpscaleImageConfig) (*genai.UpscaleImageResponse, error) {
+	return retry(ctx, b.policy, "image", func() (*genai.UpscaleImageResponse, error) {
+		return b.Wrapper.UpscaleImage(ctx, model, image, factor, config)
+	})
+}
+
+func (b *retryBackend) GenerateVideos(ctx context.Context, model string, prompt string, image *genai.Image, config *genai.GenerateVideosConfig) (*genai.GenerateVideosOperation, error) {
+	return retry(ctx, b.policy, "video", func() (*genai.GenerateVideosOperation, error) {
+		return b.Wrapper.GenerateVideos(ctx, model, prompt, image, config)
+	})
+}
+
+func (b *retryBackend) GetVideosOperation(ctx context.Context, op *genai.GenerateVideosOperation) (*genai.GenerateVideosOperation, error) {
+	return retry(ctx, b.policy, "video", func() (*genai.GenerateVideosOperation, error) {
+		return b.Wrapper.GetVideosOperation(ctx, op)
+	})
+}
+
+func (b *retryBackend) DownloadVideo(ctx context.Context, video *genai.Video) ([]byte, error) {
+	return retry(ctx, b.policy, "video", func() ([]byte, error) {
+		return b.Wrapper.DownloadVideo(ctx, video)
+	})
+}
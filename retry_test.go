@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+func TestRetryBackend_Generate(t *testing.T) {
+	unavailable := genai.APIError{Code: 503, Message: "overloaded"}
+	testCases := []struct {
+		name    string
+		replies []fakeReply
+		calls   int
+		wantErr bool
+	}{
+		{"transient", []fakeReply{{err: unavailable}, textReply("ok")}, 2, false},
+		{"exhausted", []fakeReply{{err: unavailable}, {err: unavailable}, {err: unavailable}, textReply("ok")}, 3, true},
+		{"permanent", []fakeReply{{err: genai.APIError{Code: 400}}, textReply("ok")}, 1, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeBackend{replies: tc.replies}
+			b := &retryBackend{Wrapper: core.Wrapper{Backend: fake}, policy: retryPolicy{attempts: 3, delay: time.Millisecond}}
+			_, err := b.GenerateContent(context.Background(), "m", nil, nil)
+			if (err != nil) != tc.wantErr || len(fake.contents) != tc.calls {
+				t.Errorf("got %v after %d calls", err, len(fake.contents))
+			}
+		})
+	}
+}
+
+// chunk builds a streamed response with a single text part.
+func chunk(text string, thought bool) *genai.GenerateContentResponse {
+	return &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{
+		Content: &genai.Content{Role: "model", Parts: []*genai.Part{{Text: text, Thought: thought}}},
+	}}}
+}
+
+func TestRetryBackend_Stream(t *testing.T) {
+	testCases := []struct {
+		name    string
+		first   fakeReply
+		want    string
+		calls   int
+		wantErr bool
+	}{
+		{"before first chunk", fakeReply{err: io.ErrUnexpectedEOF}, "Hello world!", 2, false},
+		{"after first chunk", fakeReply{chunks: []*genai.GenerateContentResponse{chunk("Hello ", false)}, err: io.ErrUnexpectedEOF}, "Hello ", 1, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			second := fakeReply{chunks: []*genai.GenerateContentResponse{chunk("Hello ", false), chunk("world", false), chunk("!", false)}}
+			fake := &fakeBackend{replies: []fakeReply{tc.first, second}}
+			b := &retryBackend{Wrapper: core.Wrapper{Backend: fake}, policy: retryPolicy{attempts: 2, delay: time.Millisecond}}
+
+			var text strings.Builder
+			var err error
+			for resp, rErr := range b.GenerateContentStream(context.Background(), "m", nil, nil) {
+				if rErr != nil {
+					err = rErr
+					break
+				}
+				text.WriteString(resp.Candidates[0].Content.Parts[0].Text)
+			}
+			if (err != nil) != tc.wantErr || text.String() != tc.want || len(fake.contents) != tc.calls {
+				t.Errorf("got %q and %v after %d calls", text.String(), err, len(fake.contents))
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"error":{"message":"slow down"}}`)
+	}))
+	defer srv.Close()
+
+	_, err := newOpenAIBackend(srv.URL, "").GetModel(context.Background(), "m")
+	if !isTransient(err) || retryAfter(err) != 7*time.Second {
+		t.Errorf("expected transient error asking for 7s, got %v", err)
+	}
+	p := retryPolicy{attempts: 3, delay: time.Millisecond}
+	if d := p.backoff(1, err); d != 7*time.Second {
+		t.Errorf("expected Retry-After to win over backoff, got %s", d)
+	}
+	if d := p.backoff(3, nil); d < 2*time.Millisecond || d > 4*time.Millisecond {
+		t.Errorf("expected jitter within [2ms, 4ms], got %s", d)
+	}
+	for _, delay := range []time.Duration{0, -time.Second} {
+		if d := (retryPolicy{attempts: 3, delay: delay}).backoff(2, nil); d != 0 {
+			t.Errorf("expected no delay for %s, got %s", delay, d)
+		}
+	}
+	if d := (retryPolicy{attempts: 80, delay: time.Second}).backoff(70, nil); d < time.Second/2 || d > time.Second {
+		t.Errorf("expected overflowing delay to stay at the initial one, got %s", d)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/genai"
+)
+
+// generateValid holds the output, or the events with -ndjson, back until the
+// response validates against the JSON schema, sending the violations back to
+// the model for repair up to Repairs times.
+func (g *Generator) generateValid(config *genai.GenerateContentConfig) error {
+	out := g.out
+	defer func() { g.out = out }()
+	var violations []string
+	for attempt := 0; attempt <= g.params.Repairs; attempt++ {
+		if attempt > 0 {
+			fmt.Fprintf(os.Stderr, "response does not match the JSON schema, repair %d of %d\n", attempt, g.params.Repairs)
+			g.parts = []*genai.Part{{Text: repairPrompt(violations)}}
+		}
+		var buf bytes.Buffer
+		g.out = &buf
+		release := func(bool) error { return nil }
+		if g.events != nil {
+			release = g.events.hold()
+		}
+		if err := g.generateContent(config); err != nil {
+			release(false)
+			return err
+		}
+		var text string
+		if n := len(g.history); n > 0 {
+			text = contentText(g.history[n-1])
+		}
+		if violations = validateJSON(text, g.schema); len(violations) == 0 {
+			if err := release(true); err != nil {
+				return err
+			}
+			_, err := io.Copy(out, &buf)
+			return err
+		}
+		release(false)
+		if g.params.Verbose {
+			fmt.Fprintf(os.Stderr, infos("%s\n"), text)
+		}
+	}
+	return fmt.Errorf("response does not match the JSON schema after %d attempts:\n%s",
+		g.params.Repairs+1, strings.Join(violations, "\n"))
+}
+
+// repairPrompt asks for a corrected response listing the violations.
+func repairPrompt(violations []string) string {
+	return fmt.Sprintf("Your response does not match the JSON schema:\n%s\nReply with the corrected JSON only.",
+		strings.Join(violations, "\n"))
+}
+
+// validateJSON checks text against a JSON schema and returns the violations
+// located by paths such as $.items[0].name, none if text is valid.
+func validateJSON(text string, schema map[string]any) []string {
+	dec := json.NewDecoder(strings.NewReader(text))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return []string{fmt.Sprintf("$: invalid JSON: %v", err)}
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return []string{"$: unexpected content after the JSON value"}
+	}
+	return validateValue(v, schema, "$")
+}
+
+// validateValue supports the keywords of the schemas accepted by Gemini:
+// type, nullable, enum, anyOf, properties, required, additionalProperties,
+// items, pattern as well as length, size and range bounds.
+func validateValue(v any, schema map[string]any, path string) []string {
+	if schema == nil {
+		return nil
+	}
+	kind := kindOf(v)
+	types := schemaTypes(schema)
+	if kind == "null" && (slices.Contains(types, "null") || schema["nullable"] == true) {
+		return nil
+	}
+	if len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool {
+		return t == kind || (t == "number" && kind == "integer")
+	}) {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(types, " or "), kind)}
+	}
+
+	var errs []string
+	if enum, ok := schema["enum"].([]any); ok && !slices.ContainsFunc(enum, func(e any) bool { return jsonEqual(e, v) }) {
+		errs = append(errs, fmt.Sprintf("%s: %s is not one of %s", path, jsonString(v), jsonString(enum)))
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok && !slices.ContainsFunc(anyOf, func(s any) bool {
+		sub, _ := s.(map[string]any)
+		return len(validateValue(v, sub, path)) == 0
+	}) {
+		errs = append(errs, fmt.Sprintf("%s: matches none of the anyOf schemas", path))
+	}
+
+	switch val := v.(type) {
+	case string:
+		n := float64(utf8.RuneCountInString(val))
+		errs = appendBound(errs, path, "length", n, schema, "minLength", "maxLength")
+		if p, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(p); err == nil && !re.MatchString(val) {
+				errs = append(errs, fmt.Sprintf("%s: %q does not match pattern %s", path, val, p))
+			}
+		}
+	case json.Number:
+		f, _ := val.Float64()
+		errs = appendBound(errs, path, "value", f, schema, "minimum", "maximum")
+		if lim, ok := schemaNumber(schema["exclusiveMinimum"]); ok && f <= lim {
+			errs = append(errs, fmt.Sprintf("%s: value %v must be greater than %v", path, val, lim))
+		}
+		if lim, ok := schemaNumber(schema["exclusiveMaximum"]); ok && f >= lim {
+			errs = append(errs, fmt.Sprintf("%s: value %v must be less than %v", path, val, lim))
+		}
+	case []any:
+		errs = appendBound(errs, path, "number of items", float64(len(val)), schema, "minItems", "maxItems")
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range val {
+				errs = append(errs, validateValue(item, items, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case map[string]any:
+		errs = appendBound(errs, path, "number of properties", float64(len(val)), schema, "minProperties", "maxProperties")
+		if required, ok := schema["required"].([]any); ok {
+			for _, r := range required {
+				if name, ok := r.(string); ok {
+					if _, found := val[name]; !found {
+						errs = append(errs, fmt.Sprintf("%s: missing required property %q", path, name))
+					}
+				}
+			}
+		}
+		props, _ := schema["properties"].(map[string]any)
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			sub, declared := props[k].(map[string]any)
+			switch extra := schema["additionalProperties"].(type) {
+			case bool:
+				if !declared && !extra {
+					errs = append(errs, fmt.Sprintf("%s: unexpected property %q", path, k))
+				}
+			case map[string]any:
+				if !declared {
+					sub = extra
+				}
+			}
+			errs = append(errs, validateValue(val[k], sub, path+"."+k)...)
+		}
+	}
+	return errs
+}
+
+// appendBound checks n against the lower and upper bound keywords of schema.
+func appendBound(errs []string, path string, what string, n float64, schema map[string]any, minKey string, maxKey string) []string {
+	if lim, ok := schemaNumber(schema[minKey]); ok && n < lim {
+		errs = append(errs, fmt.Sprintf("%s: %s %v is below %s %v", path, what, n, minKey, lim))
+	}
+	if lim, ok := schemaNumber(schema[maxKey]); ok && n > lim {
+		errs = append(errs, fmt.Sprintf("%s: %s %v is above %s %v", path, what, n, maxKey, lim))
+	}
+	return errs
+}
+
+// schemaTypes lists the lower case types of a schema whose type is a single
+// name or an array of names, as upper case names are used by Gemini.
+func schemaTypes(schema map[string]any) []string {
+	var types []string
+	switch t := schema["type"].(type) {
+	case string:
+		types = append(types, strings.ToLower(t))
+	case []any:
+		for _, name := range t {
+			if s, ok := name.(string); ok {
+				types = append(types, strings.ToLower(s))
+			}
+		}
+	}
+	return types
+}
+
+// schemaNumber reads a bound which Gemini schemas may hold as a string.
+func schemaNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// kindOf names the JSON type of a decoded value.
+func kindOf(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if f, err := val.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// jsonEqual compares values regardless of how their numbers were decoded.
+func jsonEqual(a any, b any) bool {
+	var na, nb any
+	if json.Unmarshal([]byte(jsonString(a)), &na) != nil || json.Unmarshal([]byte(jsonString(b)), &nb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(na, nb)
+}
+
+func jsonString(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/jdevoo/gen/core"
+)
+
+func TestValidateJSON(t *testing.T) {
+	var recipe map[string]any
+	data, err := os.ReadFile("prompts/recipe.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &recipe); err != nil {
+		t.Fatal(err)
+	}
+	bounds := map[string]any{
+		"type": "OBJECT",
+		"properties": map[string]any{
+			"size":  map[string]any{"type": "STRING", "enum": []any{"S", "M", "L"}},
+			"count": map[string]any{"type": "INTEGER", "minimum": 1, "maximum": "10"},
+			"code":  map[string]any{"type": "string", "pattern": "^[A-Z]{3}$", "nullable": true},
+			"tags":  map[string]any{"type": "array", "maxItems": 2, "items": map[string]any{"type": "string", "minLength": 2}},
+		},
+		"additionalProperties": false,
+	}
+	testCases := []struct {
+		name       string
+		text       string
+		schema     map[string]any
+		violations []string
+	}{
+		{"valid recipe", `{"recipe_name":"tea","ingredients":[{"name":"water","quantity":"1 cup"}],"instructions":["boil"]}`, recipe, nil},
+		{"missing fields", `{"recipe_name":"tea","ingredients":[{"name":"water"}]}`, recipe, []string{
+			`$: missing required property "instructions"`,
+			`$.ingredients[0]: missing required property "quantity"`,
+		}},
+		{"wrong type", `{"recipe_name":1,"ingredients":[],"instructions":"boil"}`, recipe, []string{
+			`$.instructions: expected array, got string`,
+			`$.recipe_name: expected string, got integer`,
+		}},
+		{"not JSON", "```json\n{}\n```", recipe, []string{"$: invalid JSON: invalid character '`' looking for beginning of value"}},
+		{"trailing text", `{} and more`, map[string]any{}, []string{"$: unexpected content after the JSON value"}},
+		{"valid bounds", `{"size":"M","count":10,"code":null,"tags":["ab"]}`, bounds, nil},
+		{"bounds", `{"size":"XL","count":1.5,"code":"abc","tags":["a","bb","cc"],"extra":true}`, bounds, []string{
+			`$.code: "abc" does not match pattern ^[A-Z]{3}$`,
+			`$.count: expected integer, got number`,
+			`$: unexpected property "extra"`,
+			`$.size: "XL" is not one of ["S","M","L"]`,
+			`$.tags: number of items 3 is above maxItems 2`,
+			`$.tags[0]: length 1 is below minLength 2`,
+		}},
+		{"range", `{"count":0}`, bounds, []string{`$.count: value 0 is below minimum 1`}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := validateJSON(tc.text, tc.schema)
+			if !slices.Equal(got, tc.violations) {
+				t.Errorf("expected violations\n%s\ngot\n%s", strings.Join(tc.violations, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestGenContent_Repair(t *testing.T) {
+	valid := `{"recipe_name":"tea","ingredients":[],"instructions":["boil"]}`
+	testCases := []struct {
+		name    string
+		replies []fakeReply
+		output  string
+		wantErr bool
+	}{
+		{"valid", []fakeReply{textReply(valid)}, valid + "\n", false},
+		{"repaired", []fakeReply{textReply(`{"recipe_name":"tea"}`), textReply(valid)}, valid + "\n", false},
+		{"not repaired", []fakeReply{textReply("{}"), textReply("{}")}, "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeBackend{replies: tc.replies}
+			ctx := prepareTestContext(t, true, "-json", "-repair", "1", "-f", filepath.Join("prompts", "recipe.json"), "tea recipe")
+			params := ctx.Value(core.ParamsKey).(*core.Parameters)
+			params.Client = fake
+			params.OutRedirected = true
+			var output strings.Builder
+			err := genContent(ctx, strings.NewReader(""), &output)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if output.String() != tc.output {
+				t.Errorf("expected output %q, got %q", tc.output, output.String())
+			}
+			if tc.wantErr && !strings.Contains(err.Error(), `missing required property "recipe_name"`) {
+				t.Errorf("expected violations in error, got %v", err)
+			}
+			if len(tc.replies) > 1 {
+				repair := fake.contents[1]
+				if len(repair) != 3 || repair[1].Role != "model" || !strings.Contains(repair[2].Parts[0].Text, "$: missing required property") {
+					t.Errorf("expected repair turn after the invalid response, got %+v", repair)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+// server answers OpenAI chat completions and embeddings requests with the
+// Generator configured on the command line: prompts, digests and tools.
+type server struct {
+	params  *core.Parameters
+	keyVals core.ParamMap
+	client  core.Backend
+}
+
+type serveMessage struct {
+	Role             string `json:"role,omitempty"`
+	Content          string `json:"content"`
+	ReasoningContent string `json:"reasoning_content,omitempty"`
+}
+
+type serveChoice struct {
+	Index        int32         `json:"index"`
+	Message      *serveMessage `json:"message,omitempty"`
+	Delta        *serveMessage `json:"delta,omitempty"`
+	FinishReason *string       `json:"finish_reason"`
+}
+
+type serveCompletion struct {
+	ID      string        `json:"id"`
+	Object  string        `json:"object"`
+	Created int64         `json:"created"`
+	Model   string        `json:"model"`
+	Choices []serveChoice `json:"choices"`
+	Usage   *oaiUsage     `json:"usage,omitempty"`
+}
+
+type serveEmbedding struct {
+	Object    string    `json:"object"`
+	Index     int       `json:"index"`
+	Embedding []float32 `json:"embedding"`
+}
+
+type serveModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// runServe listens on params.Serve until ctx is done.
+func runServe(ctx context.Context) error {
+	params, ok := ctx.Value(core.ParamsKey).(*core.Parameters)
+	if !ok {
+		return fmt.Errorf("missing params")
+	}
+	keyVals, ok := ctx.Value(core.KeyValsKey).(core.ParamMap)
+	if !ok {
+		return fmt.Errorf("missing keyVals")
+	}
+	client, err := backendFromContext(ctx)
+	if err != nil {
+		return err
+	}
+	uploads := &uploadOnce{Wrapper: core.Wrapper{Backend: client}, files: map[string]*uploadCall{}}
+	s := &server{params: params, keyVals: keyVals, client: uploads}
+
+	err = listenAndServe(ctx, params.Serve, "/v1", s.handler())
+	params.FileURIs = append(params.FileURIs, uploads.uris()...) // for cleanup
+	return err
+}
+
+// listenAndServe runs handler on addr until ctx is done.
+func listenAndServe(ctx context.Context, addr string, path string, handler http.Handler) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Handler:     handler,
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	fmt.Fprintf(os.Stderr, infos("serving http://%s%s\n"), ln.Addr(), path)
+
+	errc := make(chan error, 1)
+	go func() { errc <- srv.Serve(ln) }()
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err = srv.Shutdown(shutdown)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/chat/completions", s.chatCompletions)
+	mux.HandleFunc("POST /v1/embeddings", s.embeddings)
+	mux.HandleFunc("GET /v1/models", s.models)
+	return mux
+}
+
+// chatCompletions runs the messages through a Generator. The last message is
+// the prompt, earlier ones are prior turns and system messages are added to
+// the system instructions. Tool calls are resolved by gen and not returned,
+// so messages with tool calls or results are rejected.
+func (s *server) chatCompletions(w http.ResponseWriter, r *http.Request) {
+	var req oaiChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		serveError(w, http.StatusBadRequest, err)
+		return
+	}
+	sysParts, history, turn, err := messagesToContents(req.Messages)
+	if err != nil {
+		serveError(w, http.StatusBadRequest, err)
+		return
+	}
+	ctx, p := s.requestContext(r.Context(), &req)
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	g, err := newGenerator(ctx, strings.NewReader(""), io.Discard)
+	if err != nil {
+		serveError(w, http.StatusInternalServerError, err)
+		return
+	}
+	g.sysParts = sysParts
+	g.history = history
+	g.parts = turn
+	g.prompts = turn // kept out of a cache
+
+	res := serveCompletion{
+		ID:      fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano()),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   p.GenModel,
+	}
+	if req.Stream {
+		s.stream(w, g, res, req.StreamOptions != nil && req.StreamOptions.IncludeUsage)
+		return
+	}
+
+	var text, thoughts strings.Builder
+	g.events = &eventEmitter{send: func(ev event) error {
+		switch ev.Type {
+		case "text":
+			text.WriteString(ev.Text)
+		case "thought":
+			thoughts.WriteString(ev.Text)
+		}
+		return nil
+	}}
+	if err := g.run(); err != nil {
+		serveError(w, errorStatus(err), err)
+		return
+	}
+	msg := &serveMessage{Role: "assistant", Content: text.String(), ReasoningContent: thoughts.String()}
+	reason := stopReason(g.finishReason)
+	res.Choices = []serveChoice{{Message: msg, FinishReason: &reason}}
+	res.Usage = oaiUsageOf(g.usage)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// stream sends text and thoughts as server-sent events as they are generated.
+// Errors are reported with a status code until the first event is sent, then
+// as an error event ending the stream.
+func (s *server) stream(w http.ResponseWriter, g *Generator, res serveCompletion, includeUsage bool) {
+	rc := http.NewResponseController(w)
+	res.Object = "chat.completion.chunk"
+	started := false
+	send := func(chunk serveCompletion) error {
+		data, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			started = true
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	delta := func(msg *serveMessage) error {
+		if !started {
+			msg.Role = "assistant"
+		}
+		chunk := res
+		chunk.Choices = []serveChoice{{Delta: msg}}
+		return send(chunk)
+	}
+
+	g.events = &eventEmitter{send: func(ev event) error {
+		switch ev.Type {
+		case "text":
+			return delta(&serveMessage{Content: ev.Text})
+		case "thought":
+			return delta(&serveMessage{ReasoningContent: ev.Text})
+		}
+		return nil
+	}}
+	if err := g.run(); err != nil {
+		if !started {
+			serveError(w, errorStatus(err), err)
+			return
+		}
+		data, _ := json.Marshal(errorBody(err))
+		fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", data)
+		return
+	}
+
+	reason := stopReason(g.finishReason)
+	msg := &serveMessage{}
+	if !started {
+		msg.Role = "assistant"
+	}
+	chunk := res
+	chunk.Choices = []serveChoice{{Delta: msg, FinishReason: &reason}}
+	if err := send(chunk); err != nil {
+		return
+	}
+	if includeUsage {
+		chunk := res
+		chunk.Choices = []serveChoice{}
+		chunk.Usage = oaiUsageOf(g.usage)
+		if err := send(chunk); err != nil {
+			return
+		}
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// embeddings embeds each input with the embedding model unless one is named.
+func (s *server) embeddings(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Model string          `json:"model"`
+		Input json.RawMessage `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		serveError(w, http.StatusBadRequest, err)
+		return
+	}
+	var inputs []string
+	if err := json.Unmarshal(req.Input, &inputs); err != nil {
+		var input string
+		if err := json.Unmarshal(req.Input, &input); err != nil {
+			serveError(w, http.StatusBadRequest, fmt.Errorf("input must be a string or an array of strings"))
+			return
+		}
+		inputs = []string{input}
+	}
+	model := s.params.EmbModel
+	if req.Model != "" {
+		model = req.Model
+	}
+	res := struct {
+		Object string           `json:"object"`
+		Model  string           `json:"model"`
+		Data   []serveEmbedding `json:"data"`
+	}{Object: "list", Model: model}
+	for i, input := range inputs {
+		emb, err := s.client.EmbedContent(r.Context(), model, []*genai.Content{{Parts: []*genai.Part{{Text: input}}}})
+		if err != nil {
+			serveError(w, errorStatus(err), err)
+			return
+		}
+		if len(emb.Embeddings) == 0 {
+			serveError(w, http.StatusBadGateway, fmt.Errorf("no embedding returned"))
+			return
+		}
+		res.Data = append(res.Data, serveEmbedding{Object: "embedding", Index: i, Embedding: emb.Embeddings[0].Values})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// models lists the generation model followed by its fallbacks.
+func (s *server) models(w http.ResponseWriter, r *http.Request) {
+	res := struct {
+		Object string       `json:"object"`
+		Data   []serveModel `json:"data"`
+	}{Object: "list"}
+	for _, m := range append([]string{s.params.GenModel}, s.params.Fallbacks...) {
+		res.Data = append(res.Data, serveModel{ID: m, Object: "model", OwnedBy: "gen"})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// requestContext stores a copy of params specific to req in ctx. A model
+// other than the one served replaces it along with its fallbacks.
+func (s *server) requestContext(ctx context.Context, req *oaiChatRequest) (context.Context, *core.Parameters) {
+	p := *s.params
+	p.Args = nil
+	p.Client = s.client
+	p.FileURIs = nil
+	p.Interactive = true // nothing to read from stdin
+	p.OutRedirected = true
+	p.ToolRegistry = core.ToolMap{}
+	if req.Model != "" && req.Model != p.GenModel {
+		p.GenModel = req.Model
+		p.Fallbacks = nil
+	}
+	if req.Temperature != nil {
+		p.Temp = float64(*req.Temperature)
+	}
+	if req.TopP != nil {
+		p.TopP = float64(*req.TopP)
+	}
+	kv := core.ParamMap{}
+	for k, v := range s.keyVals {
+		kv[k] = v
+	}
+
+	ctx = context.WithValue(ctx, core.ParamsKey, &p)
+	ctx = context.WithValue(ctx, core.KeyValsKey, kv)
+	return ctx, &p
+}
+
+// messagesToContents splits chat messages into system parts, prior turns
+// and the parts of the last message which must come from the user.
+func messagesToContents(msgs []oaiMessage) ([]*genai.Part, []*genai.Content, []*genai.Part, error) {
+	var sysParts []*genai.Part
+	var history []*genai.Content
+	for _, m := range msgs {
+		parts, err := messageParts(m)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		switch m.Role {
+		case "system", "developer":
+			sysParts = append(sysParts, parts...)
+		case "user":
+			history = append(history, &genai.Content{Role: "user", Parts: parts})
+		case "assistant":
+			if len(m.ToolCalls) > 0 {
+				return nil, nil, nil, fmt.Errorf("tool calls are resolved by gen, not by the caller")
+			}
+			if len(parts) > 0 {
+				history = append(history, &genai.Content{Role: "model", Parts: parts})
+			}
+		case "tool":
+			return nil, nil, nil, fmt.Errorf("tool messages are not supported, tool calls are resolved by gen")
+		default:
+			return nil, nil, nil, fmt.Errorf("unknown role %q", m.Role)
+		}
+	}
+	if len(history) == 0 || history[len(history)-1].Role != "user" {
+		return nil, nil, nil, fmt.Errorf("last message must come from the user")
+	}
+	last := history[len(history)-1]
+	return sysParts, history[:len(history)-1], last.Parts, nil
+}
+
+// messageParts converts string or array content with text and data URL images.
+func messageParts(m oaiMessage) ([]*genai.Part, error) {
+	switch content := m.Content.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return []*genai.Part{{Text: content}}, nil
+	}
+	data, err := json.Marshal(m.Content)
+	if err != nil {
+		return nil, err
+	}
+	var cps []oaiContentPart
+	if err := json.Unmarshal(data, &cps); err != nil {
+		return nil, fmt.Errorf("invalid content of %s message: %v", m.Role, err)
+	}
+	var parts []*genai.Part
+	for _, cp := range cps {
+		switch {
+		case cp.Type == "text":
+			parts = append(parts, &genai.Part{Text: cp.Text})
+		case cp.Type == "image_url" && cp.ImageURL != nil:
+			blob, err := parseDataURL(cp.ImageURL.URL)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, &genai.Part{InlineData: blob})
+		default:
+			return nil, fmt.Errorf("unsupported content type %q", cp.Type)
+		}
+	}
+	return parts, nil
+}
+
+// parseDataURL decodes a base64 data URL such as data:image/png;base64,...
+func parseDataURL(url string) (*genai.Blob, error) {
+	meta, data, ok := strings.Cut(strings.TrimPrefix(url, "data:"), ",")
+	mimeType, isBase64 := strings.CutSuffix(meta, ";base64")
+	if !ok || !strings.HasPrefix(url, "data:") || !isBase64 {
+		return nil, fmt.Errorf("only base64 data URLs are supported for images")
+	}
+	b, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data URL: %v", err)
+	}
+	return &genai.Blob{MIMEType: mimeType, Data: b}, nil
+}
+
+// stopReason maps a finish reason onto its chat completions counterpart.
+func stopReason(reason genai.FinishReason) string {
+	switch reason {
+	case genai.FinishReasonMaxTokens:
+		return "length"
+	case genai.FinishReasonSafety, genai.FinishReasonRecitation, genai.FinishReasonBlocklist,
+		genai.FinishReasonProhibitedContent, genai.FinishReasonSPII, genai.FinishReasonImageSafety:
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+func oaiUsageOf(u *genai.GenerateContentResponseUsageMetadata) *oaiUsage {
+	if u == nil {
+		return nil
+	}
+	return &oaiUsage{
+		PromptTokens:     u.PromptTokenCount,
+		CompletionTokens: u.CandidatesTokenCount + u.ThoughtsTokenCount,
+		TotalTokens:      u.TotalTokenCount,
+	}
+}
+
+// errorStatus passes on the status of API errors.
+func errorStatus(err error) int {
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) && apiErr.Code >= 400 && apiErr.Code < 600 {
+		return apiErr.Code
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+func errorBody(err error) map[string]any {
+	return map[string]any{"error": map[string]any{"message": err.Error(), "type": "api_error"}}
+}
+
+func serveError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorBody(err))
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+// newTestServer serves the fake backend and returns an OpenAI client of it.
+func newTestServer(t *testing.T, fake *fakeBackend, args ...string) *openAIBackend {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir()) // default model
+	ctx := prepareTestContext(t, true, args...)
+	params := ctx.Value(core.ParamsKey).(*core.Parameters)
+	s := &server{params: params, keyVals: ctx.Value(core.KeyValsKey).(core.ParamMap), client: fake}
+	ts := httptest.NewServer(s.handler())
+	t.Cleanup(ts.Close)
+	return newOpenAIBackend(ts.URL+"/v1", "")
+}
+
+func TestServe_ChatCompletions(t *testing.T) {
+	thought := &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{
+		Content: &genai.Content{Role: "model", Parts: []*genai.Part{{Text: "hmm", Thought: true}}},
+	}}}
+	fake := &fakeBackend{
+		replies: []fakeReply{
+			{chunks: append([]*genai.GenerateContentResponse{thought}, textReply("Hello", " world").chunks...)},
+			textReply("again"),
+		},
+		model: &genai.Model{InputTokenLimit: 100000},
+	}
+	client := newTestServer(t, fake, "-serve", "localhost:0", "-f", "prompts/adr.sprompt")
+	contents := []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{Text: "hi"}}},
+		{Role: "model", Parts: []*genai.Part{{Text: "hello"}}},
+		{Role: "user", Parts: []*genai.Part{{Text: "how are you?"}}},
+	}
+	config := &genai.GenerateContentConfig{SystemInstruction: &genai.Content{Parts: []*genai.Part{{Text: "be brief"}}}}
+
+	var text, thoughts strings.Builder
+	var usage *genai.GenerateContentResponseUsageMetadata
+	var reason genai.FinishReason
+	for resp, err := range client.GenerateContentStream(t.Context(), "gemini-test", contents, config) {
+		if err != nil {
+			t.Fatalf("stream failed: %v", err)
+		}
+		for _, cand := range resp.Candidates {
+			for _, p := range cand.Content.Parts {
+				if p.Thought {
+					thoughts.WriteString(p.Text)
+				} else {
+					text.WriteString(p.Text)
+				}
+			}
+			if cand.FinishReason != "" {
+				reason = cand.FinishReason
+			}
+		}
+		if resp.UsageMetadata != nil {
+			usage = resp.UsageMetadata
+		}
+	}
+	if text.String() != "Hello world" || thoughts.String() != "hmm" || reason != genai.FinishReasonStop {
+		t.Errorf("unexpected stream %q, %q, %s", text.String(), thoughts.String(), reason)
+	}
+	if usage == nil || usage.TotalTokenCount != 5 {
+		t.Errorf("expected usage, got %+v", usage)
+	}
+	if fake.models[0] != "gemini-test" {
+		t.Errorf("expected requested model, got %s", fake.models[0])
+	}
+	sent := fake.contents[0]
+	if len(sent) != 3 || sent[1].Role != "model" || sent[2].Parts[0].Text != "how are you?" {
+		t.Errorf("expected prior turns and prompt, got %+v", sent)
+	}
+	sys := fake.configs[0].SystemInstruction
+	if sys == nil || len(sys.Parts) < 2 || sys.Parts[0].Text != "be brief" {
+		t.Errorf("expected system message and .sprompt file, got %+v", sys)
+	}
+
+	resp, err := client.GenerateContent(t.Context(), "", contents[:1], nil)
+	if err != nil {
+		t.Fatalf("completion failed: %v", err)
+	}
+	if resp.Text() != "again" || resp.UsageMetadata.TotalTokenCount != 5 {
+		t.Errorf("unexpected completion %+v", resp)
+	}
+}
+
+func TestServe_Errors(t *testing.T) {
+	fake := &fakeBackend{replies: []fakeReply{{err: genai.APIError{Code: 429, Message: "quota"}}}}
+	client := newTestServer(t, fake, "-serve", "localhost:0")
+	_, err := client.GenerateContent(t.Context(), "", []*genai.Content{{Role: "user", Parts: []*genai.Part{{Text: "hi"}}}}, nil)
+	if apiErr, ok := err.(genai.APIError); !ok || apiErr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected quota error passed on, got %v", err)
+	}
+	_, err = client.GenerateContent(t.Context(), "", []*genai.Content{{Role: "model", Parts: []*genai.Part{{Text: "hi"}}}}, nil)
+	if apiErr, ok := err.(genai.APIError); !ok || apiErr.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request without user message, got %v", err)
+	}
+	_, err = client.GenerateContent(t.Context(), "", []*genai.Content{
+		{Role: "user", Parts: []*genai.Part{{Text: "hi"}}},
+		{Role: "model", Parts: []*genai.Part{genai.NewPartFromFunctionCall("now", nil)}},
+		{Role: "user", Parts: []*genai.Part{genai.NewPartFromFunctionResponse("now", map[string]any{"time": "noon"})}},
+		{Role: "user", Parts: []*genai.Part{{Text: "and now?"}}},
+	}, nil)
+	if apiErr, ok := err.(genai.APIError); !ok || apiErr.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request with tool messages, got %v", err)
+	}
+}
+
+func TestServe_StreamError(t *testing.T) {
+	partial := textReply("Hello")
+	partial.chunks[0].Candidates[0].FinishReason = ""
+	partial.err = genai.APIError{Code: 400, Message: "bad"}
+	fake := &fakeBackend{replies: []fakeReply{partial}}
+	client := newTestServer(t, fake, "-serve", "localhost:0")
+	resp, err := http.Post(client.baseURL+"/chat/completions", "application/json",
+		strings.NewReader(`{"stream":true,"messages":[{"role":"user","content":"hi"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := strings.Split(strings.TrimSpace(string(body)), "\n\n")
+	if n := len(events); n < 3 || !strings.Contains(events[0], "Hello") || !strings.Contains(events[n-2], `"error"`) || events[n-1] != "data: [DONE]" {
+		t.Errorf("expected text, error and done events, got %q", body)
+	}
+}
+
+func TestServe_Embeddings(t *testing.T) {
+	client := newTestServer(t, &fakeBackend{}, "-serve", "localhost:0")
+	res, err := client.EmbedContent(t.Context(), "", []*genai.Content{{Parts: []*genai.Part{{Text: "a"}}}, {Parts: []*genai.Part{{Text: "b"}}}})
+	if err != nil {
+		t.Fatalf("embeddings failed: %v", err)
+	}
+	if len(res.Embeddings) != 2 || len(res.Embeddings[1].Values) != 3 {
+		t.Errorf("unexpected embeddings %+v", res.Embeddings)
+	}
+	models := 0
+	for m, err := range client.ListModels(t.Context()) {
+		if err != nil || m.Name != "gemini-3.5-flash-lite" {
+			t.Errorf("unexpected model %v, %v", m, err)
+		}
+		models++
+	}
+	if models != 1 {
+		t.Errorf("expected the served model, got %d models", models)
+	}
+}
+
+func TestParseDataURL(t *testing.T) {
+	blob, err := parseDataURL("data:image/png;base64,iVBORw==")
+	if err != nil || blob.MIMEType != "image/png" || len(blob.Data) != 4 {
+		t.Errorf("unexpected blob %+v, %v", blob, err)
+	}
+	for _, url := range []string{"https://example.com/a.png", "data:image/png,raw", "data:image/png;base64,!!"} {
+		if _, err := parseDataURL(url); err == nil {
+			t.Errorf("expected error for %s", url)
+		}
+	}
+}
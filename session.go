@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+const SessionsDir = "sessions" // name of chat sessions folder in the project's DotGenDir
+
+// SessionOps lists the values of -sessions.
+var SessionOps = []string{"list", "fork", "rename", "delete", "prune", "export"}
+
+// sessionPruneAge is the default age of sessions removed by prune.
+const sessionPruneAge = 30 * 24 * time.Hour
+
+var sessionNameRE = regexp.MustCompile(`^[\w.-]+$`)
+
+// chatSession is a named conversation kept in the session store.
+type chatSession struct {
+	Name    string           `json:"name"`
+	Title   string           `json:"title"` // first words of the first prompt
+	Model   string           `json:"model"`
+	Created time.Time        `json:"created"`
+	Updated time.Time        `json:"updated"`
+	History []*genai.Content `json:"history"`
+	Archive []*genai.Content `json:"archive,omitempty"` // turns summarized or trimmed
+}
+
+// sessionsDir returns the session store of the current directory, creating
+// it and migrating a chat history left in .gen if needed.
+func sessionsDir() (string, error) {
+	dir := filepath.Join(DotGenDir, SessionsDir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	if err := migrateDotGen(dir); err != nil {
+		return "", fmt.Errorf("migrating %s: %v", DotGen, err)
+	}
+	return dir, nil
+}
+
+// migrateDotGen moves the history of .gen into a session named after its
+// modification time.
+func migrateDotGen(dir string) error {
+	info, err := os.Stat(DotGen)
+	if errors.Is(err, os.ErrNotExist) || err == nil && info.IsDir() {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(DotGen)
+	if err != nil {
+		return err
+	}
+	s := &chatSession{Name: sessionName(info.ModTime()), Created: info.ModTime()}
+	if err := json.Unmarshal(data, &s.History); err != nil {
+		return err
+	}
+	if err := s.write(dir, info.ModTime()); err != nil {
+		return err
+	}
+	return os.Remove(DotGen)
+}
+
+// sessionName names a new session after its creation time.
+func sessionName(t time.Time) string {
+	return t.Format("20060102-150405")
+}
+
+func validSessionName(name string) error {
+	if !sessionNameRE.MatchString(name) || name == "." || name == ".." {
+		return fmt.Errorf("invalid session name '%s', use letters, digits, '.', '_' or '-'", name)
+	}
+	return nil
+}
+
+// loadSessions returns the sessions of the current directory, most recently
+// updated first.
+func loadSessions() ([]*chatSession, error) {
+	dir, err := sessionsDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var sessions []*chatSession
+	for _, path := range paths {
+		s, err := readSession(path)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	slices.SortFunc(sessions, func(a, b *chatSession) int {
+		return b.Updated.Compare(a.Updated)
+	})
+	return sessions, nil
+}
+
+func readSession(path string) (*chatSession, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &chatSession{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", filepath.Base(path), err)
+	}
+	return s, nil
+}
+
+// findSession returns the named session, or nil if there is none.
+func findSession(name string) (*chatSession, error) {
+	if err := validSessionName(name); err != nil {
+		return nil, err
+	}
+	dir, err := sessionsDir()
+	if err != nil {
+		return nil, err
+	}
+	s, err := readSession(filepath.Join(dir, name+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return s, err
+}
+
+// loadSession returns the named session, or the most recently updated one if
+// name is empty, starting a new session if none is found.
+func loadSession(name string) (*chatSession, error) {
+	var s *chatSession
+	var err error
+	if name != "" {
+		s, err = findSession(name)
+	} else {
+		var sessions []*chatSession
+		sessions, err = loadSessions()
+		if len(sessions) > 0 {
+			s = sessions[0]
+		}
+	}
+	if err != nil || s != nil {
+		return s, err
+	}
+	now := time.Now()
+	if name == "" {
+		name = sessionName(now)
+	}
+	return &chatSession{Name: name, Created: now}, nil
+}
+
+// save stores the session, titled after its first prompt if untitled.
+func (s *chatSession) save() error {
+	dir, err := sessionsDir()
+	if err != nil {
+		return err
+	}
+	return s.write(dir, time.Now())
+}
+
+func (s *chatSession) write(dir string, updated time.Time) error {
+	if s.Title == "" {
+		s.Title = sessionTitle(transcript(s))
+	}
+	s.Updated = updated
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, s.Name+".json"), data, 0600)
+}
+
+// transcript returns the turns of a session, archived turns in place of
+// their summary, if any.
+func transcript(s *chatSession) []*genai.Content {
+	if len(s.Archive) > 0 {
+		return slices.Concat(s.Archive, withoutSummary(s.History))
+	}
+	return s.History
+}
+
+// sessionTitle returns the first words of the first prompt of history.
+func sessionTitle(history []*genai.Content) string {
+	const maxLen = 60
+	for _, c := range history {
+		if c.Role != "user" || isSummary(c) {
+			continue
+		}
+		for _, p := range c.Parts {
+			if text := strings.Join(strings.Fields(p.Text), " "); text != "" {
+				if r := []rune(text); len(r) > maxLen {
+					return string(r[:maxLen-1]) + "…"
+				}
+				return text
+			}
+		}
+	}
+	return ""
+}
+
+// turns returns the index in history at which each user turn starts,
+// function responses being part of the turn that called them.
+func turns(history []*genai.Content) []int {
+	var res []int
+	for i, c := range history {
+		if c.Role == "user" && !slices.ContainsFunc(c.Parts, func(p *genai.Part) bool { return p.FunctionResponse != nil }) {
+			res = append(res, i)
+		}
+	}
+	return res
+}
+
+// runSessions lists, forks, renames, deletes, prunes or exports chat sessions.
+func runSessions(ctx context.Context, out io.Writer) error {
+	params, ok := ctx.Value(core.ParamsKey).(*core.Parameters)
+	if !ok {
+		return fmt.Errorf("missing params")
+	}
+	args := params.Args
+	switch params.SessionOp {
+	case "list":
+		sessions, err := loadSessions()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "name\tturns\tmodel\tupdated\ttitle\t\n")
+		for _, s := range sessions {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t\n", s.Name, len(turns(s.History)), s.Model,
+				s.Updated.Local().Format(time.DateTime), s.Title)
+		}
+		return w.Flush()
+	case "fork":
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid turn '%s'", args[1])
+		}
+		s, err := findSession(args[0])
+		if err != nil {
+			return err
+		}
+		if s == nil {
+			return fmt.Errorf("no session %s", args[0])
+		}
+		starts := turns(s.History)
+		if n > len(starts) {
+			return fmt.Errorf("session %s has %d turns", s.Name, len(starts))
+		}
+		name := fmt.Sprintf("%s-%d", s.Name, n)
+		if len(args) > 2 {
+			name = args[2]
+		}
+		if other, err := findSession(name); err != nil {
+			return err
+		} else if other != nil {
+			return fmt.Errorf("session %s exists", name)
+		}
+		if n < len(starts) {
+			s.History = s.History[:starts[n]]
+		}
+		s.Name, s.Title, s.Created = name, "", time.Now()
+		if err := s.save(); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s\n", name)
+	case "rename":
+		s, err := findSession(args[0])
+		if err != nil {
+			return err
+		}
+		if s == nil {
+			return fmt.Errorf("no session %s", args[0])
+		}
+		if other, err := findSession(args[1]); err != nil {
+			return err
+		} else if other != nil {
+			return fmt.Errorf("session %s exists", args[1])
+		}
+		dir, err := sessionsDir()
+		if err != nil {
+			return err
+		}
+		s.Name = args[1]
+		if err := s.write(dir, s.Updated); err != nil {
+			return err
+		}
+		return os.Remove(filepath.Join(dir, args[0]+".json"))
+	case "delete":
+		dir, err := sessionsDir()
+		if err != nil {
+			return err
+		}
+		for _, name := range args {
+			if err := validSessionName(name); err != nil {
+				return err
+			}
+			if err := os.Remove(filepath.Join(dir, name+".json")); errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("no session %s", name)
+			} else if err != nil {
+				return err
+			}
+		}
+	case "prune":
+		age := sessionPruneAge
+		if len(args) > 0 {
+			d, err := time.ParseDuration(args[0])
+			if err != nil || d <= 0 {
+				return fmt.Errorf("invalid age '%s'", args[0])
+			}
+			age = d
+		}
+		sessions, err := loadSessions()
+		if err != nil {
+			return err
+		}
+		dir, err := sessionsDir()
+		if err != nil {
+			return err
+		}
+		for _, s := range sessions {
+			if time.Since(s.Updated) < age {
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, s.Name+".json")); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "deleted %s\n", s.Name)
+		}
+	case "export":
+		var sessions []*chatSession
+		for _, name := range args[1:] {
+			s, err := findSession(name)
+			if err != nil {
+				return err
+			}
+			if s == nil {
+				return fmt.Errorf("no session %s", name)
+			}
+			sessions = append(sessions, s)
+		}
+		if len(sessions) == 0 {
+			all, err := loadSessions()
+			if err != nil {
+				return err
+			}
+			if len(all) == 0 {
+				return fmt.Errorf("no session to export")
+			}
+			sessions = all[:1]
+		}
+		return exportSessions(out, args[0], sessions)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+// chatHistory builds a history of n question and answer turns.
+func chatHistory(n int) []*genai.Content {
+	var hist []*genai.Content
+	for i := 1; i <= n; i++ {
+		hist = append(hist,
+			&genai.Content{Role: "user", Parts: []*genai.Part{{Text: "question " + string(rune('0'+i))}}},
+			&genai.Content{Role: "model", Parts: []*genai.Part{{FunctionCall: &genai.FunctionCall{Name: "f"}}}},
+			&genai.Content{Role: "user", Parts: []*genai.Part{{FunctionResponse: &genai.FunctionResponse{Name: "f"}}}},
+			&genai.Content{Role: "model", Parts: []*genai.Part{{Text: "answer"}}},
+		)
+	}
+	return hist
+}
+
+func TestMigrateDotGen(t *testing.T) {
+	t.Chdir(t.TempDir())
+	data, _ := json.Marshal(chatHistory(2))
+	os.WriteFile(DotGen, data, 0644)
+
+	sessions, err := loadSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 || len(sessions[0].History) != 8 || sessions[0].Title != "question 1" {
+		t.Fatalf("expected migrated session, got %+v", sessions)
+	}
+	if _, err := os.Stat(DotGen); !os.IsNotExist(err) {
+		t.Errorf("expected %s removed, got %v", DotGen, err)
+	}
+}
+
+func TestRunSessions(t *testing.T) {
+	t.Chdir(t.TempDir())
+	old := &chatSession{Name: "old", History: chatHistory(1)}
+	dir, _ := sessionsDir()
+	if err := old.write(dir, time.Now().Add(-48*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := (&chatSession{Name: "topic", Model: "m", History: chatHistory(3)}).save(); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(args ...string) (string, error) {
+		ctx := prepareTestContext(t, true, args...)
+		var out strings.Builder
+		err := runSessions(ctx, &out)
+		return out.String(), err
+	}
+
+	if out, err := run("-sessions", "list"); err != nil || !strings.Contains(out, "topic  3      m") ||
+		strings.Index(out, "topic") > strings.Index(out, "old") {
+		t.Errorf("unexpected list %q, %v", out, err)
+	}
+	if out, err := run("-sessions", "fork", "topic", "2"); err != nil || out != "topic-2\n" {
+		t.Fatalf("unexpected fork %q, %v", out, err)
+	}
+	if s, _ := findSession("topic-2"); s == nil || len(s.History) != 8 || len(turns(s.History)) != 2 {
+		t.Errorf("expected two turns in fork, got %+v", s)
+	}
+	if _, err := run("-sessions", "fork", "topic", "4"); err == nil {
+		t.Errorf("expected error forking past the last turn")
+	}
+	if _, err := run("-sessions", "rename", "topic-2", "old"); err == nil {
+		t.Errorf("expected error renaming onto an existing session")
+	}
+	if _, err := run("-sessions", "rename", "topic-2", "side"); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := findSession("topic-2"); s != nil {
+		t.Errorf("expected topic-2 renamed")
+	}
+	if out, err := run("-sessions", "prune", "24h"); err != nil || out != "deleted old\n" {
+		t.Errorf("unexpected prune %q, %v", out, err)
+	}
+	if _, err := run("-sessions", "delete", "side", "../topic"); err == nil {
+		t.Errorf("expected invalid name error")
+	}
+	if _, err := run("-sessions", "delete", "topic"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run("-sessions", "delete", "topic"); err == nil {
+		t.Errorf("expected error deleting a missing session")
+	}
+	if entries, _ := os.ReadDir(filepath.Join(DotGenDir, SessionsDir)); len(entries) != 0 {
+		t.Errorf("expected empty store, got %v", entries)
+	}
+}
+
+func TestGenContent_Session(t *testing.T) {
+	t.Chdir(t.TempDir())
+	chat := func(args ...string) string {
+		fake := &fakeBackend{replies: []fakeReply{textReply("ok")}}
+		ctx := prepareTestContext(t, true, append([]string{"-c"}, args...)...)
+		ctx.Value(core.ParamsKey).(*core.Parameters).Client = fake
+		var output strings.Builder
+		if err := genContent(ctx, iotest.OneByteReader(strings.NewReader("\n\n")), &output); err != nil {
+			t.Fatal(err)
+		}
+		return output.String()
+	}
+
+	chat("-session", "a", "first")
+	chat("-session", "b", "second")
+	if out := chat("-session", "a", "third"); !strings.Contains(out, "session a resumed") {
+		t.Errorf("expected session a resumed, got %q", out)
+	}
+	if out := chat("fourth"); !strings.Contains(out, "session a resumed") {
+		t.Errorf("expected last updated session resumed, got %q", out)
+	}
+	a, _ := findSession("a")
+	b, _ := findSession("b")
+	if len(a.History) != 6 || len(b.History) != 2 || a.Title != "first" || a.Model == "" {
+		t.Errorf("unexpected sessions %+v, %+v", a, b)
+	}
+}
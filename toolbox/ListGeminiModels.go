@@ -4,17 +4,18 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/jdevoo/gen/core"
 	"google.golang.org/genai"
 )
 
 // GetKnownGeminiModels retrieves the list of available Gemini models.
 func (t Tool) ListGeminiModels(ctx context.Context) (*genai.Part, error) {
 	var res []string
-	client, err := genai.NewClient(ctx, nil)
-	if err != nil {
-		return nil, err
+	params, ok := ctx.Value(core.ParamsKey).(*core.Parameters)
+	if !ok || params.Client == nil {
+		return nil, fmt.Errorf("ListGeminiModels: backend not found in context")
 	}
-	for m, err := range client.Models.All(ctx) {
+	for m, err := range params.Client.ListModels(ctx) {
 		if err != nil {
 			return nil, err
 		}
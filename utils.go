@@ -96,7 +96,18 @@ func processFunctionCalls(ctx context.Context, fcMap map[string]*genai.FunctionC
 		if err != nil {
 			return nil, err
 		}
-		res = append(res, genRes)
+		if genRes != nil {
+			res = append(res, genRes)
+		}
+	}
+	// echo call IDs so backends can pair calls and responses
+	for _, p := range res {
+		if p.FunctionResponse == nil {
+			continue
+		}
+		if fc, ok := fcMap[p.FunctionResponse.Name]; ok && p.FunctionResponse.ID == "" {
+			p.FunctionResponse.ID = fc.ID
+		}
 	}
 	return &genai.Candidate{
 		Content: &genai.Content{
@@ -223,3 +234,21 @@ func isYouTubeURL(path string) bool {
 	youtubeRegex := regexp.MustCompile(`(?i)^((?:https?:)?//)?((?:www|m)\.)?((?:youtube(?:-nocookie)?\.com|youtu.be))(/(?:[\w\-]+\?v=|embed/|v/|shorts/|live/)?)([\w\-]+)(\S+)?$`)
 	return youtubeRegex.MatchString(path)
 }
+
+// addUsage returns the sum of token counts in acc and u.
+func addUsage(acc, u *genai.GenerateContentResponseUsageMetadata) *genai.GenerateContentResponseUsageMetadata {
+	if u == nil {
+		return acc
+	}
+	if acc == nil {
+		acc = &genai.GenerateContentResponseUsageMetadata{}
+	}
+	return &genai.GenerateContentResponseUsageMetadata{
+		PromptTokenCount:        acc.PromptTokenCount + u.PromptTokenCount,
+		CachedContentTokenCount: acc.CachedContentTokenCount + u.CachedContentTokenCount,
+		CandidatesTokenCount:    acc.CandidatesTokenCount + u.CandidatesTokenCount,
+		ThoughtsTokenCount:      acc.ThoughtsTokenCount + u.ThoughtsTokenCount,
+		ToolUsePromptTokenCount: acc.ToolUsePromptTokenCount + u.ToolUsePromptTokenCount,
+		TotalTokenCount:         acc.TotalTokenCount + u.TotalTokenCount,
+	}
+}
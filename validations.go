@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/jdevoo/gen/core"
@@ -22,6 +23,21 @@ func isFlagSet(name string) bool {
 
 // validPrompts checks prompts against regular interactive vs no redirect or piped content session.
 func validPrompts(params *core.Parameters) error {
+	if params.BatchPath != "" || params.JobOp != "" {
+		return nil // prompts come from the batch file
+	}
+	if params.Report != "" || params.SessionOp != "" {
+		return nil // no prompt needed
+	}
+	if params.Schema != "" && !params.JSON {
+		return nil // schema printed
+	}
+	if params.Upscale != "" {
+		return nil // image attached with -f
+	}
+	if params.Serve != "" || params.MCPServe != "" {
+		return nil // prompts come from requests
+	}
 	if (params.Interactive &&
 		// no regular prompt privided
 		((len(params.Args) == 0 && !anyMatches(params.FilePaths, PExt)) ||
@@ -78,13 +94,42 @@ func validRanges(params *core.Parameters) error {
 		// invalid temperature values
 		(params.Temp < 0 || params.Temp > 2) ||
 		// invalid topP values
-		(params.TopP < 0 || params.TopP > 1) {
+		(params.TopP < 0 || params.TopP > 1) ||
+		// invalid compaction fraction
+		(params.Compact < 0 || params.Compact > 1) ||
+		// invalid cache lifetime
+		params.CacheTTL < 0 ||
+		// invalid job operation
+		(len(params.JobOp) > 0 && !slices.Contains([]string{"submit", "status", "wait", "fetch"}, params.JobOp)) ||
+		// invalid session operation
+		(len(params.SessionOp) > 0 && !slices.Contains(SessionOps, params.SessionOp)) ||
+		// invalid report grouping
+		(len(params.Report) > 0 && !slices.Contains(ReportGroups, params.Report)) ||
+		// invalid candidate count
+		(params.Candidates < 1 || params.Candidates > 8) ||
+		// invalid number of votes
+		(params.Votes < 0 || params.Votes == 1 || params.Votes > 32) ||
+		// invalid upscale factor
+		(len(params.Upscale) > 0 && !slices.Contains(UpscaleFactors, params.Upscale)) ||
+		// invalid number of repairs
+		(params.Repairs < 0 || params.Repairs > 10) ||
+		// missing model
+		len(params.GenModel) == 0 ||
+		// invalid trim strategy
+		!slices.Contains(TrimStrategies, params.Trim) ||
+		// invalid batch values
+		(len(params.BatchPath) > 0 && params.Workers < 1) || params.Rate < 0 {
 		return fmt.Errorf("invalid option values")
 	}
 	return nil
 }
 
 func validCombos(params *core.Parameters) error {
+	// batch prompts come from the file only
+	if len(params.BatchPath) > 0 &&
+		(params.ChatMode || params.Embed || params.ImgModality || len(params.Args) > 0) {
+		return fmt.Errorf("invalid options combination: -batch with a prompt, -c, -e or -img")
+	}
 	if
 	// at most one JSON schema
 	(params.JSON && !zeroOrOneMatches(params.FilePaths, ".json")) ||
@@ -102,13 +147,97 @@ func validCombos(params *core.Parameters) error {
 		(params.ImgModality &&
 			(params.GoogleSearch || params.CodeGen ||
 				params.Tool || params.JSON || params.ChatMode || params.Embed)) ||
-		// out path only with -img and no redirect
+		// audio modality with incompatible flags
+		(params.AudioModality &&
+			(params.ImgModality || params.GoogleSearch || params.CodeGen || params.Tool || params.JSON ||
+				params.ChatMode || params.Embed || params.NDJSON || params.Candidates > 1 || params.Votes > 1 ||
+				len(params.ExtractPath) > 0 || len(params.BatchPath) > 0 || len(params.JobOp) > 0 ||
+				len(params.Serve) > 0 || len(params.MCPServe) > 0)) ||
+		// out path only with -img, -audio or video models and no redirect
 		(len(params.OutPath) > 0 &&
-			(!(params.ImgModality || params.CodeGen) || params.OutRedirected)) ||
+			(!(params.ImgModality || params.AudioModality || params.CodeGen || isVideoModel(params.GenModel)) ||
+				params.OutRedirected && !params.NDJSON)) ||
 		// walk without file attached that is not some prompt
 		(params.Walk &&
 			(len(params.FilePaths) == 0 ||
 				allMatch(params.FilePaths, PExt) || allMatch(params.FilePaths, SPExt))) ||
+		// cache with tools or embeddings
+		(params.CacheTTL > 0 &&
+			(params.Tool || params.GoogleSearch || params.CodeGen || params.Embed)) ||
+		// batch job operations
+		(len(params.JobOp) > 0 &&
+			(params.Tool || params.ChatMode || params.Embed || params.ImgModality ||
+				(params.JobOp == "submit" && len(params.BatchPath) == 0) ||
+				(params.JobOp != "submit" && (len(params.BatchPath) > 0 || len(params.Args) > 1)))) ||
+		// image generation model options
+		((len(params.MaskPath) > 0 || len(params.Upscale) > 0) &&
+			!(params.ImgModality && isImageModel(params.GenModel))) ||
+		// image and video generation model options
+		((len(params.AspectRatio) > 0 || len(params.NegativePrompt) > 0) &&
+			!(params.ImgModality && isImageModel(params.GenModel)) && !isVideoModel(params.GenModel)) ||
+		// video generation models with incompatible flags
+		(isVideoModel(params.GenModel) &&
+			(params.ImgModality || params.AudioModality || params.GoogleSearch || params.CodeGen || params.Tool || params.JSON ||
+				params.ChatMode || params.Embed || params.NDJSON || params.Votes > 1 || params.CacheTTL > 0 ||
+				len(params.DigestPaths) > 0 || len(params.ExtractPath) > 0 || len(params.BatchPath) > 0 || len(params.JobOp) > 0 ||
+				len(params.Serve) > 0 || len(params.MCPServe) > 0)) ||
+		// image generation models with incompatible flags
+		(params.ImgModality && isImageModel(params.GenModel) &&
+			(params.NDJSON || params.Votes > 1 || params.CacheTTL > 0 || len(params.DigestPaths) > 0 || len(params.ExtractPath) > 0 ||
+				(len(params.Upscale) > 0 && len(params.MaskPath) > 0))) ||
+		// several candidates with incompatible flags
+		(params.Candidates > 1 &&
+			(params.Tool || (params.ImgModality && !isImageModel(params.GenModel)) || params.Embed || len(params.BatchPath) > 0 || len(params.JobOp) > 0)) ||
+		// voting with incompatible flags
+		(params.Votes > 1 &&
+			(params.ChatMode || params.Tool || params.ImgModality || params.Embed || params.Candidates > 1 ||
+				len(params.BatchPath) > 0 || len(params.JobOp) > 0)) ||
+		// answer extraction without voting
+		(len(params.Answer) > 0 && params.Votes == 0) ||
+		// events for a single generation stream
+		(params.NDJSON &&
+			(params.Candidates > 1 || params.Votes > 1 || params.Embed || len(params.BatchPath) > 0 || len(params.JobOp) > 0)) ||
+		// server with prompt or other modes
+		(len(params.Serve) > 0 &&
+			(len(params.Args) > 0 || params.ChatMode || params.Embed || params.ImgModality || params.SystemInstruction ||
+				params.Candidates > 1 || params.Votes > 1 || params.NDJSON ||
+				len(params.BatchPath) > 0 || len(params.JobOp) > 0 || len(params.Report) > 0)) ||
+		// MCP server with prompt or other modes
+		(len(params.MCPServe) > 0 &&
+			(len(params.Args) > 0 || params.ChatMode || params.Embed || params.ImgModality || params.SystemInstruction ||
+				params.Candidates > 1 || params.Votes > 1 || params.NDJSON || len(params.Serve) > 0 ||
+				len(params.BatchPath) > 0 || len(params.JobOp) > 0 || len(params.Report) > 0)) ||
+		// session name outside chat mode
+		(len(params.Session) > 0 && !params.ChatMode) ||
+		// session operations with other modes or wrong arguments
+		(len(params.SessionOp) > 0 &&
+			(params.ChatMode || params.Embed || len(params.FilePaths) > 0 ||
+				len(params.BatchPath) > 0 || len(params.JobOp) > 0 || len(params.Report) > 0 ||
+				(params.SessionOp == "list" && len(params.Args) > 0) ||
+				(params.SessionOp == "fork" && (len(params.Args) < 2 || len(params.Args) > 3)) ||
+				(params.SessionOp == "rename" && len(params.Args) != 2) ||
+				(params.SessionOp == "delete" && len(params.Args) == 0) ||
+				(params.SessionOp == "prune" && len(params.Args) > 1) ||
+				(params.SessionOp == "export" && (len(params.Args) == 0 || !slices.Contains(ExportFormats, params.Args[0]) ||
+					params.Args[0] != "jsonl" && len(params.Args) > 2)))) ||
+		// report with prompt or other modes
+		(len(params.Report) > 0 &&
+			(len(params.Args) > 0 || params.ChatMode || params.Embed || len(params.BatchPath) > 0 || len(params.JobOp) > 0)) ||
+		// schema printed without -json, or derived in place of an attached one
+		(len(params.Schema) > 0 &&
+			((!params.JSON && (len(params.Args) > 0 || len(params.FilePaths) > 0 || params.ChatMode || params.Embed ||
+				len(params.BatchPath) > 0 || len(params.JobOp) > 0 || len(params.Serve) > 0 || len(params.MCPServe) > 0 || len(params.Report) > 0)) ||
+				(params.JSON && (params.Schema == "-" || anyMatches(params.FilePaths, ".json"))))) ||
+		// code extraction from a single text stream
+		(len(params.ExtractPath) > 0 &&
+			(params.JSON || params.Embed || params.ImgModality || params.Candidates > 1 || params.Votes > 1 ||
+				len(params.BatchPath) > 0 || len(params.JobOp) > 0 || len(params.Serve) > 0 || len(params.MCPServe) > 0)) ||
+		// overwrite without extraction
+		(params.Overwrite && len(params.ExtractPath) == 0) ||
+		// record and replay at once
+		(len(params.RecordPath) > 0 && len(params.ReplayPath) > 0) ||
+		// lenient without replay
+		(params.Lenient && len(params.ReplayPath) == 0) ||
 		// chat mode
 		(params.ChatMode &&
 			// with incompatible flags
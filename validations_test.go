@@ -12,35 +12,64 @@ import (
 
 func SetupFlags(fs *flag.FlagSet, params *core.Parameters, keyVals *core.ParamMap) {
 	fs.BoolVar(&params.Verbose, "V", false, "")
+	fs.StringVar(&params.Answer, "answer", "", "")
+	fs.StringVar(&params.AspectRatio, "aspect", "", "")
+	fs.BoolVar(&params.AudioModality, "audio", false, "")
+	fs.StringVar(&params.BatchPath, "batch", "", "")
+	fs.DurationVar(&params.CacheTTL, "cache", 0, "")
 	fs.BoolVar(&params.ChatMode, "c", false, "")
 	fs.BoolVar(&params.CodeGen, "code", false, "")
+	fs.Float64Var(&params.Compact, "compact", 0, "")
 	fs.Var(&params.DigestPaths, "d", "")
 	fs.BoolVar(&params.Embed, "e", false, "")
+	fs.StringVar(&params.ExtractPath, "extract", "", "")
 	fs.Var(&params.FilePaths, "f", "")
 	fs.BoolVar(&params.GoogleSearch, "g", false, "")
 	fs.BoolVar(&params.Help, "h", false, "")
 	fs.BoolVar(&params.ImgModality, "img", false, "")
+	fs.StringVar(&params.JobOp, "job", "", "")
 	fs.BoolVar(&params.JSON, "json", false, "")
 	fs.IntVar(&params.K, "k", 3, "")
 	fs.Float64Var(&params.Lambda, "l", 0.5, "")
+	fs.BoolVar(&params.Lenient, "lenient", false, "")
 	fs.Func("think", "", func(v string) error {
 		params.ThinkingLevel = genai.ThinkingLevelUnspecified
 		return nil
 	})
+	fs.StringVar(&params.MaskPath, "mask", "", "")
 	fs.StringVar(&params.GenModel, "m", "gemini-2.0-flash", "")
 	fs.Var(&params.MCPServers, "mcp", "")
+	fs.IntVar(&params.Candidates, "n", 1, "")
+	fs.StringVar(&params.NegativePrompt, "negative", "", "")
+	fs.BoolVar(&params.NDJSON, "ndjson", false, "")
 	fs.StringVar(&params.OutPath, "out", "", "")
 	fs.BoolVar(&params.OnlyKvs, "o", false, "")
+	fs.BoolVar(&params.Overwrite, "overwrite", false, "")
 	fs.Var(keyVals, "p", "")
+	fs.Float64Var(&params.Rate, "rate", 0, "")
+	fs.StringVar(&params.RecordPath, "record", "", "")
+	fs.IntVar(&params.Repairs, "repair", 2, "")
+	fs.StringVar(&params.Report, "report", "", "")
+	fs.StringVar(&params.ReplayPath, "replay", "", "")
 	fs.BoolVar(&params.SystemInstruction, "s", false, "")
+	fs.StringVar(&params.Schema, "schema", "", "")
+	fs.StringVar(&params.Serve, "serve", "", "")
+	fs.StringVar(&params.Session, "session", "", "")
+	fs.StringVar(&params.SessionOp, "sessions", "", "")
+	fs.StringVar(&params.MCPServe, "mcpserve", "", "")
 	fs.BoolVar(&params.CountTokens, "t", false, "")
 	fs.Float64Var(&params.Temp, "temp", 1.0, "")
 	fs.DurationVar(&params.Timeout, "timeout", 90*time.Second, "")
 	fs.BoolVar(&params.Tool, "tool", false, "")
 	fs.Float64Var(&params.TopP, "top_p", 0.95, "")
+	fs.StringVar(&params.Trim, "trim", "oldest", "")
+	fs.StringVar(&params.Upscale, "upscale", "", "")
 	fs.BoolVar(&params.Unsafe, "unsafe", false, "")
 	fs.BoolVar(&params.Version, "v", false, "")
 	fs.BoolVar(&params.Walk, "w", false, "")
+	fs.StringVar(&params.Voice, "voice", "Kore", "")
+	fs.IntVar(&params.Votes, "vote", 0, "")
+	fs.IntVar(&params.Workers, "workers", 4, "")
 }
 
 func TestArgsInvalid(t *testing.T) {
@@ -155,6 +184,312 @@ func TestArgsInvalid(t *testing.T) {
 			interactive: true,
 			expected:    false,
 		},
+		{
+			name:        "batch file",
+			args:        []string{"-batch", "prompts.jsonl", "-workers", "8"},
+			interactive: true,
+			expected:    false,
+		},
+		{
+			name:        "batch with prompt",
+			args:        []string{"-batch", "prompts.jsonl", "why?"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "batch without workers",
+			args:        []string{"-batch", "-", "-workers", "0"},
+			interactive: false,
+			expected:    true,
+		},
+		{
+			name:        "submit batch job",
+			args:        []string{"-batch", "prompts.jsonl", "-job", "submit"},
+			interactive: true,
+			expected:    false,
+		},
+		{
+			name:        "fetch named job",
+			args:        []string{"-job", "fetch", "batches/123"},
+			interactive: true,
+			expected:    false,
+		},
+		{
+			name:        "submit without batch file",
+			args:        []string{"-job", "submit"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "unknown job operation",
+			args:        []string{"-job", "cancel"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "usage report",
+			args:        []string{"-report", "day"},
+			interactive: true,
+			expected:    false,
+		},
+		{
+			name:        "usage report with prompt",
+			args:        []string{"-report", "model", "hello"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "unknown usage report",
+			args:        []string{"-report", "week"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "candidates with tools",
+			args:        []string{"-n", "2", "-tool", "list models"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "no candidates",
+			args:        []string{"-n", "0", "hello"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "vote on reasoning prompt",
+			args:        []string{"-vote", "5", "-answer", "The answer is (.+)", "-f", "cot.prompt"},
+			interactive: true,
+			expected:    false,
+		},
+		{
+			name:        "vote in chat",
+			args:        []string{"-vote", "5", "-c", "hello"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "answer without vote",
+			args:        []string{"-answer", "x", "hello"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "events with tools",
+			args:        []string{"-ndjson", "-tool", "list models"},
+			interactive: true,
+			expected:    false,
+		},
+		{
+			name:        "events with candidates",
+			args:        []string{"-ndjson", "-n", "2", "hello"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "serve with tools",
+			args:        []string{"-serve", "localhost:8080", "-tool", "-f", "prompts/adr.sprompt"},
+			interactive: true,
+			expected:    false,
+		},
+		{
+			name:        "serve with prompt",
+			args:        []string{"-serve", "localhost:8080", "hello"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "mcp server with prompts and digest",
+			args:        []string{"-mcpserve", "stdio", "-f", "prompts", "-d", "digest"},
+			interactive: true,
+			expected:    false,
+		},
+		{
+			name:        "mcp server with openai server",
+			args:        []string{"-mcpserve", "stdio", "-serve", "localhost:8080"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "too many repairs",
+			args:        []string{"-json", "-repair", "11", "hello"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "schema printed",
+			args:        []string{"-schema", "name,tags:[]string"},
+			interactive: true,
+			expected:    false,
+		},
+		{
+			name:        "schema printed with prompt",
+			args:        []string{"-schema", "name", "hello"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "schema and attached schema",
+			args:        []string{"-json", "-schema", "name", "-f", "recipe.json", "hello"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "extract code",
+			args:        []string{"-extract", "src", "-overwrite", "write a server"},
+			interactive: true,
+			expected:    false,
+		},
+		{
+			name:        "extract with json",
+			args:        []string{"-extract", "src", "-json", "write a server"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "overwrite without extract",
+			args:        []string{"-overwrite", "write a server"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "audio to out folder",
+			args:        []string{"-audio", "-out", ".", "-voice", "Joe:Kore,Jane:Puck", "read this"},
+			interactive: true,
+			expected:    false,
+		},
+		{
+			name:        "audio in chat mode",
+			args:        []string{"-audio", "-c", "read this"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "image model with several images",
+			args:        []string{"-img", "-m", "imagen-4.0-generate-001", "-n", "4", "-aspect", "16:9", "a cat"},
+			interactive: true,
+			expected:    false,
+		},
+		{
+			name:        "upscale without prompt",
+			args:        []string{"-img", "-m", "imagen-4.0-upscale-preview", "-upscale", "x2", "-f", "photo.png"},
+			interactive: true,
+			expected:    false,
+		},
+		{
+			name:        "image model options with gemini",
+			args:        []string{"-img", "-aspect", "16:9", "a cat"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "several images with gemini",
+			args:        []string{"-img", "-n", "2", "a cat"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "video model from image",
+			args:        []string{"-m", "veo-3.1-generate-preview", "-aspect", "9:16", "-f", "photo.png", "make it move"},
+			interactive: true,
+			expected:    false,
+		},
+		{
+			name:        "video model with mask",
+			args:        []string{"-m", "veo-3.1-generate-preview", "-mask", "mask.png", "make it move"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "video model in chat mode",
+			args:        []string{"-m", "veo-3.1-generate-preview", "-c", "make it move"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "named chat session",
+			args:        []string{"-c", "-session", "refactoring", "hello"},
+			interactive: true,
+			expected:    false,
+		},
+		{
+			name:        "session name without chat",
+			args:        []string{"-session", "refactoring", "hello"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "fork session at turn",
+			args:        []string{"-sessions", "fork", "refactoring", "3"},
+			interactive: true,
+			expected:    false,
+		},
+		{
+			name:        "fork session without turn",
+			args:        []string{"-sessions", "fork", "refactoring"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "unknown session operation",
+			args:        []string{"-sessions", "show"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "export sessions for tuning",
+			args:        []string{"-sessions", "export", "jsonl", "refactoring", "other-approach"},
+			interactive: true,
+			expected:    false,
+		},
+		{
+			name:        "export several sessions as one page",
+			args:        []string{"-sessions", "export", "html", "refactoring", "other-approach"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "export in unknown format",
+			args:        []string{"-sessions", "export", "pdf"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "chat compacted at 80 percent",
+			args:        []string{"-c", "-compact", "0.8", "hello"},
+			interactive: true,
+			expected:    false,
+		},
+		{
+			name:        "compaction fraction over one",
+			args:        []string{"-c", "-compact", "80", "hello"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "cache with tools",
+			args:        []string{"-cache", "1h", "-tool", "list models"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "record and replay",
+			args:        []string{"-record", "a", "-replay", "b", "hello"},
+			interactive: true,
+			expected:    true,
+		},
+		{
+			name:        "lenient replay",
+			args:        []string{"-replay", "b", "-lenient", "hello"},
+			interactive: true,
+			expected:    false,
+		},
+		{
+			name:        "lenient without replay",
+			args:        []string{"-lenient", "hello"},
+			interactive: true,
+			expected:    true,
+		},
 	}
 
 	var params *core.Parameters
@@ -183,3 +518,26 @@ func TestArgsInvalid(t *testing.T) {
 		})
 	}
 }
+
+func TestValidCombos_Batch(t *testing.T) {
+	testCases := []struct {
+		name   string
+		params core.Parameters
+	}{
+		{"prompt", core.Parameters{BatchPath: "prompts.jsonl", Args: []string{"why?"}}},
+		{"chat", core.Parameters{BatchPath: "prompts.jsonl", ChatMode: true}},
+		{"embed", core.Parameters{BatchPath: "prompts.jsonl", Embed: true}},
+		{"image", core.Parameters{BatchPath: "prompts.jsonl", ImgModality: true}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validCombos(&tc.params)
+			if err == nil || err.Error() != "invalid options combination: -batch with a prompt, -c, -e or -img" {
+				t.Errorf("expected error naming -batch, got %v", err)
+			}
+		})
+	}
+	if err := validCombos(&core.Parameters{BatchPath: "prompts.jsonl"}); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+// videoPollInterval is the delay between two status checks of a video operation.
+var videoPollInterval = 10 * time.Second
+
+// isVideoModel reports whether model is served through GenerateVideos
+// rather than GenerateContent, as Veo models are.
+func isVideoModel(model string) bool {
+	return strings.HasPrefix(strings.TrimPrefix(model, "models/"), "veo")
+}
+
+// generateVideos generates videos from the prompt, starting from the image
+// attached with -f if any, using a video generation model.
+func (g *Generator) generateVideos() error {
+	images, prompt, err := g.mediaInputs()
+	if err != nil {
+		return err
+	}
+	if len(images) > 1 {
+		return fmt.Errorf("video generation takes at most one image attached with -f, got %d", len(images))
+	}
+	var image *genai.Image
+	if len(images) == 1 {
+		image = images[0]
+	}
+	videos, ok := core.As[core.VideoGenerator](g.client)
+	if !ok {
+		return core.Unsupported(g.client, "video generation models")
+	}
+	op, err := videos.GenerateVideos(g.ctx, g.params.GenModel, prompt, image, &genai.GenerateVideosConfig{
+		NumberOfVideos: int32(g.params.Candidates),
+		AspectRatio:    g.params.AspectRatio,
+		NegativePrompt: g.params.NegativePrompt,
+	})
+	if err != nil {
+		return err
+	}
+	if op, err = g.waitVideos(videos, op); err != nil {
+		return err
+	}
+	return g.emitGeneratedVideos(videos, op.Response)
+}
+
+// waitVideos polls op until done, bounded by -timeout and interrupts.
+func (g *Generator) waitVideos(videos core.VideoGenerator, op *genai.GenerateVideosOperation) (*genai.GenerateVideosOperation, error) {
+	if !g.params.OutRedirected && !g.params.Verbose {
+		spinner := NewSpinner("%s")
+		spinner.Start()
+		defer spinner.Stop()
+	}
+	var err error
+	for !op.Done {
+		if g.params.Verbose {
+			fmt.Fprintf(os.Stderr, infos("%s running\n"), op.Name)
+		}
+		select {
+		case <-g.ctx.Done():
+			return nil, fmt.Errorf("video generation cancelled or timed out for '%s': %v", op.Name, g.ctx.Err())
+		case <-time.After(videoPollInterval):
+		}
+		if op, err = videos.GetVideosOperation(g.ctx, op); err != nil {
+			return nil, err
+		}
+	}
+	if op.Error != nil {
+		return nil, fmt.Errorf("video generation failed: %v", op.Error["message"])
+	}
+	return op, nil
+}
+
+// emitGeneratedVideos writes the first video to stdout when redirected,
+// otherwise saves each video as gen-<time>-<n>.mp4 in -out or the temp folder.
+func (g *Generator) emitGeneratedVideos(videos core.VideoGenerator, res *genai.GenerateVideosResponse) error {
+	if res == nil {
+		return fmt.Errorf("no video generated")
+	}
+	for _, reason := range res.RAIMediaFilteredReasons {
+		fmt.Fprintf(os.Stderr, "video filtered: %s\n", reason)
+	}
+	prefix := "gen-" + time.Now().Format("20060102-150405")
+	n := 0
+	for _, gv := range res.GeneratedVideos {
+		if gv.Video == nil {
+			continue
+		}
+		data := gv.Video.VideoBytes
+		if len(data) == 0 && gv.Video.URI != "" {
+			var err error
+			if data, err = videos.DownloadVideo(g.ctx, gv.Video); err != nil {
+				return fmt.Errorf("downloading video: %v", err)
+			}
+		}
+		if len(data) == 0 {
+			continue
+		}
+		n++
+		if g.params.OutRedirected && g.events == nil {
+			if n == 1 { // output first video only
+				if _, err := g.out.Write(data); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		path, err := saveVideo(g.params.OutPath, fmt.Sprintf("%s-%d", prefix, n), data)
+		if err != nil {
+			return err
+		}
+		if g.events != nil {
+			if err := g.events.emitSaved("video/mp4", path); err != nil {
+				return err
+			}
+			continue
+		}
+		fmt.Fprintf(g.out, infos("%s")+"\n", path)
+	}
+	if n == 0 {
+		return fmt.Errorf("no video generated")
+	}
+	return nil
+}
+
+// saveVideo writes data to dir, the temp folder if empty, as name.mp4,
+// never replacing an existing file.
+func saveVideo(dir string, name string, data []byte) (string, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	path := filepath.Join(dir, name+".mp4")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", fmt.Errorf("saving video: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return "", fmt.Errorf("saving video: %v", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+func TestGenContent_Video(t *testing.T) {
+	defer func(d time.Duration) { videoPollInterval = d }(videoPollInterval)
+	videoPollInterval = time.Millisecond
+
+	dir := t.TempDir()
+	photo := filepath.Join(dir, "photo.png")
+	os.WriteFile(photo, pngBytes(t, 1), 0644)
+	videos := []*genai.GeneratedVideo{
+		{Video: &genai.Video{VideoBytes: []byte("first video"), MIMEType: "video/mp4"}},
+		{Video: &genai.Video{URI: "files/second:download"}},
+	}
+
+	testCases := []struct {
+		name       string
+		args       []string
+		redirected bool
+		frame      bool
+		files      int
+	}{
+		{"generate", []string{"-n", "2", "-aspect", "16:9", "a cat"}, false, false, 2},
+		{"generate redirected", []string{"a cat"}, true, false, 0},
+		{"from image", []string{"-f", photo, "a cat"}, false, true, 2},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := t.TempDir()
+			fake := &fakeBackend{videos: videos, pending: 2}
+			args := []string{"-m", "veo-3.1-generate-preview"}
+			if !tc.redirected {
+				args = append(args, "-out", out)
+			}
+			ctx := prepareTestContext(t, true, append(args, tc.args...)...)
+			params := ctx.Value(core.ParamsKey).(*core.Parameters)
+			params.Client = fake
+			params.OutRedirected = tc.redirected
+			var output bytes.Buffer
+			if err := genContent(ctx, strings.NewReader(""), &output); err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"video:a cat", "poll:operations/video", "poll:operations/video", "poll:operations/video"}
+			if strings.Join(fake.calls, ",") != strings.Join(want, ",") {
+				t.Errorf("expected %v, got %v", want, fake.calls)
+			}
+			if (fake.frame != nil) != tc.frame {
+				t.Errorf("expected first frame %v, got %v", tc.frame, fake.frame)
+			}
+			if tc.redirected {
+				if output.String() != "first video" {
+					t.Errorf("expected first video on stdout, got %q", output.String())
+				}
+				return
+			}
+			entries, _ := os.ReadDir(out)
+			if len(entries) != tc.files {
+				t.Fatalf("expected %d files, got %v", tc.files, entries)
+			}
+			for n, e := range entries {
+				if !regexp.MustCompile(`^gen-\d{8}-\d{6}-\d\.mp4$`).MatchString(e.Name()) || !strings.Contains(output.String(), e.Name()) {
+					t.Errorf("unexpected file %d %s", n, e.Name())
+				}
+			}
+			if data, _ := os.ReadFile(filepath.Join(out, entries[1].Name())); string(data) != "video from files/second:download" {
+				t.Errorf("expected downloaded video, got %q", data)
+			}
+		})
+	}
+}
+
+func TestGenContent_VideoTimeout(t *testing.T) {
+	defer func(d time.Duration) { videoPollInterval = d }(videoPollInterval)
+	videoPollInterval = time.Millisecond
+
+	fake := &fakeBackend{pending: 1 << 30}
+	ctx := prepareTestContext(t, true, "-m", "veo-3.1-generate-preview", "-timeout", "20ms", "a cat")
+	ctx.Value(core.ParamsKey).(*core.Parameters).Client = fake
+	err := genContent(ctx, strings.NewReader(""), &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "timed out for 'operations/video'") {
+		t.Errorf("expected timeout error, got %v", err)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/genai"
+)
+
+// noAnswer stands for samples where no answer could be extracted.
+const noAnswer = "(no answer)"
+
+// voteSample is the outcome of one sample.
+type voteSample struct {
+	text   string
+	answer string
+	err    error
+}
+
+// answerFunc extracts the final answer from the text of a sample.
+type answerFunc func(text string) (string, error)
+
+// vote samples the prompt Votes times concurrently, extracts an answer from
+// each and emits the majority answer followed by the vote distribution.
+func (g *Generator) vote(config *genai.GenerateContentConfig) error {
+	extract, err := g.answerExtractor()
+	if err != nil {
+		return err
+	}
+	contents := []*genai.Content{{Role: "user", Parts: g.parts}}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	samples := make([]voteSample, g.params.Votes)
+	for n := range samples {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := g.client.GenerateContent(g.ctx, g.params.GenModel, contents, config)
+			if err != nil {
+				samples[n].err = err
+				return
+			}
+			mu.Lock()
+			g.usage = addUsage(g.usage, resp.UsageMetadata)
+			if g.params.CountTokens && resp.UsageMetadata != nil {
+				TokenCount.Add(resp.UsageMetadata.TotalTokenCount)
+			}
+			mu.Unlock()
+			samples[n].text = responseText(resp)
+			samples[n].answer, samples[n].err = extract(samples[n].text)
+		}()
+	}
+	wg.Wait()
+
+	var order []string // answers by first appearance
+	counts := map[string]int{}
+	shown := map[string]string{noAnswer: noAnswer} // first spelling of a normalized answer
+	failed := 0
+	for n, s := range samples {
+		if s.err != nil {
+			if g.params.Verbose {
+				fmt.Fprintf(os.Stderr, infos("sample %d: %v\n"), n+1, s.err)
+			}
+			failed++
+			continue
+		}
+		if g.params.Verbose {
+			fmt.Fprintf(os.Stderr, infos("sample %d: %s\n"), n+1, s.answer)
+		}
+		key := normalizeAnswer(s.answer)
+		if key == "" {
+			key = noAnswer
+		}
+		if _, ok := counts[key]; !ok {
+			order = append(order, key)
+			if key != noAnswer {
+				shown[key] = strings.TrimRight(strings.TrimSpace(s.answer), ".!")
+			}
+		}
+		counts[key]++
+	}
+	if failed == len(samples) {
+		return fmt.Errorf("all %d samples failed: %v", failed, samples[0].err)
+	}
+
+	// most voted first, ties in order of appearance, missing answers last
+	slices.SortStableFunc(order, func(a, b string) int {
+		if (a == noAnswer) != (b == noAnswer) {
+			return cmpBool(a == noAnswer)
+		}
+		return counts[b] - counts[a]
+	})
+	best := order[0]
+	if best == noAnswer {
+		return fmt.Errorf("no answer found in %d samples", len(samples))
+	}
+	if g.params.OutRedirected {
+		fmt.Fprintf(g.out, "%s\n", shown[best])
+	} else {
+		fmt.Fprintf(g.out, important("%s")+"\n", shown[best])
+	}
+	for _, k := range order {
+		line := fmt.Sprintf("%d/%d %s", counts[k], len(samples), shown[k])
+		if g.params.OutRedirected {
+			fmt.Fprintf(g.out, "%s\n", line)
+		} else {
+			fmt.Fprintf(g.out, infos("%s")+"\n", line)
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d samples failed\n", failed, len(samples))
+	}
+	return nil
+}
+
+// answerExtractor returns the extraction set with -answer: a judge .prompt
+// file, a JSON path with -json or a regular expression. Without -answer the
+// whole JSON or the last line of text is the answer.
+func (g *Generator) answerExtractor() (answerFunc, error) {
+	expr := g.params.Answer
+	switch {
+	case path.Ext(expr) == PExt:
+		data, err := os.ReadFile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("reading judge prompt: %v", err)
+		}
+		judge := searchReplace(string(data), g.keyVals)
+		config := &genai.GenerateContentConfig{Temperature: genai.Ptr(float32(0))}
+		var mu sync.Mutex
+		return func(text string) (string, error) {
+			contents := []*genai.Content{{Role: "user", Parts: []*genai.Part{{Text: judge}, {Text: text}}}}
+			resp, err := g.client.GenerateContent(g.ctx, g.params.GenModel, contents, config)
+			if err != nil {
+				return "", fmt.Errorf("judge: %v", err)
+			}
+			mu.Lock()
+			g.usage = addUsage(g.usage, resp.UsageMetadata)
+			if g.params.CountTokens && resp.UsageMetadata != nil {
+				TokenCount.Add(resp.UsageMetadata.TotalTokenCount)
+			}
+			mu.Unlock()
+			return responseText(resp), nil
+		}, nil
+	case g.params.JSON:
+		return func(text string) (string, error) {
+			return jsonPath(text, expr)
+		}, nil
+	case expr != "":
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid answer pattern: %v", err)
+		}
+		return func(text string) (string, error) {
+			m := re.FindAllStringSubmatch(text, -1)
+			if len(m) == 0 {
+				return "", nil
+			}
+			last := m[len(m)-1] // reasoning ends with the answer
+			return last[len(last)-1], nil
+		}, nil
+	}
+	return func(text string) (string, error) {
+		lines := strings.Split(strings.TrimSpace(text), "\n")
+		return lines[len(lines)-1], nil
+	}, nil
+}
+
+// responseText concatenates the text parts of the first candidate, thoughts excluded.
+func responseText(resp *genai.GenerateContentResponse) string {
+	if len(resp.Candidates) == 0 {
+		return ""
+	}
+	return contentText(resp.Candidates[0].Content)
+}
+
+// contentText joins the text parts of content, leaving out thoughts.
+func contentText(content *genai.Content) string {
+	var sb strings.Builder
+	if content != nil {
+		for _, p := range content.Parts {
+			if !p.Thought {
+				sb.WriteString(p.Text)
+			}
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+// jsonPath returns the value at a dotted path such as $.items[0].name,
+// or the whole document for an empty path. Strings are returned unquoted.
+func jsonPath(text, expr string) (string, error) {
+	var v any
+	if err := json.Unmarshal([]byte(text), &v); err != nil {
+		return "", fmt.Errorf("invalid JSON sample: %v", err)
+	}
+	expr = strings.TrimPrefix(strings.TrimPrefix(expr, "$"), ".")
+	for _, field := range strings.FieldsFunc(expr, func(r rune) bool { return r == '.' || r == '[' }) {
+		if idx, ok := strings.CutSuffix(field, "]"); ok {
+			i, err := strconv.Atoi(idx)
+			arr, isArr := v.([]any)
+			if err != nil || !isArr || i < 0 || i >= len(arr) {
+				return "", nil
+			}
+			v = arr[i]
+			continue
+		}
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return "", nil
+		}
+		v = obj[field]
+	}
+	switch val := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return val, nil
+	}
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// cmpBool orders true after false.
+func cmpBool(last bool) int {
+	if last {
+		return 1
+	}
+	return -1
+}
+
+// normalizeAnswer folds case, spacing and trailing punctuation for counting.
+func normalizeAnswer(s string) string {
+	s = strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	return strings.TrimRight(s, ".!")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jdevoo/gen/core"
+	"google.golang.org/genai"
+)
+
+func TestGenContent_Vote(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     []string
+		replies  []string
+		expected string
+	}{
+		{
+			name:     "regex",
+			args:     []string{"-vote", "5", "-t", "-answer", `The answer is (.+?)\.`, "how long?"},
+			replies:  []string{"The answer is 4 hours.", "The answer is 4 hours.", "The answer is 5 hours.", "no idea", "First 2 hours. The answer is 4 hours."},
+			expected: "4 hours\n3/5 4 hours\n1/5 5 hours\n1/5 (no answer)\n",
+		},
+		{
+			name:     "last line",
+			args:     []string{"-vote", "3", "pick a number"},
+			replies:  []string{"thinking\n7", "8", "hmm\n7."},
+			expected: "7\n2/3 7\n1/3 8\n",
+		},
+		{
+			name:     "json path",
+			args:     []string{"-vote", "3", "-json", "-answer", "$.result[0].value", "solve"},
+			replies:  []string{`{"result":[{"value":42}]}`, `{"result":[{"value":41}]}`, `{"result":[{"value":42}]}`},
+			expected: "42\n2/3 42\n1/3 41\n",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake := &fakeBackend{}
+			for _, r := range tc.replies {
+				fake.replies = append(fake.replies, textReply(r))
+			}
+			ctx := prepareTestContext(t, true, tc.args...)
+			params := ctx.Value(core.ParamsKey).(*core.Parameters)
+			params.Client = fake
+			params.OutRedirected = true
+			TokenCount.Store(0)
+			var output strings.Builder
+			if err := genContent(ctx, strings.NewReader(""), &output); err != nil {
+				t.Fatalf("genContent failed: %v", err)
+			}
+			if output.String() != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, output.String())
+			}
+			if len(fake.contents) != len(tc.replies) {
+				t.Errorf("expected %d samples, got %d", len(tc.replies), len(fake.contents))
+			}
+			if params.CountTokens && TokenCount.Load() != int32(5*len(tc.replies)) {
+				t.Errorf("expected usage of all samples counted, got %d", TokenCount.Load())
+			}
+		})
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	doc := `{"answer":"yes","items":[{"name":"a"},{"name":"b","tags":["x"]}]}`
+	testCases := []struct {
+		expr     string
+		expected string
+	}{
+		{"answer", "yes"},
+		{"$.answer", "yes"},
+		{"items[1].name", "b"},
+		{"$.items[1].tags", `["x"]`},
+		{"items[5].name", ""},
+		{"missing", ""},
+		{"", doc},
+	}
+	for _, tc := range testCases {
+		got, err := jsonPath(doc, tc.expr)
+		if err != nil || got != tc.expected {
+			t.Errorf("jsonPath(%q) = %q, %v", tc.expr, got, err)
+		}
+	}
+	if _, err := jsonPath("not json", "a"); err == nil {
+		t.Errorf("expected error on invalid JSON")
+	}
+}
+
+func TestResponseText(t *testing.T) {
+	resp := &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{Content: &genai.Content{Parts: []*genai.Part{
+		{Text: "pondering", Thought: true}, {Text: " 42 "},
+	}}}}}
+	if got := responseText(resp); got != "42" {
+		t.Errorf("expected thoughts excluded, got %q", got)
+	}
+}